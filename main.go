@@ -1,35 +1,290 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	synckr "github.com/koukihai/synckr/synckr"
 	"github.com/sirupsen/logrus"
+	"gopkg.in/masci/flickr.v2"
 )
 
+// configFile is the configuration read by synckr, from the working directory
+const configFile = "./synckr.conf.json"
+
 var log = logrus.New()
 
+var watch = flag.Bool("watch", false, "stay resident and upload new photos as they appear")
+
+var authorizeOnly = flag.Bool("authorize", false, "authorize synckr on flickr, save the token into the configuration, then exit")
+
+var check = flag.Bool("check", false, "validate the credentials and their permissions, then exit")
+
+var dryRun = flag.Bool("dry-run", false, "print the planned changes instead of applying them")
+
+var statsOnly = flag.Bool("stats-only", false, "print the differences between the library and flickr, then exit")
+
+var limit = flag.Int("limit", 0, "stop after processing that many files, for smoke-testing")
+
+var retryFailures = flag.Bool("retry-failures", false, "only retry the uploads which failed during the previous runs")
+
+var noUpload = flag.Bool("no-upload", false, "only update the titles, descriptions and tags of the photos already on flickr")
+
+var deleteBatch = flag.String("delete-batch", "", "delete from flickr the photos uploaded by the run of that batch id, then exit")
+
+var repairTitles = flag.String("repair-titles", "", "fix the titles of the photos of that directory which were cut at their first dot, then exit")
+
+var printConfig = flag.Bool("print-config", false, "print the effective configuration, credentials masked, then exit")
+
+// Command line values take precedence over synckr.conf.json: when given at least
+// once, they replace the configured list entirely
+var (
+	extensions stringList
+	skipDirs   stringList
+)
+
+func init() {
+	flag.Var(&extensions, "ext", "extension to upload, replaces extensions from the configuration (repeatable)")
+	flag.Var(&skipDirs, "skip-dir", "directory to skip, replaces skip_dirs from the configuration (repeatable)")
+}
+
+// stringList is a flag which may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// applyOverrides replaces the configured extensions and skipped directories
+// with the ones given on the command line, if any.
+// Extensions are normalized to lowercase with a leading dot
+func applyOverrides(config *synckr.Config, extensions []string, skipDirs []string) {
+	if len(extensions) > 0 {
+		config.Extensions = make([]string, 0, len(extensions))
+		for _, ext := range extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			config.Extensions = append(config.Extensions, ext)
+		}
+	}
+	if len(skipDirs) > 0 {
+		config.SkipDirs = append([]string(nil), skipDirs...)
+	}
+}
+
+// applyFlags applies the command line flags over the configuration
+func applyFlags(config *synckr.Config) {
+	if *watch {
+		config.Watch = true
+	}
+	if *dryRun {
+		config.DryRun = true
+	}
+	if *retryFailures {
+		config.RetryFailures = true
+	}
+	if *noUpload {
+		config.MetadataOnly = true
+	}
+	if *limit > 0 {
+		config.FileLimit = *limit
+	}
+	applyOverrides(config, extensions, skipDirs)
+}
+
+// writeConfig writes the configuration as indented JSON, credentials masked
+func writeConfig(w io.Writer, config synckr.Config) error {
+	raw, err := json.MarshalIndent(config.Redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", raw)
+	return err
+}
+
+// authorize runs the oauth authorization flow through getToken and saves the
+// token into the configuration file, or into its SecretsFile when set, without
+// touching any photo. A failed flow is an ErrAuth
+func authorize(filename string, config *synckr.Config, getToken func(*flickr.FlickrClient) (string, string, error)) error {
+	client := flickr.NewFlickrClient(config.APIKey, config.APISecret)
+	token, secret, err := getToken(client)
+	if err != nil {
+		return &synckr.Error{Kind: synckr.ErrAuth, Op: "authorize", Err: err}
+	}
+	config.OAuthToken = token
+	config.OAuthTokenSecret = secret
+	if config.SecretsFile != "" {
+		filename = config.SecretsFile
+	}
+	return synckr.SaveOAuthToken(filename, token, secret)
+}
+
+// confirm asks a yes or no question, defaulting to no
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// isInteractive tells whether a user can answer the authorization prompt
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Exit codes telling scripts which kind of error stopped synckr
+const (
+	exitError = 1 + iota
+	exitConfig
+	exitAuth
+	exitRetrieve
+	exitUpload
+)
+
+// exitCode returns the exit code of an error, according to its kind
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, synckr.ErrConfig):
+		return exitConfig
+	case errors.Is(err, synckr.ErrAuth):
+		return exitAuth
+	case errors.Is(err, synckr.ErrRetrieve):
+		return exitRetrieve
+	case errors.Is(err, synckr.ErrUpload):
+		return exitUpload
+	}
+	return exitError
+}
+
 // main is the pricipal entry point
 func main() {
-	config, err := synckr.LoadConfiguration("./synckr.conf.json")
+	flag.Parse()
+
+	config, err := synckr.LoadConfiguration(configFile)
 	if err != nil {
-		log.Fatal("Unable to load configuration")
+		log.WithField("error", err).Error("[FATAL] Unable to load configuration")
+		os.Exit(exitCode(err))
 	}
 
-	if config.LogOutput != "" {
-		logfile, err := os.OpenFile("synckr.log", os.O_CREATE|os.O_WRONLY, 0666)
+	if *authorizeOnly {
+		if err := authorize(configFile, &config, synckr.GetOAuthToken); err != nil {
+			log.WithField("error", err).Error("[ERROR] Authorization failed")
+			os.Exit(exitCode(err))
+		}
+		log.WithField("config", configFile).Info("[OK] Authorization saved")
+		return
+	}
+
+	applyFlags(&config)
+
+	if *printConfig {
+		if err := writeConfig(os.Stdout, config); err != nil {
+			log.WithField("error", err).Error("[ERROR] Could not print configuration")
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	// A log file which can't be opened is warned about, logs then go to stderr
+	synckr.ConfigureLogging(&config, log)
+
+	if config.MetricsAddr != "" {
+		_, err := synckr.ServeMetrics(config.MetricsAddr)
 		if err != nil {
-			log.Info("Failed to log to file, using default stderr")
-		} else {
-			log.Out = logfile
+			log.WithField("metrics_addr", config.MetricsAddr).Error("Unable to serve metrics")
 		}
 	}
 
 	client, err := synckr.GetClient(&config)
 	if err != nil {
-		log.Fatal("Unable to instanciate flickrClient")
+		log.WithField("error", err).Error("[FATAL] Unable to instanciate flickrClient")
+		os.Exit(exitCode(err))
+	}
+
+	if *check {
+		if err := synckr.SelfCheck(&client); err != nil {
+			log.WithField("error", err).Error("[ERROR] Self check failed")
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	if *deleteBatch != "" {
+		batch, err := synckr.FindBatch(&client, *deleteBatch)
+		if err != nil {
+			log.WithField("error", err).Error("[ERROR] Could not find the photos of the batch")
+			os.Exit(exitCode(err))
+		}
+		if len(batch) == 0 {
+			log.WithField("batch", *deleteBatch).Info("[SKIP] No photo in batch")
+			return
+		}
+		if !isInteractive() || !confirm(os.Stdin, os.Stdout, fmt.Sprintf("Delete %d photos of batch %s from flickr?", len(batch), *deleteBatch)) {
+			log.WithField("batch", *deleteBatch).Info("[SKIP] Batch deletion not confirmed")
+			os.Exit(exitError)
+		}
+		if err := synckr.DeleteBatch(&client, batch); err != nil {
+			log.WithField("error", err).Error("[ERROR] Batch deletion failed")
+			os.Exit(exitCode(err))
+		}
+		return
 	}
 
-	synckr.Process(&config, &client, log)
+	if *repairTitles != "" {
+		if err := synckr.RepairTitles(&config, &client, *repairTitles); err != nil {
+			log.WithField("error", err).Error("[ERROR] Title repair failed")
+			os.Exit(exitCode(err))
+		}
+		return
+	}
 
+	if *statsOnly {
+		report, err := synckr.Diff(&config, &client)
+		if err != nil {
+			log.WithField("error", err).Error("[ERROR] Diff failed")
+			os.Exit(exitCode(err))
+		}
+		report.Print(os.Stdout)
+		return
+	}
+
+	fromFlickr, err := synckr.Process(&config, &client, log)
+	if errors.Is(err, synckr.ErrAuthorization) && !config.NonInteractive && isInteractive() {
+		// The new token is saved like with -authorize, the next runs use it
+		if err := authorize(configFile, &config, synckr.GetOAuthToken); err != nil {
+			log.WithField("error", err).Error("[ERROR] Authorization failed")
+			os.Exit(exitCode(err))
+		}
+		client, err = synckr.GetClient(&config)
+		if err != nil {
+			log.WithField("error", err).Error("[FATAL] Unable to instanciate flickrClient")
+			os.Exit(exitCode(err))
+		}
+		fromFlickr, err = synckr.Process(&config, &client, log)
+	}
+	// Watch does not wait for the upload quota to reset, a run which reached it
+	// exits with its code instead of watching
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
+
+	if config.Watch && !config.DryRun {
+		if err := synckr.Watch(&config, &client, fromFlickr, log, nil); err != nil {
+			os.Exit(exitCode(err))
+		}
+	}
 }
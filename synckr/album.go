@@ -0,0 +1,122 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// albumNameSeparator is used to join path components when AlbumDepth
+// is greater than one
+const albumNameSeparator = " / "
+
+// albumName returns the title of the album a given photo belongs to.
+// By default the album is named after the parent directory of the photo.
+// When AlbumDepth is set, the first AlbumDepth directories below
+// PhotoLibraryPath form the album name, so photos from deeper
+// subdirectories roll up into the same album. Otherwise AlbumNameParentLevel
+// selects the ancestor naming the album: 1 for the parent, 2 for the grandparent,
+// without going above the directories directly below PhotoLibraryPath.
+// Files directly in PhotoLibraryPath go to RootAlbumName.
+func albumName(config *Config, path string) string {
+	dir := filepath.Dir(path)
+	if dir == config.PhotoLibraryPath && config.RootAlbumName != "" {
+		return config.RootAlbumName
+	}
+	if config.AlbumDepth <= 0 {
+		return filepath.Base(ancestorDir(config, dir, config.AlbumNameParentLevel))
+	}
+
+	rel, err := filepath.Rel(config.PhotoLibraryPath, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return filepath.Base(dir)
+	}
+
+	components := strings.Split(rel, string(filepath.Separator))
+	if len(components) > config.AlbumDepth {
+		components = components[:config.AlbumDepth]
+	}
+	return strings.Join(components, albumNameSeparator)
+}
+
+// ancestorDir returns the level-th ancestor of a file in dir, dir itself being
+// the first one. It stops at the directories directly below PhotoLibraryPath
+func ancestorDir(config *Config, dir string, level int) string {
+	for ; level > 1; level-- {
+		parent := filepath.Dir(dir)
+		if rel, err := filepath.Rel(config.PhotoLibraryPath, parent); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			break
+		}
+		dir = parent
+	}
+	return dir
+}
+
+// albumsFollowDirectories tells whether each directory holds the files of a single album
+func albumsFollowDirectories(config *Config) bool {
+	return config.AlbumNameStrategy == "" || config.AlbumNameStrategy == AlbumNameDirectory
+}
+
+// isCompleteAlbum tells whether the local files of the album stored in dir are
+// as many as the photos of the matching flickr albums. whole is true when the
+// entire subtree of dir belongs to that album and may be skipped at once,
+// otherwise only the files directly in dir belong to it.
+func isCompleteAlbum(config *Config, fromFlickr map[string][]FlickrPhotoset, dir string) (complete bool, whole bool) {
+	// The files of a directory may belong to several albums, or share theirs
+	// with the directories of the same ancestor
+	if !albumsFollowDirectories(config) || (config.AlbumDepth <= 0 && config.AlbumNameParentLevel > 1) {
+		return false, false
+	}
+
+	rel, err := filepath.Rel(config.PhotoLibraryPath, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+
+	depth := len(strings.Split(rel, string(filepath.Separator)))
+	if config.AlbumDepth > 0 && depth > config.AlbumDepth {
+		// Already evaluated along with its ancestor
+		return false, false
+	}
+	whole = config.AlbumDepth > 0 && depth == config.AlbumDepth
+
+	albums, present := fromFlickr[albumTitleForDir(config, dir)]
+	if !present {
+		return false, false
+	}
+	remote := 0
+	for _, album := range albums {
+		remote += len(album.Photos)
+	}
+
+	count, hasSubdirs := countLocalPhotos(config, dir, whole)
+	if !whole && !hasSubdirs {
+		whole = true
+	}
+	return count == remote, whole
+}
+
+// countLocalPhotos counts the files with an allowed extension in dir, and in its
+// subdirectories when recursive is set
+func countLocalPhotos(config *Config, dir string, recursive bool) (count int, hasSubdirs bool) {
+	walkLibraryDir(config, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path == dir {
+				return nil
+			}
+			hasSubdirs = true
+			if !recursive || isSkippedDir(config, path) || isHidden(config, path) || exceedsMaxDepth(config, path) || hasNoMedia(config, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hasAllowedExtension(config, path) && !isHidden(config, path) {
+			count++
+		}
+		return nil
+	})
+	return count, hasSubdirs
+}
@@ -0,0 +1,268 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// makeTree creates the given files (relative paths) below a new temporary
+// directory and returns its path
+func makeTree(t *testing.T, files ...string) string {
+	root, err := ioutil.TempDir("", "synckr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestAlbumNameDepth(t *testing.T) {
+	root := makeTree(t,
+		"2023/Italy/Rome/day1/a.jpg",
+		"2023/Italy/Rome/day2/b.jpg",
+		"2023/Italy/Milan/c.jpg",
+		"2023/Spain/d.jpg",
+		"2024/e.jpg",
+	)
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		depth    int
+		expected []string
+	}{
+		{0, []string{"2024", "Milan", "Spain", "day1", "day2"}},
+		{1, []string{"2023", "2024"}},
+		{2, []string{"2023 / Italy", "2023 / Spain", "2024"}},
+		{3, []string{"2023 / Italy / Milan", "2023 / Italy / Rome", "2023 / Spain", "2024"}},
+	}
+
+	for _, tt := range tests {
+		config := Config{PhotoLibraryPath: root, AlbumDepth: tt.depth}
+		albums := make(map[string]bool)
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if !info.IsDir() {
+				albums[albumName(&config, path)] = true
+			}
+			return nil
+		})
+
+		var got []string
+		for a := range albums {
+			got = append(got, a)
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.expected) {
+			t.Errorf("depth %d: expected albums %v, got %v", tt.depth, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("depth %d: expected albums %v, got %v", tt.depth, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestAlbumNameParentLevel(t *testing.T) {
+	root := filepath.FromSlash("/photos")
+	tests := []struct {
+		level    int
+		path     string
+		expected string
+	}{
+		{0, "Album/day1/a.jpg", "day1"},
+		{1, "Album/day1/a.jpg", "day1"},
+		{2, "Album/day1/a.jpg", "Album"},
+		{2, "Album/day1/morning/a.jpg", "day1"},
+		{3, "Album/day1/morning/a.jpg", "Album"},
+		// The level is clamped to the directories below the library
+		{2, "Album/a.jpg", "Album"},
+		{5, "Album/day1/a.jpg", "Album"},
+	}
+	for _, tt := range tests {
+		config := Config{PhotoLibraryPath: root, AlbumNameParentLevel: tt.level}
+		if got := albumName(&config, filepath.Join(root, filepath.FromSlash(tt.path))); got != tt.expected {
+			t.Errorf("level %d, %s: expected %q, got %q", tt.level, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessAlbumNameParentLevel(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("Album", "a")
+
+	root := makeTree(t, "Album/day1/a.jpg", "Album/day2/b.jpg", "Album/c.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.AlbumNameParentLevel = 2
+	config.SkipCompleteAlbums = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	titles := stub.titles(stub.set("Album"))
+	sort.Strings(titles)
+	if !reflect.DeepEqual(titles, []string{"a", "b", "c"}) || stub.set("day1") != nil || stub.set("day2") != nil {
+		t.Errorf("Subfolders should roll up into the album of their parent, got %v", titles)
+	}
+}
+
+func TestSkipCompleteAlbums(t *testing.T) {
+	tests := []struct {
+		name     string
+		local    []string
+		uploaded int
+	}{
+		// c is not on flickr, but the album is considered complete as counts match
+		{"equal", []string{"album/a.jpg", "album/c.jpg", "album/notes.txt"}, 0},
+		{"fewer", []string{"album/c.jpg"}, 1},
+		{"more", []string{"album/a.jpg", "album/b.jpg", "album/c.jpg"}, 1},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		stub.addSet("album", "a", "b")
+		root := makeTree(t, tt.local...)
+
+		config := testConfig(root)
+		config.SkipCompleteAlbums = true
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if stub.count("upload") != tt.uploaded {
+			t.Errorf("%s: expected %d uploads, got %d", tt.name, tt.uploaded, stub.count("upload"))
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestSkipCompleteAlbumsKeepsSubAlbums(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	root := makeTree(t, "album/a.jpg", "album/sub/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.SkipCompleteAlbums = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.set("sub") == nil {
+		t.Error("Subdirectories of a complete album are distinct albums and should still be processed")
+	}
+}
+
+func TestRootAlbumName(t *testing.T) {
+	for _, rootAlbum := range []string{"", "Unsorted"} {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "loose.jpg", "album/a.jpg")
+
+		config := testConfig(root)
+		config.RootAlbumName = rootAlbum
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if rootAlbum == "" {
+			if stub.count("upload") != 1 {
+				t.Errorf("Root files should be skipped, got %d uploads", stub.count("upload"))
+			}
+		} else {
+			set := stub.set(rootAlbum)
+			if set == nil {
+				t.Errorf("Album %s should have been created", rootAlbum)
+			} else if titles := stub.titles(set); len(titles) != 1 || titles[0] != "loose" {
+				t.Errorf("Root album should only contain loose, got %v", titles)
+			}
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestFallbackAlbum(t *testing.T) {
+	for _, fallback := range []string{"", "Unsorted"} {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "  /a.jpg", "dated/b.jpg")
+
+		config := testConfig(root)
+		config.FallbackAlbum = fallback
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		// A template rendering nothing yields empty titles as well
+		config.AlbumTitleTemplate = "{exifdate}"
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if stub.set("  ") != nil || stub.set("") != nil {
+			t.Errorf("%q: no album with an empty title should be created", fallback)
+		}
+		set := stub.set("Unsorted")
+		if fallback == "" && (set != nil || stub.count("upload") != 1) {
+			t.Errorf("Photos without album title should be skipped, got %d uploads", stub.count("upload"))
+		}
+		if fallback != "" && (set == nil || len(set.Photos) != 2) {
+			t.Errorf("Photos without album title should go to the fallback album, got %v", set)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestClassifyAddError(t *testing.T) {
+	tests := []struct {
+		code   int
+		level  logrus.Level
+		benign bool
+	}{
+		{photoAlreadyInSetErrorCode, logrus.InfoLevel, true},
+		{photosetNotFoundErrorCode, logrus.ErrorLevel, false},
+		{photoNotFoundErrorCode, logrus.ErrorLevel, false},
+		{photosetFullErrorCode, logrus.WarnLevel, false},
+		{105, logrus.ErrorLevel, false},
+	}
+	for _, tt := range tests {
+		if level, benign := classifyAddError(tt.code); level != tt.level || benign != tt.benign {
+			t.Errorf("%d: expected %s %v, got %s %v", tt.code, tt.level, tt.benign, level, benign)
+		}
+	}
+}
+
+func TestAppendPhotoAlreadyInSet(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	setID := stub.addSet("album", "a")
+	photoID := stub.set("album").Photos[0]
+
+	logger := logrus.NewEntry(log)
+	if _, err := AppendPhotoIntoExistingAlbum(stub.client(), logger, setID, photoID); err != nil {
+		t.Errorf("A photo already in the album should not be an error, got %v", err)
+	}
+	if _, err := AppendPhotoIntoExistingAlbum(stub.client(), logger, "404", photoID); err == nil {
+		t.Error("A missing album should be an error")
+	}
+}
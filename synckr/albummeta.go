@@ -0,0 +1,163 @@
+package synckr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// albumMetaFile is the file describing the album of the directory holding it
+const albumMetaFile = "album.yaml"
+
+// Privacy values of an album.yaml
+const (
+	privacyPublic        = "public"
+	privacyPrivate       = "private"
+	privacyFriends       = "friends"
+	privacyFamily        = "family"
+	privacyFriendsFamily = "friends_family"
+)
+
+// albumMeta holds the metadata of an album.yaml. Empty fields keep the defaults
+type albumMeta struct {
+	Title       string
+	Description string
+	Tags        []string
+	Privacy     string
+	// HiddenFromSearch overrides the HiddenFromSearch of the configuration when set
+	HiddenFromSearch *bool
+}
+
+// readAlbumMeta reads the album.yaml of dir. A missing file yields empty metadata
+func readAlbumMeta(config *Config, dir string) (albumMeta, error) {
+	data, err := readLibraryFile(config, filepath.Join(dir, albumMetaFile))
+	if os.IsNotExist(err) {
+		return albumMeta{}, nil
+	}
+	if err != nil {
+		return albumMeta{}, err
+	}
+	return parseAlbumMeta(data)
+}
+
+// parseAlbumMeta parses the small subset of YAML album.yaml files are written in:
+// one "key: value" per line, values optionally quoted, and tags given either as
+// a [flow, list] or as a block of "- item" lines
+func parseAlbumMeta(data []byte) (albumMeta, error) {
+	var meta albumMeta
+	inTags := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if !inTags {
+				return meta, fmt.Errorf("%s line %d: unexpected list item", albumMetaFile, n)
+			}
+			if tag := unquoteYAML(strings.TrimPrefix(line, "-")); tag != "" {
+				meta.Tags = append(meta.Tags, tag)
+			}
+			continue
+		}
+		inTags = false
+
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			return meta, fmt.Errorf("%s line %d: expected \"key: value\"", albumMetaFile, n)
+		}
+		key := strings.TrimSpace(line[:sep])
+		value := strings.TrimSpace(line[sep+1:])
+
+		switch key {
+		case "title":
+			meta.Title = unquoteYAML(value)
+		case "description":
+			meta.Description = unquoteYAML(value)
+		case "privacy":
+			meta.Privacy = strings.ToLower(unquoteYAML(value))
+		case "hidden_from_search":
+			hidden, ok := parseYAMLBool(unquoteYAML(value))
+			if !ok {
+				return meta, fmt.Errorf("%s line %d: hidden_from_search should be true or false", albumMetaFile, n)
+			}
+			meta.HiddenFromSearch = &hidden
+		case "tags":
+			inTags = value == ""
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+			for _, tag := range strings.Split(value, ",") {
+				if tag = unquoteYAML(tag); tag != "" {
+					meta.Tags = append(meta.Tags, tag)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return meta, err
+	}
+
+	switch meta.Privacy {
+	case "", privacyPublic, privacyPrivate, privacyFriends, privacyFamily, privacyFriendsFamily:
+	default:
+		return meta, fmt.Errorf("%s: unknown privacy %q", albumMetaFile, meta.Privacy)
+	}
+	return meta, nil
+}
+
+// unquoteYAML trims a scalar and removes its surrounding quotes
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// parseYAMLBool parses a YAML boolean
+func parseYAMLBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// apply adds the tags, the privacy and the search visibility of the album to
+// upload parameters
+func (meta albumMeta) apply(params *flickr.UploadParams) *flickr.UploadParams {
+	if len(meta.Tags) == 0 && meta.Privacy == "" && meta.HiddenFromSearch == nil {
+		return params
+	}
+
+	var tags []string
+	for _, tag := range meta.Tags {
+		tags = append(tags, sanitizeTag(tag))
+	}
+	params = withTags(params, tags...)
+
+	switch meta.Privacy {
+	case privacyPublic:
+		params.IsPublic = true
+	case privacyFriends:
+		params.IsFriend = true
+	case privacyFamily:
+		params.IsFamily = true
+	case privacyFriendsFamily:
+		params.IsFriend = true
+		params.IsFamily = true
+	}
+	if meta.HiddenFromSearch != nil {
+		params.Hidden = searchVisibility(*meta.HiddenFromSearch)
+	}
+	return params
+}
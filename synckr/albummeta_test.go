@@ -0,0 +1,151 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadAlbumMeta(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected albumMeta
+	}{
+		{"complete", `---
+# Summer holidays
+title: "Summer 2024"
+description: Two weeks in 'Brittany'
+tags:
+  - beach
+  - sea side
+privacy: Friends_Family
+`, albumMeta{"Summer 2024", "Two weeks in 'Brittany'", []string{"beach", "sea side"}, privacyFriendsFamily, nil}},
+		{"partial", "description: 'Only a description'\ntags: [a, \"b c\"]\n", albumMeta{"", "Only a description", []string{"a", "b c"}, "", nil}},
+		{"absent", "", albumMeta{}},
+	}
+
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir("", "synckr")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.content != "" {
+			ioutil.WriteFile(filepath.Join(dir, albumMetaFile), []byte(tt.content), 0644)
+		}
+
+		meta, err := readAlbumMeta(&Config{}, dir)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(meta, tt.expected) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, meta)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestParseAlbumMetaErrors(t *testing.T) {
+	for _, content := range []string{"privacy: everyone", "- orphan item", "no separator"} {
+		if _, err := parseAlbumMeta([]byte(content)); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+}
+
+func TestProcessAlbumMeta(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "summer/a.jpg", "winter/b.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "summer", albumMetaFile),
+		[]byte("title: Summer 2024\ndescription: Holidays\ntags: [beach]\nprivacy: public\n"), 0644)
+
+	config := testConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	summer := stub.set("Summer 2024")
+	if summer == nil || summer.Description != "Holidays" {
+		t.Fatalf("Expected the album to be created from album.yaml, got %+v", summer)
+	}
+	args := stub.photos[summer.Photos[0]].Args
+	if args.Get("tags") != "beach" || args.Get("is_public") != "1" {
+		t.Errorf("Expected the album tags and privacy on the photo, got %v", args)
+	}
+
+	winter := stub.set("winter")
+	if winter == nil || winter.Description != "" || stub.photos[winter.Photos[0]].Args.Get("tags") != "" {
+		t.Errorf("Albums without album.yaml should keep the defaults, got %+v", winter)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("album.yaml should not be uploaded, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestProcessAlbumTags(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "pets/a.jpg", "other/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.AlbumTags = map[string][]string{"pets": {"cats", "Good boys"}}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pets := stub.photos[stub.set("pets").Photos[0]].Args.Get("tags")
+	if !strings.Contains(pets, "cats") || !strings.Contains(pets, `"Good boys"`) {
+		t.Errorf("Expected the album keywords on its photos, got %q", pets)
+	}
+	if other := stub.photos[stub.set("other").Photos[0]].Args.Get("tags"); other != "" {
+		t.Errorf("Photos of other albums should not get the keywords, got %q", other)
+	}
+}
+
+func TestHiddenFromSearch(t *testing.T) {
+	tests := []struct {
+		hidden   bool
+		album    string
+		expected map[string]string
+	}{
+		{false, "", map[string]string{"family": "", "public": ""}},
+		{true, "", map[string]string{"family": "2", "public": "2"}},
+		{true, "hidden_from_search: false\n", map[string]string{"family": "2", "public": "1"}},
+		{false, "hidden_from_search: yes\n", map[string]string{"family": "", "public": "2"}},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "family/a.jpg", "public/b.jpg")
+		if tt.album != "" {
+			ioutil.WriteFile(filepath.Join(root, "public", albumMetaFile), []byte(tt.album), 0644)
+		}
+
+		config := testConfig(root)
+		config.HiddenFromSearch = tt.hidden
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		for album, expected := range tt.expected {
+			args := stub.photos[stub.set(album).Photos[0]].Args
+			if got := args.Get("hidden"); got != expected {
+				t.Errorf("HiddenFromSearch %v, %q: expected hidden=%q for %s, got %q", tt.hidden, tt.album, expected, album, got)
+			}
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+
+	if _, err := parseAlbumMeta([]byte("hidden_from_search: maybe")); err == nil {
+		t.Error("An invalid hidden_from_search should be an error")
+	}
+}
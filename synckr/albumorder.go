@@ -0,0 +1,97 @@
+package synckr
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// orderSets sets the order of the albums of the user, which the flickr library
+// does not implement. Albums missing from orderedIDs are put at the end
+func orderSets(client *flickr.FlickrClient, orderedIDs []string) (*flickr.BasicResponse, error) {
+	client.Init()
+	client.HTTPVerb = "POST"
+	client.Args.Set("method", "flickr.photosets.orderSets")
+	client.Args.Set("photoset_ids", strings.Join(orderedIDs, ","))
+	client.OAuthSign()
+	response := &flickr.BasicResponse{}
+	err := flickr.DoPost(client, response)
+	return response, err
+}
+
+// albumOrder returns the order of the album titles: the previous order without
+// the titles no longer listed, the new titles inserted before the first title
+// sorting after them
+func albumOrder(previous []string, titles []string, less func(a, b string) bool) []string {
+	current := make(map[string]bool)
+	for _, title := range titles {
+		current[title] = true
+	}
+	var order []string
+	known := make(map[string]bool)
+	for _, title := range previous {
+		if current[title] && !known[title] {
+			order = append(order, title)
+			known[title] = true
+		}
+	}
+
+	var added []string
+	for _, title := range titles {
+		if !known[title] {
+			added = append(added, title)
+		}
+	}
+	sort.Slice(added, func(i, j int) bool { return less(added[i], added[j]) })
+	for _, title := range added {
+		i := 0
+		for i < len(order) && !less(title, order[i]) {
+			i++
+		}
+		order = append(order[:i], append([]string{title}, order[i:]...)...)
+	}
+	return order
+}
+
+// orderAlbums orders the albums on flickr by the album order recorded into the
+// upload index, where the new albums are inserted at their sorted position
+func (r *syncRun) orderAlbums() {
+	if r.index == nil {
+		if r.plan == nil {
+			r.log.Warn("[WARNING] preserve_album_order needs a state_file, albums not ordered")
+		}
+		return
+	}
+
+	previous, err := r.index.AlbumOrder()
+	if err != nil {
+		r.log.WithField("error", err).Warn("[WARNING] Could not read the album order, albums not ordered")
+		return
+	}
+	var titles []string
+	for title := range r.fromFlickr {
+		titles = append(titles, title)
+	}
+	order := albumOrder(previous, titles, titleLess(r.config))
+
+	var ids []string
+	for _, title := range order {
+		for _, album := range r.fromFlickr[title] {
+			ids = append(ids, album.ID)
+		}
+	}
+	if resp, err := orderSets(r.client, ids); err != nil {
+		if isAuthError(resp) {
+			r.log.Error(authFailedMessage)
+			return
+		}
+		r.log.WithField("error", err).Error("[ERROR] Could not order albums")
+		return
+	}
+	if err := r.index.SetAlbumOrder(order); err != nil {
+		r.log.WithField("error", err).Warn("[WARNING] Could not record the album order")
+		return
+	}
+	r.log.WithField("albums", len(order)).Info("[OK] Albums ordered")
+}
@@ -0,0 +1,61 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAlbumOrder(t *testing.T) {
+	less := titleLess(&Config{})
+	tests := []struct {
+		previous []string
+		titles   []string
+		expected []string
+	}{
+		{nil, []string{"c", "a", "b"}, []string{"a", "b", "c"}},
+		{[]string{"d", "b"}, []string{"a", "b", "c", "d", "e"}, []string{"a", "c", "d", "b", "e"}},
+		{[]string{"d", "gone", "b"}, []string{"b", "d"}, []string{"d", "b"}},
+	}
+	for _, tt := range tests {
+		if got := albumOrder(tt.previous, tt.titles, less); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%v + %v: expected %v, got %v", tt.previous, tt.titles, tt.expected, got)
+		}
+	}
+}
+
+func TestPreserveAlbumOrder(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("2019", "a")
+	stub.addSet("2017", "b")
+
+	root := makeTree(t, "2017/b.jpg", "2018/c.jpg", "2019/a.jpg", "2020/d.jpg", "2016/e.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.StateFile = filepath.Join(root, "state.json")
+	config.PreserveAlbumOrder = true
+
+	// The albums were put in reverse order by hand
+	index, _ := openJSONIndex(config.StateFile)
+	index.SetAlbumOrder([]string{"2019", "2017"})
+	index.Close()
+
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, set := range stub.sets {
+		order = append(order, set.Title)
+	}
+	expected := []string{"2016", "2018", "2019", "2017", "2020"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected the albums in order %v, got %v", expected, order)
+	}
+	index, _ = openJSONIndex(config.StateFile)
+	if recorded, _ := index.AlbumOrder(); !reflect.DeepEqual(recorded, expected) {
+		t.Errorf("Expected the order %v to be recorded, got %v", expected, recorded)
+	}
+}
@@ -0,0 +1,33 @@
+package synckr
+
+import (
+	"errors"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// invalidAuthTokenErrorCode is returned by flickr when the token was revoked or expired
+const invalidAuthTokenErrorCode = 98
+
+// oauthErrorCode is set by the flickr library when flickr answered an OAuth
+// problem as raw text instead of a REST response
+const oauthErrorCode = -1
+
+// authFailedMessage is logged when a run is aborted by ErrAuthorization
+const authFailedMessage = "[FATAL] authorization failed — re-run to re-authorize"
+
+// ErrAuthorization is returned when flickr rejects the oauth token during a run.
+// Retrying is pointless: the token must be authorized again
+var ErrAuthorization error = &Error{Kind: ErrAuth, Err: errors.New("authorization failed")}
+
+// isAuthError tells whether a flickr response failed because of the oauth token
+func isAuthError(resp flickr.FlickrResponse) bool {
+	switch resp.ErrorCode() {
+	case invalidAuthTokenErrorCode, insufficientPermissionsErrorCode:
+		return true
+	case oauthErrorCode:
+		return strings.Contains(resp.ErrorMsg(), "oauth_problem")
+	}
+	return false
+}
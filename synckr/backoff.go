@@ -0,0 +1,52 @@
+package synckr
+
+import (
+	"io/fs"
+	"math/rand"
+	"time"
+)
+
+// ProcessOptions tune a run beyond its configuration
+type ProcessOptions struct {
+	// Rand is the source of the jitter of the upload retries. A time-seeded
+	// source is used when nil; tests pin it to get reproducible waits
+	Rand rand.Source
+
+	// Ticker paces the summaries logged every SummaryEvery. Tests replace it
+	// with a fake ticker
+	Ticker func(d time.Duration) (<-chan time.Time, func())
+
+	// FS holds the library, rooted at PhotoLibraryPath. The library is walked
+	// and uploaded from the disk when nil. Sidecars, album.yaml and the files
+	// resized or stripped before upload are always read from the disk
+	FS fs.FS
+}
+
+// backoff computes the waits between two upload attempts: UploadInterval, give
+// or take RetryJitter of it
+type backoff struct {
+	interval time.Duration
+	jitter   float64
+	rand     *rand.Rand
+}
+
+func newBackoff(config *Config, src rand.Source) *backoff {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	jitter := config.RetryJitter
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	return &backoff{config.UploadInterval * time.Second, jitter, rand.New(src)}
+}
+
+// delay returns the wait before the next attempt
+func (b *backoff) delay() time.Duration {
+	if b.jitter == 0 {
+		return b.interval
+	}
+	return time.Duration(float64(b.interval) * (1 + b.jitter*(2*b.rand.Float64()-1)))
+}
@@ -0,0 +1,76 @@
+package synckr
+
+import (
+	"math/rand"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func backoffSequence(config *Config, src rand.Source) []time.Duration {
+	b := newBackoff(config, src)
+	var delays []time.Duration
+	for i := 0; i < 5; i++ {
+		delays = append(delays, b.delay())
+	}
+	return delays
+}
+
+func TestBackoffJitter(t *testing.T) {
+	config := Config{UploadInterval: 10, RetryJitter: 0.5}
+
+	first := backoffSequence(&config, rand.NewSource(42))
+	if second := backoffSequence(&config, rand.NewSource(42)); !reflect.DeepEqual(first, second) {
+		t.Errorf("The same seed should give the same waits, got %v and %v", first, second)
+	}
+	if other := backoffSequence(&config, rand.NewSource(7)); reflect.DeepEqual(first, other) {
+		t.Errorf("Another seed should give other waits, got %v", other)
+	}
+	for _, d := range first {
+		if d < 5*time.Second || d > 15*time.Second {
+			t.Errorf("Waits should stay within the jitter, got %v", d)
+		}
+	}
+
+	config.RetryJitter = 0
+	for _, d := range backoffSequence(&config, rand.NewSource(42)) {
+		if d != 10*time.Second {
+			t.Errorf("Without jitter, waits should be UploadInterval, got %v", d)
+		}
+	}
+}
+
+// countingSource is a rand.Source counting its uses
+type countingSource struct {
+	rand.Source
+	calls int
+}
+
+func (s *countingSource) Int63() int64 {
+	s.calls++
+	return s.Source.Int63()
+}
+
+func TestProcessWithOptionsRand(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.hook("upload", func(args url.Values) string {
+		return stubError(105, "Service currently unavailable")
+	})
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UploadAttempts = 3
+	config.RetryJitter = 0.5
+	src := &countingSource{Source: rand.NewSource(1)}
+	if _, err := ProcessWithOptions(&config, stub.client(), nil, ProcessOptions{Rand: src}); err != nil {
+		t.Fatal(err)
+	}
+	if src.calls != 3 {
+		t.Errorf("Each retry should draw its jitter from the given source, got %d draws", src.calls)
+	}
+}
@@ -0,0 +1,75 @@
+package synckr
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/masci/flickr.v2"
+	"gopkg.in/masci/flickr.v2/photos"
+)
+
+// batchMachineTagPrefix starts the machine tag identifying the run which
+// uploaded a photo
+const batchMachineTagPrefix = "synckr:batch="
+
+// searchPerPage is the number of photos requested per page of a machine tag search
+const searchPerPage = 500
+
+// newBatchID returns the identifier of a run: the unix timestamp of its start
+func newBatchID() string {
+	return strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+// batchMachineTag returns the machine tag of the uploads of a batch
+func batchMachineTag(batchID string) string {
+	return batchMachineTagPrefix + batchID
+}
+
+// searchMachineTag requests a page of the photos of the user tagged with a machine tag.
+// flickr.photos.search answers with the same photo list as getNotInSet
+func searchMachineTag(client *flickr.FlickrClient, tag string, page int) (*notInSetResponse, error) {
+	client.Init()
+	client.Args.Set("method", "flickr.photos.search")
+	client.Args.Set("user_id", "me")
+	client.Args.Set("machine_tags", tag)
+	client.Args.Set("page", strconv.Itoa(page))
+	client.Args.Set("per_page", strconv.Itoa(searchPerPage))
+	client.OAuthSign()
+
+	response := &notInSetResponse{}
+	err := flickr.DoGet(client, response)
+	return response, err
+}
+
+// FindBatch returns the photos uploaded by the run identified by batchID
+func FindBatch(client *flickr.FlickrClient, batchID string) ([]FlickrPhoto, error) {
+	var result []FlickrPhoto
+	for page := 1; ; page++ {
+		resp, err := searchMachineTag(client, batchMachineTag(batchID), page)
+		if err != nil {
+			return result, kindError(ErrRetrieve, "find batch", err)
+		}
+		for _, ph := range resp.Photos.Photos {
+			result = append(result, FlickrPhoto{ID: ph.ID, Title: ph.Title})
+		}
+		if len(resp.Photos.Photos) == 0 || resp.Photos.Page >= resp.Photos.Pages {
+			return result, nil
+		}
+	}
+}
+
+// DeleteBatch deletes photos from flickr, typically the ones returned by FindBatch.
+// It stops at the first failure
+func DeleteBatch(client *flickr.FlickrClient, batch []FlickrPhoto) error {
+	for _, ph := range batch {
+		if _, err := photos.Delete(client, ph.ID); err != nil {
+			return err
+		}
+		log.WithFields(logrus.Fields{
+			"photo_id": ph.ID,
+			"title":    ph.Title,
+		}).Info("[DELETE] Photo deleted")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package synckr
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBatchTag(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.BatchTag = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.batchID == "" {
+		t.Fatal("Process should generate a batch id")
+	}
+	for _, ph := range stub.photos {
+		if tags := strings.Fields(ph.Args.Get("tags")); len(tags) != 1 || tags[0] != "synckr:batch="+config.batchID {
+			t.Errorf("%s should be uploaded with the batch tag, got %v", ph.Title, tags)
+		}
+	}
+}
+
+func TestDeleteBatch(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.batchID = "1700000000"
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	stub.addSet("other", "c")
+
+	var query url.Values
+	stub.hook("flickr.photos.search", func(args url.Values) string {
+		query = args
+		return ""
+	})
+
+	batch, err := FindBatch(stub.client(), "1700000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("user_id") != "me" || query.Get("machine_tags") != "synckr:batch=1700000000" || query.Get("per_page") != "500" {
+		t.Errorf("Unexpected search query %v", query)
+	}
+	if len(batch) != 2 {
+		t.Fatalf("Expected the 2 photos of the batch, got %v", batch)
+	}
+
+	if err := DeleteBatch(stub.client(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.photos) != 1 || stub.titles(stub.set("other"))[0] != "c" {
+		t.Errorf("Only the photos of the batch should be deleted, %d photos left", len(stub.photos))
+	}
+}
@@ -0,0 +1,210 @@
+package synckr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultHashConcurrency is the number of files hashed at once when
+// HashConcurrency is not set
+const defaultHashConcurrency = 4
+
+// checksumEntry is the checksum of a file, valid as long as the file keeps its
+// size and modification time
+type checksumEntry struct {
+	Size    int64
+	ModTime time.Time
+	Sum     string
+}
+
+// checksumCache holds the checksums computed by previous runs, by path
+type checksumCache struct {
+	Entries map[string]checksumEntry
+}
+
+// loadChecksumCache reads a cache file. A missing file is an empty cache
+func loadChecksumCache(path string) (checksumCache, error) {
+	cache := checksumCache{Entries: make(map[string]checksumEntry)}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+	err = json.Unmarshal(raw, &cache)
+	if cache.Entries == nil {
+		cache.Entries = make(map[string]checksumEntry)
+	}
+	return cache, err
+}
+
+// saveChecksumCache writes the cache file atomically
+func saveChecksumCache(path string, cache checksumCache) error {
+	raw, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, raw)
+}
+
+// fresh returns the cached checksum of a file, as long as it did not change
+func (c checksumCache) fresh(path string, info os.FileInfo) (string, bool) {
+	entry, ok := c.Entries[path]
+	if ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return entry.Sum, true
+	}
+	return "", false
+}
+
+// put caches the checksum of a file
+func (c checksumCache) put(path string, info os.FileInfo, sum string) {
+	c.Entries[path] = checksumEntry{info.Size(), info.ModTime(), sum}
+}
+
+// computeChecksums returns the hex encoded SHA-256 of the files, hashing up to
+// concurrency files at once. Files which can't be read are logged and omitted
+func computeChecksums(config *Config, paths []string, concurrency int) map[string]string {
+	if concurrency < 1 {
+		concurrency = defaultHashConcurrency
+	}
+
+	jobs := make(chan string)
+	go func() {
+		for _, path := range paths {
+			jobs <- path
+		}
+		close(jobs)
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	result := make(map[string]string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				sum, err := fileChecksum(config, path)
+				if err != nil {
+					log.WithFields(logrus.Fields{
+						"path":  path,
+						"error": err,
+					}).Warn("[WARNING] Could not compute checksum")
+					continue
+				}
+				mu.Lock()
+				result[path] = sum
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+// fileChecksum returns the hex encoded SHA-256 of a file
+func fileChecksum(config *Config, path string) (string, error) {
+	file, err := openLibraryFile(config, path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadChecksums reads ChecksumCacheFile when set, the checksums of the run
+// are otherwise only kept in memory
+func (r *syncRun) loadChecksums() {
+	r.sums = checksumCache{Entries: make(map[string]checksumEntry)}
+	if r.config.ChecksumCacheFile == "" {
+		return
+	}
+	cache, err := loadChecksumCache(r.config.ChecksumCacheFile)
+	if err != nil {
+		r.log.WithFields(logrus.Fields{
+			"checksum_cache_file": r.config.ChecksumCacheFile,
+			"error":               err,
+		}).Warn("[WARNING] Could not read checksum cache, hashing all files")
+	}
+	r.sums = cache
+}
+
+// saveChecksums updates ChecksumCacheFile with the checksums of the run
+func (r *syncRun) saveChecksums() {
+	if r.config.ChecksumCacheFile == "" {
+		return
+	}
+	if err := saveChecksumCache(r.config.ChecksumCacheFile, r.sums); err != nil {
+		r.log.WithFields(logrus.Fields{
+			"checksum_cache_file": r.config.ChecksumCacheFile,
+			"error":               err,
+		}).Warn("[WARNING] Could not update checksum cache")
+	}
+}
+
+// checksum returns the checksum of a file, from the cache as long as the file
+// did not change
+func (r *syncRun) checksum(path string) (string, error) {
+	info, err := statLibraryFile(r.config, path)
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := r.sums.fresh(path, info); ok {
+		return sum, nil
+	}
+	sum, err := fileChecksum(r.config, path)
+	if err == nil {
+		r.sums.put(path, info, sum)
+	}
+	return sum, err
+}
+
+// prehash computes the checksums the files of dir need before their upload,
+// HashConcurrency at once: those of the videos when VideoChecksumTag is set.
+// r.mu is released while hashing
+func (r *syncRun) prehash(dir string) {
+	if !r.config.VideoChecksumTag {
+		return
+	}
+	entries, err := readLibraryDir(r.config, dir)
+	if err != nil {
+		return
+	}
+	infos := make(map[string]os.FileInfo)
+	var stale []string
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !hasAllowedExtension(r.config, path) || !matchesExtension(path, videoExtensions) || isHidden(r.config, path) {
+			continue
+		}
+		if _, ok := r.sums.fresh(path, entry); !ok {
+			infos[path] = entry
+			stale = append(stale, path)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	r.unlock()
+	sums := computeChecksums(r.config, stale, r.config.HashConcurrency)
+	r.lock()
+	for path, sum := range sums {
+		r.sums.put(path, infos[path], sum)
+	}
+}
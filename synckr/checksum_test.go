@@ -0,0 +1,89 @@
+package synckr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestComputeChecksums(t *testing.T) {
+	var files []string
+	for i := 0; i < 50; i++ {
+		files = append(files, fmt.Sprintf("album/%d.jpg", i))
+	}
+	root := makeTree(t, files...)
+	defer os.RemoveAll(root)
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, filepath.Join(root, f))
+	}
+	paths = append(paths, filepath.Join(root, "missing.jpg"))
+
+	serial := computeChecksums(&Config{}, paths, 1)
+	parallel := computeChecksums(&Config{}, paths, 8)
+	if len(serial) != 50 || len(parallel) != 50 {
+		t.Fatalf("Expected 50 checksums, got %d and %d", len(serial), len(parallel))
+	}
+	for path, sum := range serial {
+		if parallel[path] != sum {
+			t.Errorf("%s: checksums differ, %s and %s", path, sum, parallel[path])
+		}
+	}
+	// makeTree writes the relative path as content
+	if serial[paths[0]] == serial[paths[1]] {
+		t.Error("Different files should have different checksums")
+	}
+}
+
+func TestChecksumCache(t *testing.T) {
+	root := makeTree(t, "album/a.mp4", "album/b.mp4")
+	defer os.RemoveAll(root)
+	a := filepath.Join(root, "album", "a.mp4")
+	b := filepath.Join(root, "album", "b.mp4")
+
+	config := videoConfig(root)
+	config.ChecksumCacheFile = filepath.Join(root, "checksums.json")
+	config.HashConcurrency = 2
+	stub := newFlickrStub(t)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	stub.Close()
+
+	// Cached checksums are used as long as the file looks unchanged
+	cache, err := loadChecksumCache(config.ChecksumCacheFile)
+	if err != nil || len(cache.Entries) != 2 {
+		t.Fatalf("Both checksums should be cached, got %v %v", cache.Entries, err)
+	}
+	first := cache.Entries[b].Sum
+	entry := cache.Entries[a]
+	entry.Sum = "cached"
+	cache.Entries[a] = entry
+	saveChecksumCache(config.ChecksumCacheFile, cache)
+
+	// b changed
+	ioutil.WriteFile(b, []byte("changed"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(b, later, later)
+
+	stub = newFlickrStub(t)
+	defer stub.Close()
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	cache, _ = loadChecksumCache(config.ChecksumCacheFile)
+	second := cache.Entries[b].Sum
+	if second == first {
+		t.Error("b changed and should have been hashed again")
+	}
+	for _, ph := range stub.photos {
+		expected := map[string]string{"a": "cached", "b": second}[ph.Title]
+		if ph.machineTags() != checksumMachineTag(expected) {
+			t.Errorf("%s: expected the checksum %s, got the tags %q", ph.Title, expected, ph.machineTags())
+		}
+	}
+}
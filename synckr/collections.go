@@ -0,0 +1,112 @@
+package synckr
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// collectionTreeResponse is the response of flickr.collections.getTree
+type collectionTreeResponse struct {
+	flickr.BasicResponse
+	Collections []struct {
+		ID    string `xml:"id,attr"`
+		Title string `xml:"title,attr"`
+		Sets  []struct {
+			ID string `xml:"id,attr"`
+		} `xml:"set"`
+	} `xml:"collections>collection"`
+}
+
+// createCollectionResponse is the response of flickr.collections.create
+type createCollectionResponse struct {
+	flickr.BasicResponse
+	Collection struct {
+		ID string `xml:"id,attr"`
+	} `xml:"collection"`
+}
+
+// ensureCollection makes sure a collection titled name exists and contains the given
+// albums, along with the albums it already held. It returns the ID of the collection.
+// Creating and editing collections relies on flickr.collections.create and
+// flickr.collections.editSets, which flickr uses but does not document
+func ensureCollection(client *flickr.FlickrClient, name string, albumIDs []string) (string, error) {
+	client.Init()
+	client.Args.Set("method", "flickr.collections.getTree")
+	client.OAuthSign()
+	tree := &collectionTreeResponse{}
+	if err := flickr.DoGet(client, tree); err != nil {
+		return "", err
+	}
+
+	collectionID := ""
+	members := make(map[string]bool)
+	for _, c := range tree.Collections {
+		if c.Title == name {
+			collectionID = c.ID
+			for _, set := range c.Sets {
+				members[set.ID] = true
+			}
+			break
+		}
+	}
+
+	if collectionID == "" {
+		client.Init()
+		client.HTTPVerb = "POST"
+		client.Args.Set("method", "flickr.collections.create")
+		client.Args.Set("title", name)
+		client.OAuthSign()
+		created := &createCollectionResponse{}
+		if err := flickr.DoPost(client, created); err != nil {
+			return "", err
+		}
+		collectionID = created.Collection.ID
+	}
+
+	missing := false
+	for _, id := range albumIDs {
+		if !members[id] {
+			members[id] = true
+			missing = true
+		}
+	}
+	if !missing {
+		return collectionID, nil
+	}
+
+	// editSets replaces the albums of the collection, the existing ones are kept
+	var ids []string
+	for id := range members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	client.Init()
+	client.HTTPVerb = "POST"
+	client.Args.Set("method", "flickr.collections.editSets")
+	client.Args.Set("collection_id", collectionID)
+	client.Args.Set("photoset_ids", strings.Join(ids, ","))
+	client.OAuthSign()
+	if err := flickr.DoPost(client, &flickr.BasicResponse{}); err != nil {
+		return collectionID, err
+	}
+	return collectionID, nil
+}
+
+// collectionName returns the top-level directory of a photo, which names the
+// collection of its album, or an empty string when the photo is not in a subdirectory
+// of a top-level directory
+func collectionName(config *Config, path string) string {
+	rel, err := filepath.Rel(config.PhotoLibraryPath, filepath.Dir(path))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	components := strings.Split(rel, string(filepath.Separator))
+	if len(components) < 2 {
+		return ""
+	}
+	return components[0]
+}
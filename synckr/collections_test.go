@@ -0,0 +1,76 @@
+package synckr
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestEnsureCollection(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	a := stub.addSet("a")
+	b := stub.addSet("b")
+	c := stub.addSet("c")
+	existing := stub.addCollection("existing", a)
+
+	id, err := ensureCollection(stub.client(), "new", []string{b, c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if col := stub.collection("new"); col == nil || col.ID != id || !reflect.DeepEqual(col.Sets, []string{b, c}) {
+		t.Errorf("Expected a new collection holding the albums, got %+v", col)
+	}
+
+	id, err = ensureCollection(stub.client(), "existing", []string{b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := stub.collection("existing")
+	sort.Strings(col.Sets)
+	if id != existing || !reflect.DeepEqual(col.Sets, []string{a, b}) {
+		t.Errorf("Expected the album to be added to the existing collection, got %+v", col)
+	}
+
+	// Nothing to change
+	edits := stub.count("flickr.collections.editSets")
+	if _, err := ensureCollection(stub.client(), "existing", []string{a}); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("flickr.collections.editSets") != edits || stub.count("flickr.collections.create") != 1 {
+		t.Error("A collection already holding the albums should not be edited")
+	}
+}
+
+func TestProcessUseCollections(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	spain := stub.addSet("Spain", "a")
+
+	root := makeTree(t, "2023/Spain/a.jpg", "2023/Italy/b.jpg", "2024/Norway/c.jpg", "loose/d.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UseCollections = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	col2023 := stub.collection("2023")
+	if col2023 == nil {
+		t.Fatal("Expected a collection for 2023")
+	}
+	sort.Strings(col2023.Sets)
+	expected := []string{stub.set("Italy").ID, spain}
+	sort.Strings(expected)
+	if !reflect.DeepEqual(col2023.Sets, expected) {
+		t.Errorf("Expected 2023 to hold Spain and Italy, got %v", col2023.Sets)
+	}
+	if col2024 := stub.collection("2024"); col2024 == nil || !reflect.DeepEqual(col2024.Sets, []string{stub.set("Norway").ID}) {
+		t.Errorf("Expected 2024 to hold Norway, got %+v", col2024)
+	}
+	if stub.collection("loose") != nil {
+		t.Error("Top-level albums should not get a collection")
+	}
+}
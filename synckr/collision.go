@@ -0,0 +1,66 @@
+package synckr
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// suffixedTitle returns the title of the nth file of a directory sharing title,
+// n >= 2: title followed by format, whose {n} token is replaced by n. A format
+// without {n} is repeated once per previous file
+func suffixedTitle(format string, title string, n int) string {
+	if strings.Contains(format, "{n}") {
+		return title + strings.Replace(format, "{n}", strconv.Itoa(n), -1)
+	}
+	return title + strings.Repeat(format, n-1)
+}
+
+// uniqueTitles returns, by file name, the titles of the uploadable files of a
+// directory when DuplicateSuffixFormat is set. The first file of a title, in name
+// order, keeps it and the next ones get a suffixedTitle, skipping the titles of
+// the other files. Titles only depend on the files of the directory, not on what
+// is on flickr already, so that every run computes the same ones
+func (r *syncRun) uniqueTitles(dir string) map[string]string {
+	if titles, ok := r.dirTitles[dir]; ok {
+		return titles
+	}
+
+	titles := make(map[string]string)
+	r.dirTitles[dir] = titles
+	entries, err := readLibraryDir(r.config, dir)
+	if err != nil {
+		return titles
+	}
+
+	var names []string
+	taken := make(map[string]bool)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || !hasAllowedExtension(r.config, path) || isHidden(r.config, path) {
+			continue
+		}
+		names = append(names, entry.Name())
+		titles[entry.Name()] = r.baseTitle(path)
+		taken[titles[entry.Name()]] = true
+	}
+
+	seen := make(map[string]int)
+	for _, name := range names {
+		title := titles[name]
+		seen[title]++
+		if seen[title] == 1 {
+			continue
+		}
+		n := seen[title]
+		unique := suffixedTitle(r.config.DuplicateSuffixFormat, title, n)
+		for taken[unique] {
+			n++
+			unique = suffixedTitle(r.config.DuplicateSuffixFormat, title, n)
+		}
+		seen[title] = n
+		taken[unique] = true
+		titles[name] = unique
+	}
+	return titles
+}
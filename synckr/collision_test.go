@@ -0,0 +1,61 @@
+package synckr
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSuffixedTitle(t *testing.T) {
+	tests := []struct {
+		format   string
+		n        int
+		expected string
+	}{
+		{"_dup{n}", 2, "IMG_1_dup2"},
+		{" #{n}", 3, "IMG_1 #3"},
+		{" (copy)", 2, "IMG_1 (copy)"},
+		{" (copy)", 3, "IMG_1 (copy) (copy)"},
+	}
+	for _, tt := range tests {
+		if got := suffixedTitle(tt.format, "IMG_1", tt.n); got != tt.expected {
+			t.Errorf("%q %d: expected %q, got %q", tt.format, tt.n, tt.expected, got)
+		}
+	}
+}
+
+func TestDuplicateSuffixFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected []string
+	}{
+		{"", []string{"a", "a #2", "b"}},
+		{" (copy)", []string{"a", "a (copy)", "a (copy) (copy)", "a #2", "b"}},
+		{"_dup{n}", []string{"a", "a_dup2", "a_dup3", "a #2", "b"}},
+		// a #2.jpg keeps its own title, the third a takes the next number
+		{" #{n}", []string{"a", "a #3", "a #4", "a #2", "b"}},
+	}
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/a.jpeg", "album/a.jpg", "album/a.png", "album/a #2.jpg", "album/b.jpg")
+		config := testConfig(root)
+		config.DuplicateSuffixFormat = tt.format
+
+		for run := 0; run < 2; run++ {
+			if _, err := Process(&config, stub.client(), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		titles := stub.titles(stub.set("album"))
+		sort.Strings(titles)
+		expected := append([]string(nil), tt.expected...)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(titles, expected) {
+			t.Errorf("%q: expected %v, got %v", tt.format, expected, titles)
+		}
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
@@ -0,0 +1,103 @@
+package synckr
+
+import (
+	"sync"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// walkConcurrently walks each top-level directory of the library in its own
+// goroutine, DirConcurrency at once, so that a slow or failing directory doesn't
+// hold the others back. Files are processed holding r.mu, which is released while
+// uploading: the albums of a directory are still created one after the other.
+// The first error stopping a directory stops the others
+func (r *syncRun) walkConcurrently() error {
+	r.mu = &sync.Mutex{}
+	r.albumLocks = make(map[string]*sync.Mutex)
+	r.createdAlbums = make(map[string]string)
+	defer func() { r.mu = nil }()
+
+	dirs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < r.config.DirConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range dirs {
+				r.stop(r.walkTree(dir, nil))
+			}
+		}()
+	}
+
+	r.stop(r.walkTree(r.config.PhotoLibraryPath, func(dir string) { dirs <- dir }))
+	close(dirs)
+	wg.Wait()
+	return r.stopErr
+}
+
+// stop records the error which stopped the walk of a directory
+func (r *syncRun) stop(err error) {
+	r.lock()
+	defer r.unlock()
+	if r.stopErr == nil {
+		r.stopErr = err
+	}
+}
+
+func (r *syncRun) lock() {
+	if r.mu != nil {
+		r.mu.Lock()
+	}
+}
+
+func (r *syncRun) unlock() {
+	if r.mu != nil {
+		r.mu.Unlock()
+	}
+}
+
+// upload uploads a file, releasing r.mu meanwhile so that the other directories
+// go on. The flickr client holds the arguments of the request being built, each
+// upload needs its own.
+// Directories sharing an album title would both create the missing album: the
+// uploads creating an album hold its lock, the next ones add to the album the
+// first one created
+func (r *syncRun) upload(logger *logrus.Entry, albumID string, albumName string, albumDescription string, path string, params *flickr.UploadParams) (UploadResult, error) {
+	if r.mu == nil {
+		return UploadPhoto(r.client, r.config, logger, albumID, albumName, albumDescription, path, params)
+	}
+
+	if albumID == "" {
+		lock := r.albumLocks[albumName]
+		if lock == nil {
+			lock = &sync.Mutex{}
+			r.albumLocks[albumName] = lock
+		}
+		// The album lock is released once r.mu is held again, so that the
+		// album is recorded before the next upload looks it up
+		r.mu.Unlock()
+		lock.Lock()
+		defer lock.Unlock()
+		r.mu.Lock()
+		albumID = r.createdAlbums[albumName]
+	}
+
+	client := *r.client
+	r.mu.Unlock()
+	result, err := UploadPhoto(&client, r.config, logger, albumID, albumName, albumDescription, path, params)
+	r.mu.Lock()
+	if result.AlbumCreated {
+		r.createdAlbums[albumName] = result.AlbumID
+	}
+	return result, err
+}
+
+// sleep waits between upload attempts, releasing r.mu meanwhile
+func (r *syncRun) sleep(d time.Duration) {
+	r.unlock()
+	defer r.lock()
+	sleep(d)
+}
@@ -0,0 +1,87 @@
+package synckr
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDirConcurrency(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "slow/a.jpg", "slow/b.jpg", "first/c.jpg", "second/d.jpg", "second/e.jpg", "third/f.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.DirConcurrency = 2
+
+	// The first upload waits for the other directories, which would never be
+	// processed if it held them back
+	var uploads int32
+	released := make(chan struct{})
+	stub.hook("upload", func(args url.Values) string {
+		switch atomic.AddInt32(&uploads, 1) {
+		case 1:
+			select {
+			case <-released:
+			case <-time.After(5 * time.Second):
+				t.Error("The other directories should be processed while an upload is running")
+			}
+		case 5:
+			close(released)
+		}
+		return ""
+	})
+
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"slow":   {"a", "b"},
+		"first":  {"c"},
+		"second": {"d", "e"},
+		"third":  {"f"},
+	}
+	for album, titles := range expected {
+		if got := stub.titles(stub.set(album)); !reflect.DeepEqual(got, titles) {
+			t.Errorf("Album %s: expected %v, got %v", album, titles, got)
+		}
+	}
+	if stub.count("flickr.photosets.create") != 4 {
+		t.Errorf("Each album should be created once, got %d creations", stub.count("flickr.photosets.create"))
+	}
+}
+
+func TestDirConcurrencySharedAlbum(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "A/2020/a.jpg", "B/2020/b.jpg", "C/2020/c.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.DirConcurrency = 3
+
+	// Slow uploads let every directory find the album missing
+	stub.hook("upload", func(args url.Values) string {
+		time.Sleep(50 * time.Millisecond)
+		return ""
+	})
+
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("flickr.photosets.create") != 1 {
+		t.Errorf("The shared album should be created once, got %d creations", stub.count("flickr.photosets.create"))
+	}
+	titles := stub.titles(stub.set("2020"))
+	sort.Strings(titles)
+	if !reflect.DeepEqual(titles, []string{"a", "b", "c"}) {
+		t.Errorf("Every photo should be in the shared album, got %v", titles)
+	}
+}
@@ -0,0 +1,149 @@
+package synckr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// AlbumDiff lists the differences between a local directory and its flickr album(s)
+type AlbumDiff struct {
+	// Missing are the paths of the local files not uploaded yet
+	Missing []string
+	// Extra are the titles of the flickr photos without a local file
+	Extra []string
+}
+
+// DiffReport is the result of Diff, indexed by album title
+type DiffReport struct {
+	Albums  map[string]*AlbumDiff
+	Missing int
+	Extra   int
+}
+
+// diffState is what a syncRun computing a Diff records while walking the library
+type diffState struct {
+	report DiffReport
+	// seen are the photo titles found locally, by album title
+	seen map[string]map[string]bool
+	// seenTags are the lowercased path machine tags of the local files
+	seenTags map[string]bool
+}
+
+func newDiffState() *diffState {
+	return &diffState{
+		report:   DiffReport{Albums: make(map[string]*AlbumDiff)},
+		seen:     make(map[string]map[string]bool),
+		seenTags: make(map[string]bool),
+	}
+}
+
+func (d *diffState) album(title string) *AlbumDiff {
+	album, ok := d.report.Albums[title]
+	if !ok {
+		album = &AlbumDiff{}
+		d.report.Albums[title] = album
+	}
+	return album
+}
+
+// see records a local photo
+func (d *diffState) see(album string, title string, tag string) {
+	if d.seen[album] == nil {
+		d.seen[album] = make(map[string]bool)
+	}
+	d.seen[album][title] = true
+	if tag != "" {
+		d.seenTags[strings.ToLower(tag)] = true
+	}
+}
+
+// missing records a local photo which would be uploaded
+func (d *diffState) missing(album string, path string) {
+	a := d.album(album)
+	a.Missing = append(a.Missing, path)
+	d.report.Missing++
+}
+
+// finish lists the flickr photos whose title or path machine tag was not seen
+// locally and returns the report
+func (d *diffState) finish(fromFlickr map[string][]FlickrPhotoset) DiffReport {
+	for title, albums := range fromFlickr {
+		for _, album := range albums {
+			for _, ph := range d.extras(title, album) {
+				a := d.album(title)
+				a.Extra = append(a.Extra, ph.Title)
+				d.report.Extra++
+			}
+		}
+	}
+	return d.report
+}
+
+// extras returns the photos of an album titled title whose title or path
+// machine tag was not seen locally
+func (d *diffState) extras(title string, album FlickrPhotoset) []FlickrPhoto {
+	var result []FlickrPhoto
+	for _, ph := range album.Photos {
+		if tag := ph.taggedPath(); tag != "" && d.seenTags[tag] {
+			continue
+		}
+		// The placeholder of empty albums has no local counterpart
+		if d.seen[title][ph.Title] || ph.Title == placeholderTitle {
+			continue
+		}
+		result = append(result, ph)
+	}
+	return result
+}
+
+// Diff compares the photo library with flickr without uploading nor modifying
+// anything, and reports per album the local files missing from flickr and the
+// flickr photos without a local counterpart
+func Diff(config *Config, client *flickr.FlickrClient) (DiffReport, error) {
+	if _, err := os.Stat(config.PhotoLibraryPath); err != nil {
+		return DiffReport{}, kindError(ErrConfig, "diff", err)
+	}
+
+	// Every album is compared, and none is renamed
+	diffConfig := *config
+	diffConfig.SkipCompleteAlbums = false
+	diffConfig.DetectRenames = false
+
+	fromFlickr, err := retrieveFromFlickr(client, &diffConfig, log)
+	if err != nil {
+		return DiffReport{}, err
+	}
+
+	run := newSyncRun(&diffConfig, client, fromFlickr, log)
+	run.diff = newDiffState()
+	if err := run.walk(); err != nil {
+		return DiffReport{}, err
+	}
+	return run.diff.finish(fromFlickr), nil
+}
+
+// Print writes the report in a human readable form, albums sorted by title
+func (report DiffReport) Print(w io.Writer) {
+	titles := make([]string, 0, len(report.Albums))
+	for title := range report.Albums {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	for _, title := range titles {
+		album := report.Albums[title]
+		fmt.Fprintf(w, "%s: %d missing, %d extra\n", title, len(album.Missing), len(album.Extra))
+		for _, path := range album.Missing {
+			fmt.Fprintf(w, "  missing %s\n", path)
+		}
+		for _, photo := range album.Extra {
+			fmt.Fprintf(w, "  extra   %s\n", photo)
+		}
+	}
+	fmt.Fprintf(w, "%d missing from flickr, %d only on flickr\n", report.Missing, report.Extra)
+}
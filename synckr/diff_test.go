@@ -0,0 +1,84 @@
+package synckr
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a", "b", "gone")
+	stub.addSet("remote", "r")
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg", "new/d.jpg", "new/notes.txt")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.SkipCompleteAlbums = true
+	report, err := Diff(&config, stub.client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 0 || stub.count("flickr.photosets.create") != 0 {
+		t.Error("Diff should not modify flickr")
+	}
+
+	if report.Missing != 2 || report.Extra != 2 {
+		t.Errorf("Expected 2 missing and 2 extra photos, got %d and %d", report.Missing, report.Extra)
+	}
+	album := report.Albums["album"]
+	if album == nil || len(album.Missing) != 1 || !strings.HasSuffix(album.Missing[0], "c.jpg") {
+		t.Errorf("album should miss c.jpg, got %+v", album)
+	} else if len(album.Extra) != 1 || album.Extra[0] != "gone" {
+		t.Errorf("album should have gone as extra photo, got %v", album.Extra)
+	}
+	if added := report.Albums["new"]; added == nil || len(added.Missing) != 1 || len(added.Extra) != 0 {
+		t.Errorf("new should only miss d.jpg, got %+v", added)
+	}
+	if remote := report.Albums["remote"]; remote == nil || len(remote.Missing) != 0 || len(remote.Extra) != 1 {
+		t.Errorf("remote should only have r as extra photo, got %+v", remote)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "album: 1 missing, 1 extra") || !strings.HasSuffix(out.String(), "2 missing from flickr, 2 only on flickr\n") {
+		t.Errorf("Unexpected report:\n%s", out.String())
+	}
+}
+
+func TestDiffRecognizesPathMachineTags(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.PathMachineTag = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The title changed since the upload, the tag still matches the file
+	config.PhotoTitleTemplate = "{dir} {filename}"
+	report, err := Diff(&config, stub.client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Missing != 0 || report.Extra != 0 {
+		t.Errorf("Tagged photo should match its file, got %+v", report.Albums["album"])
+	}
+}
+
+func TestDiffMissingLibrary(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	config := testConfig("/does/not/exist")
+	if _, err := Diff(&config, stub.client()); err == nil {
+		t.Error("Diff should fail when the photo library does not exist")
+	}
+}
@@ -0,0 +1,73 @@
+package synckr
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestDeleteDupesConcurrently(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	for i := 0; i < 20; i++ {
+		stub.addSet(fmt.Sprintf("album%d", i), "a", "a", "a", "b", "c", "c")
+	}
+
+	var mu sync.Mutex
+	deleted := make(map[string]int)
+	stub.hook("flickr.photos.delete", func(args url.Values) string {
+		mu.Lock()
+		deleted[args.Get("photo_id")]++
+		mu.Unlock()
+		return ""
+	})
+
+	config := testConfig("")
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := DeleteDupes(stub.client(), log, &fromFlickr, 8)
+	if len(errs) != 0 {
+		t.Errorf("Expected no deletion error, got %v", errs)
+	}
+
+	if len(deleted) != 60 {
+		t.Errorf("Expected 60 duplicates deleted, got %d", len(deleted))
+	}
+	for id, n := range deleted {
+		if n != 1 {
+			t.Errorf("Photo %s deleted %d times", id, n)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if titles := stub.titles(stub.set(fmt.Sprintf("album%d", i))); len(titles) != 3 {
+			t.Errorf("album%d should keep one photo per title, got %v", i, titles)
+		}
+	}
+}
+
+func TestDeleteDupesCollectsErrors(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a", "a", "b", "b")
+
+	config := testConfig("")
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := fromFlickr["album"][0].Photos[1].ID
+	stub.hook("flickr.photos.delete", func(args url.Values) string {
+		if args.Get("photo_id") == failing {
+			return stubError(99, "Insufficient permissions")
+		}
+		return ""
+	})
+
+	errs := DeleteDupes(stub.client(), log, &fromFlickr, 2)
+	if len(errs) != 1 || errs[failing] == nil {
+		t.Errorf("Expected the error of photo %s only, got %v", failing, errs)
+	}
+}
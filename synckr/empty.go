@@ -0,0 +1,123 @@
+package synckr
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/masci/flickr.v2"
+)
+
+// placeholderTitle is the title of the photo used as the primary photo of the
+// albums created for directories without supported files, since flickr can't
+// create an album without one
+const placeholderTitle = "synckr placeholder"
+
+// placeholderName is the file name of the generated placeholder
+const placeholderName = "synckr-placeholder.png"
+
+// createEmptyAlbums creates an album for each directory encountered by the walk
+// whose album is still missing from flickr, i.e. directories without any supported
+// file. Directories with files already got their album along with their first upload
+func (r *syncRun) createEmptyAlbums() error {
+	if !albumsFollowDirectories(r.config) {
+		return nil
+	}
+	for _, dir := range r.dirs {
+		meta := r.albumMeta(dir)
+		title := albumTitleForDir(r.config, dir)
+		if meta.Title != "" {
+			title = meta.Title
+		}
+		if _, present := r.fromFlickr[title]; present || strings.TrimSpace(title) == "" {
+			continue
+		}
+
+		logger := r.albumLog(title)
+		if r.plan != nil {
+			r.plan.Update("create empty album %s", title)
+			continue
+		}
+
+		var albumID string
+		var err error
+		if r.placeholderID == "" {
+			r.placeholderID = r.findPlaceholder()
+		}
+		if r.placeholderID == "" {
+			var result UploadResult
+			result, err = r.uploadPlaceholder(logger, title, meta.Description)
+			r.placeholderID, albumID = result.PhotoID, result.AlbumID
+		} else {
+			albumID, err = CreateAlbum(r.client, logger, title, meta.Description, r.placeholderID)
+		}
+		if err == ErrAuthorization || err == ErrUploadQuota || errors.Is(err, ErrConfig) {
+			return err
+		}
+		if err != nil || albumID == "" {
+			continue
+		}
+		r.addPhoto(title, albumID, FlickrPhoto{ID: r.placeholderID, Title: placeholderTitle})
+		logger.WithField("path", dir).Info("[OK] Empty album created")
+	}
+	return nil
+}
+
+// findPlaceholder returns the ID of the placeholder photo when an album already
+// holds it
+func (r *syncRun) findPlaceholder() string {
+	for _, albums := range r.fromFlickr {
+		for _, album := range albums {
+			for _, ph := range album.Photos {
+				if ph.Title == placeholderTitle {
+					return ph.ID
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// uploadPlaceholder uploads the placeholder photo into a new album. The placeholder
+// is PlaceholderPhoto when set, a generated single pixel image otherwise. A
+// PlaceholderPhoto which can't be read is an ErrConfig
+func (r *syncRun) uploadPlaceholder(logger *logrus.Entry, title string, description string) (UploadResult, error) {
+	path := r.config.PlaceholderPhoto
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return UploadResult{}, kindError(ErrConfig, "upload placeholder", err)
+		}
+	} else {
+		dir, err := ioutil.TempDir("", "synckr")
+		if err != nil {
+			return UploadResult{}, err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, placeholderName)
+		if err := writePlaceholder(path); err != nil {
+			return UploadResult{}, err
+		}
+	}
+
+	params := flickr.NewUploadParams()
+	params.Title = placeholderTitle
+	return UploadPhoto(r.client, r.config, logger, "", title, description, path, params)
+}
+
+// writePlaceholder writes a single pixel png
+func writePlaceholder(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,79 @@
+package synckr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCreateEmptyAlbums(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "photos/a.jpg", "notes/readme.txt")
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "bare"), 0755)
+
+	config := testConfig(root)
+	config.CreateEmptyAlbums = true
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if titles := stub.titles(stub.set("photos")); !reflect.DeepEqual(titles, []string{"a"}) {
+		t.Errorf("Directories with photos should not get the placeholder, got %v", titles)
+	}
+	for _, title := range []string{"notes", "bare"} {
+		set := stub.set(title)
+		if set == nil {
+			t.Errorf("An album should be created for %s", title)
+			continue
+		}
+		if titles := stub.titles(set); !reflect.DeepEqual(titles, []string{placeholderTitle}) {
+			t.Errorf("%s should only hold the placeholder, got %v", title, titles)
+		}
+	}
+	if stub.count("upload") != 2 || stub.count("flickr.photosets.create") != 3 {
+		t.Errorf("The placeholder should be uploaded once and albums created once, got %d uploads and %d albums",
+			stub.count("upload"), stub.count("flickr.photosets.create"))
+	}
+}
+
+func TestEmptyAlbumsNotCreatedByDefault(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "photos/a.jpg", "notes/readme.txt")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.set("notes") != nil || stub.count("upload") != 1 {
+		t.Errorf("Directories without photos should not get an album, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestCreateEmptyAlbumsError(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "photos/a.jpg")
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "bare"), 0755)
+
+	config := testConfig(root)
+	config.CreateEmptyAlbums = true
+	config.PlaceholderPhoto = filepath.Join(root, "missing.png")
+	if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+		t.Errorf("A placeholder which can't be read should fail the run with an ErrConfig, got %v", err)
+	}
+	if stub.set("bare") != nil {
+		t.Error("No album should be created without placeholder")
+	}
+}
@@ -0,0 +1,50 @@
+package synckr
+
+import "errors"
+
+// The kinds of errors returned by synckr. errors.Is tells which kind an error
+// is, whatever the underlying cause
+var (
+	// ErrConfig is the kind of the errors caused by the configuration
+	ErrConfig = errors.New("configuration error")
+	// ErrAuth is the kind of the errors caused by a missing or rejected oauth token
+	ErrAuth = errors.New("authorization error")
+	// ErrRetrieve is the kind of the errors met while retrieving the albums from flickr
+	ErrRetrieve = errors.New("retrieval error")
+	// ErrUpload is the kind of the errors met while uploading photos
+	ErrUpload = errors.New("upload error")
+)
+
+// Error is an error of a given kind: ErrConfig, ErrAuth, ErrRetrieve or ErrUpload.
+// Op describes what failed, and Err is the cause
+type Error struct {
+	Kind error
+	Op   string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+// Is makes errors.Is match the kind of the error
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// kindError returns err as an error of the given kind, unless it already has one
+func kindError(kind error, op string, err error) error {
+	var typed *Error
+	if err == nil || errors.As(err, &typed) {
+		return err
+	}
+	return &Error{Kind: kind, Op: op, Err: err}
+}
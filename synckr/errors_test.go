@@ -0,0 +1,109 @@
+package synckr
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{ErrAuthorization, ErrAuth},
+		{ErrOAuthTokenRequired, ErrAuth},
+		{ErrNoWritePermission, ErrAuth},
+		{ErrUploadQuota, ErrUpload},
+		{ErrTicketTimeout, ErrUpload},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.kind) {
+			t.Errorf("%v should be a %v", tt.err, tt.kind)
+		}
+		for _, other := range []error{ErrConfig, ErrAuth, ErrRetrieve, ErrUpload} {
+			if other != tt.kind && errors.Is(tt.err, other) {
+				t.Errorf("%v should not be a %v", tt.err, other)
+			}
+		}
+	}
+
+	cause := errors.New("cause")
+	err := kindError(ErrRetrieve, "retrieve", cause)
+	var typed *Error
+	if !errors.Is(err, ErrRetrieve) || !errors.Is(err, cause) || !errors.As(err, &typed) || typed.Op != "retrieve" {
+		t.Errorf("The kind and the cause should both match, got %#v", err)
+	}
+	if err.Error() != "retrieve: cause" {
+		t.Errorf("Unexpected message %q", err.Error())
+	}
+	if kindError(ErrUpload, "upload", ErrAuthorization) != ErrAuthorization {
+		t.Error("Errors which already have a kind should be kept")
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	_, err := LoadConfiguration(filepath.Join(dir, "missing.json"))
+	if !errors.Is(err, ErrConfig) || !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("A missing configuration should be an ErrConfig, got %v", err)
+	}
+	path := filepath.Join(dir, "synckr.conf.json")
+	ioutil.WriteFile(path, []byte(`{"photo_library_path": "/photos"}`), 0644)
+	if _, err := LoadConfiguration(path); !errors.Is(err, ErrConfig) {
+		t.Errorf("A configuration without api key should be an ErrConfig, got %v", err)
+	}
+
+	if _, err := GetClient(&Config{ProxyURL: "ftp://proxy"}); !errors.Is(err, ErrConfig) {
+		t.Errorf("An invalid proxy should be an ErrConfig, got %v", err)
+	}
+	if _, err := GetClient(&Config{NonInteractive: true}); !errors.Is(err, ErrAuth) {
+		t.Errorf("A missing token should be an ErrAuth, got %v", err)
+	}
+
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	for _, root := range []string{"", filepath.Join(dir, "missing")} {
+		config := testConfig(root)
+		if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+			t.Errorf("%q: an invalid photo library should be an ErrConfig, got %v", root, err)
+		}
+	}
+}
+
+func TestProcessErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		code   int
+		kind   error
+	}{
+		{"album list", "flickr.photosets.getList", 105, ErrRetrieve},
+		{"revoked token", "flickr.photosets.getPhotos", invalidAuthTokenErrorCode, ErrAuth},
+		{"quota", "upload", uploadLimitErrorCode, ErrUpload},
+	}
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		stub.addSet("existing", "a")
+		stub.hook(tt.method, func(args url.Values) string {
+			return stubError(tt.code, "failed")
+		})
+		root := makeTree(t, "existing/a.jpg", "one/b.jpg")
+
+		config := testConfig(root)
+		config.UploadAttempts = 1
+		config.RetrieveAttempts = 1
+		_, err := Process(&config, stub.client(), nil)
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected a %v, got %v", tt.name, tt.kind, err)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
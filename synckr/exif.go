@@ -0,0 +1,189 @@
+package synckr
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// EXIF tags read by synckr
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFDPointer   = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// exifDateLayout is the layout of EXIF date fields
+const exifDateLayout = "2006:01:02 15:04:05"
+
+// exifData holds the few EXIF fields synckr cares about
+type exifData struct {
+	// Orientation as defined by the EXIF specification, 1 (normal) to 8
+	Orientation int
+	// DateTaken is the original capture date, or the modification date recorded
+	// by the camera when absent. Zero when unknown
+	DateTaken time.Time
+}
+
+var errNoExif = errors.New("no EXIF data")
+
+// readExif reads the EXIF metadata of a JPEG file
+func readExif(config *Config, path string) (exifData, error) {
+	file, err := openLibraryFile(config, path)
+	if err != nil {
+		return exifData{}, err
+	}
+	defer file.Close()
+
+	segment, err := findExifSegment(bufio.NewReader(file))
+	if err != nil {
+		return exifData{}, err
+	}
+	return parseExif(segment)
+}
+
+// findExifSegment returns the TIFF payload of the APP1 Exif segment of a JPEG stream
+func findExifSegment(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, errNoExif
+	}
+
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return nil, errNoExif
+		}
+		if marker[0] != 0xFF {
+			return nil, errNoExif
+		}
+		// Start of scan: no more metadata segments
+		if marker[1] == 0xDA {
+			return nil, errNoExif
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, errNoExif
+		}
+		if marker[1] != 0xE1 {
+			if _, err := io.CopyN(ioutil.Discard, r, int64(length)); err != nil {
+				return nil, errNoExif
+			}
+			continue
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, errNoExif
+		}
+		if len(payload) > 6 && string(payload[:6]) == "Exif\x00\x00" {
+			return payload[6:], nil
+		}
+	}
+}
+
+// parseExif extracts the known tags from a TIFF structured EXIF payload
+func parseExif(tiff []byte) (exifData, error) {
+	result := exifData{Orientation: 1}
+	if len(tiff) < 8 {
+		return result, errNoExif
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return result, errNoExif
+	}
+
+	ifd0 := readIFD(tiff, order, int(order.Uint32(tiff[4:])))
+	if ifd0 == nil {
+		return result, errNoExif
+	}
+
+	if entry, ok := ifd0[exifTagOrientation]; ok {
+		result.Orientation = int(order.Uint16(entry[8:]))
+	}
+
+	date := exifString(tiff, order, ifd0[exifTagDateTime])
+	if entry, ok := ifd0[exifTagExifIFDPointer]; ok {
+		exifIFD := readIFD(tiff, order, int(order.Uint32(entry[8:])))
+		if original := exifString(tiff, order, exifIFD[exifTagDateTimeOriginal]); original != "" {
+			date = original
+		}
+	}
+	if t, err := time.Parse(exifDateLayout, date); err == nil {
+		result.DateTaken = t
+	}
+
+	return result, nil
+}
+
+// readIFD returns the 12 bytes entries of the IFD at offset, indexed by tag
+func readIFD(tiff []byte, order binary.ByteOrder, offset int) map[uint16][]byte {
+	if offset < 0 || offset+2 > len(tiff) {
+		return nil
+	}
+	entries := make(map[uint16][]byte)
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		entries[order.Uint16(tiff[entry:])] = tiff[entry : entry+12]
+	}
+	return entries
+}
+
+// exifString decodes an ASCII IFD entry
+func exifString(tiff []byte, order binary.ByteOrder, entry []byte) string {
+	if entry == nil || order.Uint16(entry[2:]) != 2 {
+		return ""
+	}
+	count := int(order.Uint32(entry[4:]))
+	value := entry[8:12]
+	if count > 4 {
+		offset := int(order.Uint32(entry[8:]))
+		if offset < 0 || offset+count > len(tiff) {
+			return ""
+		}
+		value = tiff[offset : offset+count]
+	} else {
+		value = value[:count]
+	}
+	return strings.TrimRight(string(value), "\x00 ")
+}
+
+// normalOrientationSegment returns an APP1 Exif segment only holding a normal
+// orientation, for images whose orientation was applied to the pixels
+func normalOrientationSegment() []byte {
+	return orientationSegment(1)
+}
+
+// orientationSegment returns an APP1 Exif segment only holding an orientation
+func orientationSegment(orientation int) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	tiff = append(tiff, 0, 1) // a single IFD0 entry
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry, exifTagOrientation)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], uint16(orientation))
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0) // no next IFD
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
@@ -0,0 +1,141 @@
+package synckr
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultFailuresFile lists the files whose upload failed during the last runs
+const defaultFailuresFile = "failures.json"
+
+// defaultFailureLog records every failed upload, one JSON object per line
+const defaultFailureLog = "failed.jsonl"
+
+// failureRecord is a line of FailureLog
+type failureRecord struct {
+	Path     string    `json:"path"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+}
+
+// appendFailure appends a record to a FailureLog, in a single write so that
+// an interruption can't leave half a line between two records
+func appendFailure(path string, record failureRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(raw, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// recordFailure counts a file whose upload failed after attempts attempts, lists
+// it in the failures to retry and appends it to FailureLog
+func (r *syncRun) recordFailure(logger *logrus.Entry, path string, cause error, attempts int) {
+	failuresTotal.Inc()
+	if r.failures != nil {
+		r.failures[path] = true
+	}
+	if r.config.FailureLog == "" || r.config.DryRun {
+		return
+	}
+	record := failureRecord{Path: path, Error: cause.Error(), Attempts: attempts, Time: time.Now().UTC()}
+	if err := appendFailure(r.config.FailureLog, record); err != nil {
+		logger.WithFields(logrus.Fields{
+			"failure_log": r.config.FailureLog,
+			"error":       err,
+		}).Warn("[WARNING] Could not record the failure")
+	}
+}
+
+// loadFailures reads the paths listed in a failures file. A missing file is an
+// empty list
+func loadFailures(path string) (map[string]bool, error) {
+	failures := make(map[string]bool)
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return failures, nil
+	}
+	if err != nil {
+		return failures, err
+	}
+	var paths []string
+	err = json.Unmarshal(raw, &paths)
+	for _, p := range paths {
+		failures[p] = true
+	}
+	return failures, err
+}
+
+// saveFailures writes the failures file atomically, in path order. The file is
+// removed once no failure is left
+func saveFailures(path string, failures map[string]bool) error {
+	if len(failures) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	raw, err := json.MarshalIndent(sortedPaths(failures), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, raw)
+}
+
+func sortedPaths(set map[string]bool) []string {
+	paths := make([]string, 0, len(set))
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// processTracked processes a file while keeping failures up to date: the file
+// stays listed when its upload fails again, or when the run stops before trying it
+func (r *syncRun) processTracked(path string) error {
+	if r.failures == nil {
+		return r.processFile(path)
+	}
+	listed := r.failures[path]
+	delete(r.failures, path)
+	err := r.processFile(path)
+	if listed && (err == ErrAuthorization || err == errUploadCap || err == errFileLimit) {
+		r.failures[path] = true
+	}
+	return err
+}
+
+// retryFailures only processes the files listed in the failures file, instead
+// of walking the whole library. Files which no longer exist are dropped from the list.
+// It stops at ErrUploadQuota, ErrAuthorization, errUploadCap or errFileLimit
+func (r *syncRun) retryFailures() error {
+	for _, path := range sortedPaths(r.failures) {
+		if _, err := statLibraryFile(r.config, path); err != nil {
+			r.log.WithFields(logrus.Fields{
+				"path":  path,
+				"error": err,
+			}).Warn("[WARNING] Could not access path")
+			delete(r.failures, path)
+			continue
+		}
+		if err := r.processTracked(path); err == ErrUploadQuota || err == ErrAuthorization || err == errUploadCap || err == errFileLimit {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package synckr
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFailuresFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "failures.json")
+
+	failures := map[string]bool{"/photos/b.jpg": true, "/photos/a.jpg": true}
+	if err := saveFailures(path, failures); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadFailures(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, failures) {
+		t.Errorf("Expected %v, got %v", failures, loaded)
+	}
+
+	if err := saveFailures(path, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("The failures file should be removed once no failure is left")
+	}
+	if loaded, err := loadFailures(path); err != nil || len(loaded) != 0 {
+		t.Errorf("A missing failures file should be an empty list, got %v %v", loaded, err)
+	}
+}
+
+func TestRetryFailures(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg", "other/d.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.FailuresFile = filepath.Join(root, "failures.json")
+
+	// The second upload, b.jpg, fails
+	stub.hook("upload", func(args url.Values) string {
+		if stub.count("upload") == 2 {
+			return stubError(1, "Upload failed")
+		}
+		return ""
+	})
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	failures, _ := loadFailures(config.FailuresFile)
+	expected := map[string]bool{filepath.Join(root, "album", "b.jpg"): true}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Fatalf("Expected the failed upload to be recorded, got %v", failures)
+	}
+
+	// A file uploaded since and a removed one are listed along
+	failures[filepath.Join(root, "other", "d.jpg")] = true
+	failures[filepath.Join(root, "album", "gone.jpg")] = true
+	saveFailures(config.FailuresFile, failures)
+	os.Remove(filepath.Join(root, "album", "c.jpg"))
+
+	config.RetryFailures = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 5 {
+		t.Errorf("Only b.jpg should be uploaded again, got %d uploads", stub.count("upload"))
+	}
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, []string{"a", "c", "b"}) {
+		t.Errorf("Unexpected album content %v", titles)
+	}
+	if _, err := os.Stat(config.FailuresFile); !os.IsNotExist(err) {
+		t.Error("The failures file should be removed once every listed file is settled")
+	}
+}
+
+func readFailureLog(t *testing.T, path string) []failureRecord {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []failureRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record failureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid failure log line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestFailureLog(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.FailureLog = filepath.Join(root, "failed.jsonl")
+	config.UploadAttempts = 1
+
+	// a.jpg is uploaded, every attempt of the other files fails
+	stub.hook("upload", func(args url.Values) string {
+		if stub.count("upload") > 1 {
+			return stubError(105, "Service currently unavailable")
+		}
+		return ""
+	})
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readFailureLog(t, config.FailureLog)
+	failed := make(map[string]bool)
+	for _, record := range records {
+		failed[record.Path] = true
+		if record.Attempts != 2 || record.Time.IsZero() {
+			t.Errorf("Unexpected failure record %+v", record)
+		}
+		if !strings.Contains(record.Error, "Service currently unavailable") {
+			t.Errorf("The record should hold the upload error, got %q", record.Error)
+		}
+	}
+	expected := map[string]bool{
+		filepath.Join(root, "album", "b.jpg"): true,
+		filepath.Join(root, "album", "c.jpg"): true,
+	}
+	if len(records) != 2 || !reflect.DeepEqual(failed, expected) {
+		t.Fatalf("Expected b.jpg and c.jpg to be recorded, got %v", records)
+	}
+
+	// The next run appends to the log
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	again := readFailureLog(t, config.FailureLog)
+	if len(again) != 4 || !reflect.DeepEqual(again[:2], records) {
+		t.Errorf("The failures of the second run should be appended, got %v", again)
+	}
+}
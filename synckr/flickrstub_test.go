@@ -0,0 +1,560 @@
+package synckr
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// stubSet is an album held by the flickr stub
+type stubSet struct {
+	ID          string
+	Title       string
+	Description string
+	Photos      []string
+}
+
+// stubCollection is a collection held by the flickr stub
+type stubCollection struct {
+	ID    string
+	Title string
+	Sets  []string
+}
+
+// stubPhoto is a photo held by the flickr stub
+type stubPhoto struct {
+	ID    string
+	Title string
+	Args  url.Values
+}
+
+// machineTags returns the machine tags the photo was uploaded with,
+// lowercased as flickr does
+func (ph *stubPhoto) machineTags() string {
+	var tags []string
+	for _, tag := range strings.Fields(ph.Args.Get("tags")) {
+		if strings.Contains(tag, ":") && strings.Contains(tag, "=") {
+			tags = append(tags, strings.ToLower(tag))
+		}
+	}
+	return strings.Join(tags, " ")
+}
+
+// setArg changes an upload argument of the photo, as the edit methods do
+func (ph *stubPhoto) setArg(key string, value string) {
+	if ph.Args == nil {
+		ph.Args = url.Values{}
+	}
+	ph.Args.Set(key, value)
+}
+
+// flickrStub is a minimal in-memory flickr implementation, serving the
+// REST and upload endpoints used by synckr
+type flickrStub struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu          sync.Mutex
+	sets        []*stubSet
+	collections []*stubCollection
+	photos      map[string]*stubPhoto
+	nextID      int
+	perPage     int
+	calls       map[string]int
+	hooks       map[string]func(args url.Values) string
+	limits      map[string][]string
+}
+
+// newFlickrStub starts a stub server. It must be closed by the caller
+func newFlickrStub(t *testing.T) *flickrStub {
+	stub := &flickrStub{
+		t:       t,
+		photos:  make(map[string]*stubPhoto),
+		nextID:  1000,
+		perPage: 500,
+		calls:   make(map[string]int),
+		hooks:   make(map[string]func(args url.Values) string),
+		limits:  make(map[string][]string),
+	}
+	stub.server = httptest.NewServer(http.HandlerFunc(stub.serve))
+	return stub
+}
+
+// Close stops the stub server
+func (s *flickrStub) Close() {
+	s.server.Close()
+}
+
+// client returns a flickr client whose requests all reach the stub
+func (s *flickrStub) client() *flickr.FlickrClient {
+	u, _ := url.Parse(s.server.URL)
+	client := flickr.NewFlickrClient("key", "secret")
+	client.OAuthToken = "token"
+	client.OAuthTokenSecret = "tokensecret"
+	client.HTTPClient = &http.Client{Transport: flickr.RewriteTransport{URL: u}}
+	return client
+}
+
+// rateLimit answers the next calls to a method with a 429, one per Retry-After
+// value given
+func (s *flickrStub) rateLimit(method string, retryAfter ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits[method] = append(s.limits[method], retryAfter...)
+}
+
+// hook overrides the response for a given method ("upload" for uploads).
+// Returning an empty string falls back to the default behaviour
+func (s *flickrStub) hook(method string, fn func(args url.Values) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks[method] = fn
+}
+
+// count returns how many times a method has been called
+func (s *flickrStub) count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// addSet registers an album containing photos with the given titles and
+// returns its ID
+func (s *flickrStub) addSet(title string, photoTitles ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set := &stubSet{ID: s.newID(), Title: title}
+	for _, pt := range photoTitles {
+		ph := &stubPhoto{ID: s.newID(), Title: pt}
+		s.photos[ph.ID] = ph
+		set.Photos = append(set.Photos, ph.ID)
+	}
+	s.sets = append(s.sets, set)
+	return set.ID
+}
+
+// addPhoto registers a photo which does not belong to any album and returns its ID
+func (s *flickrStub) addPhoto(title string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ph := &stubPhoto{ID: s.newID(), Title: title}
+	s.photos[ph.ID] = ph
+	return ph.ID
+}
+
+// addCollection registers a collection holding the given albums and returns its ID
+func (s *flickrStub) addCollection(title string, setIDs ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &stubCollection{ID: s.newID(), Title: title, Sets: setIDs}
+	s.collections = append(s.collections, c)
+	return c.ID
+}
+
+// collection returns the collection with the given title, nil if absent
+func (s *flickrStub) collection(title string) *stubCollection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.collections {
+		if c.Title == title {
+			return c
+		}
+	}
+	return nil
+}
+
+// set returns the album with the given title, nil if absent
+func (s *flickrStub) set(title string) *stubSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, set := range s.sets {
+		if set.Title == title {
+			return set
+		}
+	}
+	return nil
+}
+
+// titles returns the titles of the photos of an album, in album order
+func (s *flickrStub) titles(set *stubSet) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []string
+	for _, id := range set.Photos {
+		result = append(result, s.photos[id].Title)
+	}
+	return result
+}
+
+func (s *flickrStub) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%d", s.nextID)
+}
+
+func (s *flickrStub) findSet(id string) *stubSet {
+	for _, set := range s.sets {
+		if set.ID == id {
+			return set
+		}
+	}
+	return nil
+}
+
+func (s *flickrStub) serve(w http.ResponseWriter, r *http.Request) {
+	var args url.Values
+	method := "upload"
+	var photoName string
+
+	if r.Method == "POST" {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			s.t.Errorf("stub: cannot parse request: %v", err)
+			return
+		}
+		args = url.Values(r.MultipartForm.Value)
+		if files := r.MultipartForm.File["photo"]; len(files) > 0 {
+			photoName = files[0].Filename
+		}
+	} else {
+		args = r.URL.Query()
+	}
+	if !strings.Contains(r.URL.Path, "upload") {
+		method = args.Get("method")
+	}
+
+	s.mu.Lock()
+	s.calls[method]++
+	hook := s.hooks[method]
+	var retryAfter string
+	if limits := s.limits[method]; len(limits) > 0 {
+		retryAfter, s.limits[method] = limits[0], limits[1:]
+	}
+	s.mu.Unlock()
+
+	if retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	if hook != nil {
+		if body := hook(args); body != "" {
+			fmt.Fprint(w, body)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprint(w, s.respond(method, args, photoName))
+}
+
+// respond computes the default response of a method. s.mu must be held
+func (s *flickrStub) respond(method string, args url.Values, photoName string) string {
+	switch method {
+	case "upload":
+		ph := &stubPhoto{ID: s.newID(), Title: args.Get("title"), Args: args}
+		if ph.Title == "" {
+			ph.Title = strings.TrimSuffix(photoName, filepath.Ext(photoName))
+		}
+		s.photos[ph.ID] = ph
+		return fmt.Sprintf(`<rsp stat="ok"><photoid>%s</photoid></rsp>`, ph.ID)
+
+	case "flickr.photosets.getList":
+		var b strings.Builder
+		fmt.Fprintf(&b, `<rsp stat="ok"><photosets page="1" pages="1" perpage="%d" total="%d">`, len(s.sets), len(s.sets))
+		for _, set := range s.sets {
+			fmt.Fprintf(&b, `<photoset id="%s" photos="%d"><title>%s</title></photoset>`, set.ID, len(set.Photos), html.EscapeString(set.Title))
+		}
+		b.WriteString(`</photosets></rsp>`)
+		return b.String()
+
+	case "flickr.photosets.getPhotos":
+		set := s.findSet(args.Get("photoset_id"))
+		if set == nil {
+			return stubError(1, "Photoset not found")
+		}
+		page := 1
+		fmt.Sscanf(args.Get("page"), "%d", &page)
+		pages := (len(set.Photos) + s.perPage - 1) / s.perPage
+		var b strings.Builder
+		fmt.Fprintf(&b, `<rsp stat="ok"><photoset id="%s" page="%d" pages="%d" perpage="%d" total="%d">`, set.ID, page, pages, s.perPage, len(set.Photos))
+		for i := (page - 1) * s.perPage; i < page*s.perPage && i < len(set.Photos); i++ {
+			ph := s.photos[set.Photos[i]]
+			fmt.Fprintf(&b, `<photo id="%s" title="%s" machine_tags="%s"/>`, ph.ID, html.EscapeString(ph.Title), html.EscapeString(ph.machineTags()))
+		}
+		b.WriteString(`</photoset></rsp>`)
+		return b.String()
+
+	case "flickr.photos.getNotInSet":
+		inSet := make(map[string]bool)
+		for _, set := range s.sets {
+			for _, id := range set.Photos {
+				inSet[id] = true
+			}
+		}
+		var orphans []string
+		for id := range s.photos {
+			if !inSet[id] {
+				orphans = append(orphans, id)
+			}
+		}
+		sort.Strings(orphans)
+		page := 1
+		fmt.Sscanf(args.Get("page"), "%d", &page)
+		pages := (len(orphans) + s.perPage - 1) / s.perPage
+		var b strings.Builder
+		fmt.Fprintf(&b, `<rsp stat="ok"><photos page="%d" pages="%d" perpage="%d" total="%d">`, page, pages, s.perPage, len(orphans))
+		for i := (page - 1) * s.perPage; i < page*s.perPage && i < len(orphans); i++ {
+			ph := s.photos[orphans[i]]
+			fmt.Fprintf(&b, `<photo id="%s" title="%s"/>`, ph.ID, html.EscapeString(ph.Title))
+		}
+		b.WriteString(`</photos></rsp>`)
+		return b.String()
+
+	case "flickr.photosets.create":
+		primary := args.Get("primary_photo_id")
+		if _, ok := s.photos[primary]; !ok {
+			return stubError(2, "Invalid primary photo id")
+		}
+		set := &stubSet{ID: s.newID(), Title: args.Get("title"), Description: args.Get("description"), Photos: []string{primary}}
+		s.sets = append(s.sets, set)
+		return fmt.Sprintf(`<rsp stat="ok"><photoset id="%s" url="https://flickr.com/%s"/></rsp>`, set.ID, set.ID)
+
+	case "flickr.collections.getTree":
+		var b strings.Builder
+		b.WriteString(`<rsp stat="ok"><collections>`)
+		for _, c := range s.collections {
+			fmt.Fprintf(&b, `<collection id="%s" title="%s">`, c.ID, html.EscapeString(c.Title))
+			for _, id := range c.Sets {
+				fmt.Fprintf(&b, `<set id="%s"/>`, id)
+			}
+			b.WriteString(`</collection>`)
+		}
+		b.WriteString(`</collections></rsp>`)
+		return b.String()
+
+	case "flickr.collections.create":
+		c := &stubCollection{ID: s.newID(), Title: args.Get("title")}
+		s.collections = append(s.collections, c)
+		return fmt.Sprintf(`<rsp stat="ok"><collection id="%s"/></rsp>`, c.ID)
+
+	case "flickr.collections.editSets":
+		for _, c := range s.collections {
+			if c.ID == args.Get("collection_id") {
+				c.Sets = strings.Split(args.Get("photoset_ids"), ",")
+				return `<rsp stat="ok"></rsp>`
+			}
+		}
+		return stubError(1, "Collection not found")
+
+	case "flickr.photosets.editMeta":
+		set := s.findSet(args.Get("photoset_id"))
+		if set == nil {
+			return stubError(1, "Photoset not found")
+		}
+		set.Title = args.Get("title")
+		if args.Get("description") != "" {
+			set.Description = args.Get("description")
+		}
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.photosets.orderSets":
+		var ordered []*stubSet
+		listed := make(map[string]bool)
+		for _, id := range strings.Split(args.Get("photoset_ids"), ",") {
+			if set := s.findSet(id); set != nil && !listed[id] {
+				ordered = append(ordered, set)
+				listed[id] = true
+			}
+		}
+		for _, set := range s.sets {
+			if !listed[set.ID] {
+				ordered = append(ordered, set)
+			}
+		}
+		s.sets = ordered
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.photosets.reorderPhotos":
+		set := s.findSet(args.Get("photoset_id"))
+		if set == nil {
+			return stubError(1, "Photoset not found")
+		}
+		ordered := strings.Split(args.Get("photo_ids"), ",")
+		listed := make(map[string]bool)
+		for _, id := range ordered {
+			listed[id] = true
+		}
+		for _, id := range set.Photos {
+			if !listed[id] {
+				ordered = append(ordered, id)
+			}
+		}
+		set.Photos = ordered
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.photosets.addPhoto":
+		set := s.findSet(args.Get("photoset_id"))
+		if set == nil {
+			return stubError(1, "Photoset not found")
+		}
+		if _, ok := s.photos[args.Get("photo_id")]; !ok {
+			return stubError(2, "Photo not found")
+		}
+		for _, id := range set.Photos {
+			if id == args.Get("photo_id") {
+				return stubError(3, "Photo already in set")
+			}
+		}
+		set.Photos = append(set.Photos, args.Get("photo_id"))
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.photosets.delete":
+		for i, set := range s.sets {
+			if set.ID == args.Get("photoset_id") {
+				s.sets = append(s.sets[:i], s.sets[i+1:]...)
+				return `<rsp stat="ok"></rsp>`
+			}
+		}
+		return stubError(1, "Photoset not found")
+
+	case "flickr.photosets.removePhotos":
+		set := s.findSet(args.Get("photoset_id"))
+		if set == nil {
+			return stubError(1, "Photoset not found")
+		}
+		removed := make(map[string]bool)
+		for _, id := range strings.Split(args.Get("photo_ids"), ",") {
+			removed[id] = true
+		}
+		var kept []string
+		for _, id := range set.Photos {
+			if !removed[id] {
+				kept = append(kept, id)
+			}
+		}
+		set.Photos = kept
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.test.login":
+		return `<rsp stat="ok"><user id="12345@N00"><username>synckr</username></user></rsp>`
+
+	case "flickr.auth.oauth.checkToken":
+		return `<rsp stat="ok"><oauth><token>` + args.Get("oauth_token") + `</token><perms>delete</perms></oauth></rsp>`
+
+	case "flickr.photos.setMeta":
+		ph, ok := s.photos[args.Get("photo_id")]
+		if !ok {
+			return stubError(1, "Photo not found")
+		}
+		ph.Title = args.Get("title")
+		ph.setArg("description", args.Get("description"))
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.photos.setTags":
+		ph, ok := s.photos[args.Get("photo_id")]
+		if !ok {
+			return stubError(1, "Photo not found")
+		}
+		ph.setArg("tags", args.Get("tags"))
+		return `<rsp stat="ok"></rsp>`
+
+	case "flickr.photos.getInfo":
+		ph, ok := s.photos[args.Get("photo_id")]
+		if !ok {
+			return stubError(1, "Photo not found")
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, `<rsp stat="ok"><photo id="%s"><title>%s</title><description>%s</description><tags>`,
+			ph.ID, html.EscapeString(ph.Title), html.EscapeString(ph.Args.Get("description")))
+		for _, tag := range strings.Fields(ph.Args.Get("tags")) {
+			machine := 0
+			if strings.Contains(tag, ":") && strings.Contains(tag, "=") {
+				machine = 1
+			}
+			fmt.Fprintf(&b, `<tag raw="%s" machine_tag="%d">%s</tag>`, html.EscapeString(tag), machine, html.EscapeString(strings.ToLower(tag)))
+		}
+		b.WriteString(`</tags></photo></rsp>`)
+		return b.String()
+
+	case "flickr.photos.search":
+		var found []string
+		for id, ph := range s.photos {
+			for _, tag := range strings.Fields(ph.machineTags()) {
+				if tag == strings.ToLower(args.Get("machine_tags")) {
+					found = append(found, id)
+				}
+			}
+		}
+		sort.Strings(found)
+		page := 1
+		fmt.Sscanf(args.Get("page"), "%d", &page)
+		pages := (len(found) + s.perPage - 1) / s.perPage
+		var b strings.Builder
+		fmt.Fprintf(&b, `<rsp stat="ok"><photos page="%d" pages="%d" perpage="%d" total="%d">`, page, pages, s.perPage, len(found))
+		for i := (page - 1) * s.perPage; i < page*s.perPage && i < len(found); i++ {
+			ph := s.photos[found[i]]
+			fmt.Fprintf(&b, `<photo id="%s" title="%s"/>`, ph.ID, html.EscapeString(ph.Title))
+		}
+		b.WriteString(`</photos></rsp>`)
+		return b.String()
+
+	case "flickr.photos.delete":
+		id := args.Get("photo_id")
+		if _, ok := s.photos[id]; !ok {
+			return stubError(1, "Photo not found")
+		}
+		delete(s.photos, id)
+		for _, set := range s.sets {
+			for i, pid := range set.Photos {
+				if pid == id {
+					set.Photos = append(set.Photos[:i], set.Photos[i+1:]...)
+					break
+				}
+			}
+		}
+		return `<rsp stat="ok"></rsp>`
+	}
+
+	return stubError(112, "Method \""+method+"\" not found")
+}
+
+// stubError formats a flickr error response
+func stubError(code int, msg string) string {
+	return fmt.Sprintf(`<rsp stat="fail"><err code="%d" msg="%s"/></rsp>`, code, html.EscapeString(msg))
+}
+
+// testConfig returns a configuration suitable to run Process against the stub
+// without waiting between attempts
+func testConfig(root string) Config {
+	return Config{
+		PhotoLibraryPath: root,
+		Extensions:       []string{".png", ".jpg", ".jpeg"},
+		SkipDirs:         []string{"@eaDir"},
+		LogLevel:         "error",
+	}
+}
+
+// readBody is a small helper returning the body of a GET request
+func readBody(t *testing.T, u string) string {
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
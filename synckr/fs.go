@@ -0,0 +1,143 @@
+package synckr
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// libraryFS returns the file system the library is walked in: the FS of the
+// ProcessOptions when set, PhotoLibraryPath on the disk otherwise. Symlinked
+// directories can only be followed on the disk, nil is then returned
+func libraryFS(config *Config) fs.FS {
+	if config.fsys != nil {
+		return config.fsys
+	}
+	if config.FollowSymlinks {
+		return nil
+	}
+	return os.DirFS(config.PhotoLibraryPath)
+}
+
+// fsPath returns the slash separated path, within the library file system, of
+// a path under PhotoLibraryPath
+func fsPath(config *Config, path string) (string, bool) {
+	rel, err := filepath.Rel(config.PhotoLibraryPath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// openLibraryFile opens a file of the library from the FS of the ProcessOptions
+// when set. Other files, e.g. resized copies, are read from the disk
+func openLibraryFile(config *Config, path string) (fs.File, error) {
+	if name, ok := fsPath(config, path); ok && config.fsys != nil {
+		return config.fsys.Open(name)
+	}
+	return os.Open(path)
+}
+
+// statLibraryFile is os.Stat for the files opened by openLibraryFile
+func statLibraryFile(config *Config, path string) (os.FileInfo, error) {
+	if name, ok := fsPath(config, path); ok && config.fsys != nil {
+		return fs.Stat(config.fsys, name)
+	}
+	return os.Stat(path)
+}
+
+// readLibraryFile is ioutil.ReadFile for the files opened by openLibraryFile
+func readLibraryFile(config *Config, path string) ([]byte, error) {
+	file, err := openLibraryFile(config, path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// readLibraryDir is ioutil.ReadDir for the directories of the library, read from
+// the FS of the ProcessOptions when set
+func readLibraryDir(config *Config, dir string) ([]os.FileInfo, error) {
+	name, ok := fsPath(config, dir)
+	if !ok || config.fsys == nil {
+		return ioutil.ReadDir(dir)
+	}
+	entries, err := fs.ReadDir(config.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// walkLibraryDir is filepath.Walk for the directories of the library, walked in
+// the FS of the ProcessOptions when set
+func walkLibraryDir(config *Config, dir string, fn filepath.WalkFunc) error {
+	if _, ok := fsPath(config, dir); ok && config.fsys != nil {
+		return walkFS(config, config.fsys, dir, fn)
+	}
+	return filepath.Walk(dir, fn)
+}
+
+// walkFS walks the tree rooted at root, a path under PhotoLibraryPath, in the
+// library file system fsys with fs.WalkDir. fn receives the paths under
+// PhotoLibraryPath, like with filepath.Walk
+func walkFS(config *Config, fsys fs.FS, root string, fn filepath.WalkFunc) error {
+	start, ok := fsPath(config, root)
+	if !ok {
+		return fn(root, nil, fmt.Errorf("%s is not in the photo library", root))
+	}
+	if config.NaturalSort || sortsByTime(config) {
+		fsys = sortedFS{fsys, config}
+	}
+
+	return fs.WalkDir(fsys, start, func(name string, d fs.DirEntry, err error) error {
+		path := root
+		if name != start {
+			path = filepath.Join(config.PhotoLibraryPath, filepath.FromSlash(name))
+		}
+		if err != nil {
+			return fn(path, nil, err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fn(path, nil, err)
+		}
+		return fn(path, info, nil)
+	})
+}
+
+// sortedFS lists the entries of its directories in the order of sortEntries
+type sortedFS struct {
+	fs.FS
+	config *Config
+}
+
+func (f sortedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	byName := make(map[string]fs.DirEntry, len(entries))
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		byName[entry.Name()] = entry
+		names[i] = entry.Name()
+	}
+	dir := filepath.Join(f.config.PhotoLibraryPath, filepath.FromSlash(name))
+	sortEntries(f.config, dir, names, func(name string) (os.FileInfo, error) {
+		return byName[name].Info()
+	})
+	for i, name := range names {
+		entries[i] = byName[name]
+	}
+	return entries, err
+}
@@ -0,0 +1,110 @@
+package synckr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestProcessFS(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	fsys := fstest.MapFS{
+		"root.jpg":         {Data: []byte("root")},
+		"album/a.jpg":      {Data: []byte("a")},
+		"album/img10.jpg":  {Data: []byte("img10")},
+		"album/img9.jpg":   {Data: []byte("img9")},
+		"album/notes.txt":  {Data: []byte("notes")},
+		"album/sub/b.png":  {Data: []byte("b")},
+		"@eaDir/thumb.jpg": {Data: []byte("thumb")},
+		"other/c.jpeg":     {Data: []byte("c")},
+		"other/huge.jpg":   {Data: make([]byte, 2048)},
+	}
+	// The library is not on the disk
+	config := testConfig("/nonexistent/library")
+	config.NaturalSort = true
+	config.MaxFileBytes = 1024
+
+	if _, err := ProcessWithOptions(&config, stub.client(), nil, ProcessOptions{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"album": {"a", "img9", "img10"},
+		"sub":   {"b"},
+		"other": {"c"},
+	}
+	for album, titles := range expected {
+		if got := stub.titles(stub.set(album)); !reflect.DeepEqual(got, titles) {
+			t.Errorf("Album %s: expected %v, got %v", album, titles, got)
+		}
+	}
+	if stub.count("upload") != 4 {
+		t.Errorf("Expected 4 uploads, got %d", stub.count("upload"))
+	}
+}
+
+func TestProcessFSSidecars(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	fsys := fstest.MapFS{
+		"summer/album.yaml": {Data: []byte("title: Summer 2024\n")},
+		"summer/a.jpg":      {Data: []byte("a")},
+		"summer/a.jpg.txt":  {Data: []byte("Beach day")},
+		"summer/a.jpg.tags": {Data: []byte("Best of")},
+		"summer/b.jpg":      {Data: []byte("b")},
+		"summer/b.nef":      {Data: []byte("raw")},
+		"scratch/.nomedia":  {Data: []byte{}},
+		"scratch/c.jpg":     {Data: []byte("c")},
+		"winter/d.jpg":      {Data: []byte("d")},
+		"winter/album.yaml": {Data: []byte("description: Snow\n")},
+		"winter/d.jpg.json": {Data: []byte(`{"description": "Skiing"}`)},
+		"winter/d.jpg.tags": {Data: []byte("#pets")},
+	}
+	// Every file is read from the FS, the library is not on the disk
+	config := testConfig("/nonexistent/library")
+	config.HonorNoMedia = true
+	config.RawExtensions = []string{".nef"}
+	config.RawPolicy = RawPolicySkipPairs
+	if _, err := ProcessWithOptions(&config, stub.client(), nil, ProcessOptions{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+
+	summer := stub.set("Summer 2024")
+	if summer == nil || !reflect.DeepEqual(stub.titles(summer), []string{"a"}) {
+		t.Fatalf("Expected the album of album.yaml without the RAW pair, got %+v", summer)
+	}
+	if description := stub.photos[summer.Photos[0]].Args.Get("description"); description != "Beach day" {
+		t.Errorf("Expected the description of the text sidecar, got %q", description)
+	}
+	winter := stub.set("winter")
+	if winter == nil || winter.Description != "Snow" || stub.photos[winter.Photos[0]].Args.Get("description") != "Skiing" {
+		t.Errorf("Expected the descriptions of album.yaml and the JSON sidecar, got %+v", winter)
+	}
+	if stub.set("Best of") == nil || stub.set("pets") == nil {
+		t.Error("Expected the albums of the .tags sidecars")
+	}
+	if stub.set("scratch") != nil {
+		t.Error("The directory holding a .nomedia file should be skipped")
+	}
+}
+
+func TestProcessFSMissingLibrary(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	config := testConfig("/nonexistent/library")
+	_, err := ProcessWithOptions(&config, stub.client(), nil, ProcessOptions{FS: fstest.MapFS{}})
+	if err != nil {
+		t.Fatalf("An empty file system is an empty library, got %v", err)
+	}
+
+	_, err = Process(&config, stub.client(), nil)
+	if !errors.Is(err, ErrConfig) {
+		t.Errorf("Without file system, the library should be read from the disk, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package synckr
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// Default number of seconds before a request to flickr is abandoned
+const (
+	defaultHTTPTimeout   = 30
+	defaultUploadTimeout = 300
+)
+
+// Version is the version of synckr, set when building with
+// -ldflags "-X github.com/koukihai/synckr/synckr.Version=1.2.3"
+var Version = "dev"
+
+// userAgent returns the User-Agent sent to flickr: UserAgent when set, one
+// naming synckr and its version otherwise
+func userAgent(config *Config) string {
+	if config.UserAgent != "" {
+		return config.UserAgent
+	}
+	return fmt.Sprintf("synckr/%s (+github.com/koukihai/synckr)", Version)
+}
+
+// NewHTTPClient returns the http client used to reach flickr, applying the
+// HTTPTimeout of the configuration to API calls and UploadTimeout to uploads.
+// A zero timeout disables the deadline. Requests are sent with the userAgent and
+// rate limited responses fail with a rateLimitError. transport may be nil to use a HTTP/1.1
+// transport, which the flickr upload endpoint requires. That transport goes
+// through ProxyURL when set, or the proxy of HTTP_PROXY and HTTPS_PROXY.
+// Requests meant for flickr are sent to APIEndpoint when set
+func NewHTTPClient(config *Config, transport http.RoundTripper) *http.Client {
+	if transport == nil {
+		proxy := http.ProxyFromEnvironment
+		if u, err := parseProxyURL(config.ProxyURL); err == nil && u != nil {
+			proxy = http.ProxyURL(u)
+		}
+		transport = &http.Transport{
+			Proxy:        proxy,
+			TLSNextProto: make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
+		}
+	}
+	if u, err := parseAPIEndpoint(config.APIEndpoint); err == nil && u != nil {
+		transport = &endpointTransport{transport, u}
+	}
+	return &http.Client{Transport: &timeoutTransport{
+		base:          &retryAfterTransport{&userAgentTransport{transport, userAgent(config)}},
+		timeout:       config.HTTPTimeout * time.Second,
+		uploadTimeout: config.UploadTimeout * time.Second,
+	}}
+}
+
+// parseProxyURL validates a proxy url. An empty url is no proxy
+func parseProxyURL(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy_url %q: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		return nil, fmt.Errorf("invalid proxy_url %q: scheme should be http, https or socks5", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy_url %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// parseAPIEndpoint validates the base url replacing flickr's. An empty url
+// keeps flickr
+func parseAPIEndpoint(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api_endpoint %q: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid api_endpoint %q: scheme should be http or https", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid api_endpoint %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// endpointTransport sends the requests meant for flickr to another base url,
+// their path appended to the one of the base url
+type endpointTransport struct {
+	base     http.RoundTripper
+	endpoint *url.URL
+}
+
+func (t *endpointTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if host != "flickr.com" && !strings.HasSuffix(host, ".flickr.com") {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.endpoint.Scheme
+	req.URL.Host = t.endpoint.Host
+	req.URL.Path = strings.TrimSuffix(t.endpoint.Path, "/") + req.URL.Path
+	req.URL.RawPath = ""
+	req.Host = t.endpoint.Host
+	return t.base.RoundTrip(req)
+}
+
+// timeoutTransport bounds the duration of every request, including the time
+// spent reading the response body. Uploads get their own, usually longer, deadline
+type timeoutTransport struct {
+	base          http.RoundTripper
+	timeout       time.Duration
+	uploadTimeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.timeout
+	if strings.HasPrefix(req.URL.String(), flickr.UPLOAD_ENDPOINT) {
+		timeout = t.uploadTimeout
+	}
+	if timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// userAgentTransport sets the User-Agent header of every request
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// cancelBody releases the deadline of a request once its response is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
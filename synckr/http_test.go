@@ -0,0 +1,167 @@
+package synckr
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+	"gopkg.in/masci/flickr.v2/photosets"
+)
+
+func TestHTTPTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		if strings.HasSuffix(r.URL.Path, "/upload/") {
+			w.Write([]byte(`<rsp stat="ok"><photoid>1</photoid></rsp>`))
+			return
+		}
+		w.Write([]byte(`<rsp stat="ok"><photosets></photosets></rsp>`))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	client := flickr.NewFlickrClient("key", "secret")
+	client.HTTPClient = &http.Client{Transport: &timeoutTransport{
+		base:          flickr.RewriteTransport{URL: u},
+		timeout:       50 * time.Millisecond,
+		uploadTimeout: 5 * time.Second,
+	}}
+
+	start := time.Now()
+	_, err := photosets.GetList(client, true, "", 0)
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("The call should be abandoned after the timeout, took %s", elapsed)
+	}
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+	if _, _, err := uploadFile(client, &Config{}, filepath.Join(root, "album", "a.jpg"), nil); err != nil {
+		t.Errorf("Uploads should use the longer timeout, got %v", err)
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	config := Config{HTTPTimeout: 10, UploadTimeout: 60}
+	transport, ok := NewHTTPClient(&config, nil).Transport.(*timeoutTransport)
+	if !ok {
+		t.Fatal("Expected the requests to be bounded by a timeoutTransport")
+	}
+	if transport.timeout != 10*time.Second || transport.uploadTimeout != 60*time.Second {
+		t.Errorf("Unexpected timeouts %s and %s", transport.timeout, transport.uploadTimeout)
+	}
+}
+
+func TestAPIEndpoint(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/upload/") {
+			w.Write([]byte(`<rsp stat="ok"><photoid>1</photoid></rsp>`))
+			return
+		}
+		w.Write([]byte(`<rsp stat="ok"><photosets></photosets></rsp>`))
+	}))
+	defer server.Close()
+
+	config := Config{APIKey: "key", APISecret: "secret", OAuthToken: "token", OAuthTokenSecret: "token secret", APIEndpoint: server.URL + "/mock/"}
+	client, err := GetClient(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := photosets.GetList(&client, true, "", 0); err != nil {
+		t.Fatal(err)
+	}
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+	if _, _, err := uploadFile(&client, &config, filepath.Join(root, "album", "a.jpg"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/mock/services/rest", "/mock/services/upload/"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("The requests should reach the endpoint, got %v", received)
+	}
+
+	for _, raw := range []string{"localhost:8080", "ftp://mirror", "http://"} {
+		config.APIEndpoint = raw
+		if _, err := GetClient(&config); !errors.Is(err, ErrConfig) || !strings.Contains(err.Error(), "invalid api_endpoint") {
+			t.Errorf("%q should be rejected, got %v", raw, err)
+		}
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Host)
+		w.Write([]byte(`<rsp stat="ok"></rsp>`))
+	}))
+	defer proxy.Close()
+
+	config := Config{APIKey: "key", APISecret: "secret", OAuthToken: "token", OAuthTokenSecret: "token secret", ProxyURL: proxy.URL}
+	client, err := GetClient(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Init()
+	client.EndpointUrl = "http://api.flickr.test/services/rest"
+	client.Args.Set("method", "flickr.test.login")
+	client.OAuthSign()
+	if err := flickr.DoGet(&client, &flickr.BasicResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 1 || proxied[0] != "api.flickr.test" {
+		t.Errorf("The request should go through the proxy, got %v", proxied)
+	}
+
+	for _, raw := range []string{"proxy:8080", "ftp://proxy:21", "http://", "http://proxy:80%"} {
+		config.ProxyURL = raw
+		if _, err := GetClient(&config); err == nil || !strings.Contains(err.Error(), "invalid proxy_url") {
+			t.Errorf("%q should be rejected, got %v", raw, err)
+		}
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("User-Agent"))
+		w.Write([]byte(`<rsp stat="ok"></rsp>`))
+	}))
+	defer server.Close()
+
+	version := Version
+	defer func() { Version = version }()
+	Version = "1.2.3"
+
+	for _, agent := range []string{"", "nas-backup/2.0"} {
+		config := Config{APIKey: "key", APISecret: "secret", OAuthToken: "token", OAuthTokenSecret: "token secret", UserAgent: agent}
+		client, err := GetClient(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Init()
+		client.EndpointUrl = server.URL
+		client.Args.Set("method", "flickr.test.login")
+		client.OAuthSign()
+		if err := flickr.DoGet(&client, &flickr.BasicResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []string{"synckr/1.2.3 (+github.com/koukihai/synckr)", "nas-backup/2.0"}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected the user agents %v, got %v", expected, received)
+	}
+}
@@ -0,0 +1,65 @@
+package synckr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loadIncludeFile reads the files listed in an IncludeFile, one slash separated
+// path relative to PhotoLibraryPath per line, and returns their paths in the
+// library in order. Blank lines and lines starting with # are ignored
+func loadIncludeFile(config *Config, file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rel := path.Clean(filepath.ToSlash(line))
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return nil, fmt.Errorf("%s line %d: %q is not relative to the photo library", file, n, line)
+		}
+		p := filepath.Join(config.PhotoLibraryPath, filepath.FromSlash(rel))
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// uploadIncluded only processes the files listed in the IncludeFile, instead of
+// walking the whole library. Listed files which don't exist are logged.
+// It stops at ErrUploadQuota, ErrAuthorization, errUploadCap or errFileLimit
+func (r *syncRun) uploadIncluded(paths []string) error {
+	for _, path := range paths {
+		if info, err := statLibraryFile(r.config, path); err != nil || info.IsDir() {
+			if err == nil {
+				err = fmt.Errorf("%s is a directory", path)
+			}
+			r.log.WithFields(logrus.Fields{
+				"path":  path,
+				"error": err,
+			}).Warn("[WARNING] Included file not found")
+			continue
+		}
+		if err := r.processTracked(path); err == ErrUploadQuota || err == ErrAuthorization || err == errUploadCap || err == errFileLimit {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package synckr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIncludeFile(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "2019/a.jpg", "2019/b.jpg", "2020/trip/c.jpg", "2020/trip/d.jpg", "2021/e.jpg")
+	defer os.RemoveAll(root)
+
+	include := filepath.Join(root, "include.txt")
+	ioutil.WriteFile(include, []byte("# restore\n2019/a.jpg\n\n2020/trip/d.jpg\n2020/trip/missing.jpg\n2019/a.jpg\n"), 0644)
+	config := testConfig(root)
+	config.IncludeFile = include
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("upload") != 2 {
+		t.Errorf("Only the listed files should be uploaded, got %d uploads", stub.count("upload"))
+	}
+	var albums []string
+	for _, set := range stub.sets {
+		albums = append(albums, set.Title)
+	}
+	sort.Strings(albums)
+	if expected := []string{"2019", "trip"}; !reflect.DeepEqual(albums, expected) {
+		t.Errorf("Albums should still come from the directories, expected %v, got %v", expected, albums)
+	}
+	if titles := stub.titles(stub.set("trip")); !reflect.DeepEqual(titles, []string{"d"}) {
+		t.Errorf("Expected only d in trip, got %v", titles)
+	}
+}
+
+func TestIncludeFileOutsideLibrary(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+
+	include := filepath.Join(root, "include.txt")
+	ioutil.WriteFile(include, []byte("album/a.jpg\n../elsewhere/b.jpg\n"), 0644)
+	config := testConfig(root)
+	config.IncludeFile = include
+	if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+		t.Errorf("Paths outside the library should be rejected, got %v", err)
+	}
+	if stub.count("upload") != 0 {
+		t.Errorf("Nothing should be uploaded from a rejected list, got %d uploads", stub.count("upload"))
+	}
+}
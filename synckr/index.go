@@ -0,0 +1,201 @@
+package synckr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// State backends of the upload index
+const (
+	StateBackendJSON   = "json"
+	StateBackendSQLite = "sqlite"
+)
+
+// indexEntry records the upload of a local file
+type indexEntry struct {
+	Path     string
+	Checksum string
+	PhotoID  string
+	AlbumID  string
+	ModTime  time.Time
+	// Size is 0 in the entries recorded before it was
+	Size int64
+}
+
+// stale tells whether the file changed since it was recorded: its modification
+// time, its size or, when both are unchanged, its checksum differ
+func (e indexEntry) stale(info os.FileInfo, checksum func() (string, error)) bool {
+	if !e.ModTime.Equal(info.ModTime()) || (e.Size != 0 && e.Size != info.Size()) {
+		return true
+	}
+	sum, err := checksum()
+	return err != nil || sum != e.Checksum
+}
+
+// uploadIndex records the uploaded files by path, so that they are recognized
+// without comparing titles. It also records the album order kept with
+// PreserveAlbumOrder
+type uploadIndex interface {
+	Lookup(path string) (indexEntry, bool, error)
+	Put(entry indexEntry) error
+	AlbumOrder() ([]string, error)
+	SetAlbumOrder(titles []string) error
+	Close() error
+}
+
+// checkStateBackend tells whether the index can be stored with StateBackend:
+// the sqlite backend needs synckr built with the sqlite tag
+func checkStateBackend(config *Config) error {
+	switch config.StateBackend {
+	case "", StateBackendJSON:
+		return nil
+	case StateBackendSQLite:
+		if !sqliteLinked() {
+			return errors.New("state_backend sqlite needs synckr built with `go build -tags sqlite`")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown state_backend %q", config.StateBackend)
+}
+
+// openIndex opens the upload index stored in StateFile with StateBackend, json
+// by default
+func openIndex(config *Config) (uploadIndex, error) {
+	switch config.StateBackend {
+	case "", StateBackendJSON:
+		return openJSONIndex(config.StateFile)
+	case StateBackendSQLite:
+		return openSQLiteIndex(config.StateFile)
+	}
+	return nil, fmt.Errorf("unknown state_backend %q", config.StateBackend)
+}
+
+// jsonState is the content of a json StateFile
+type jsonState struct {
+	Entries    map[string]indexEntry
+	AlbumOrder []string `json:",omitempty"`
+}
+
+// jsonIndex keeps the whole index in memory and writes it back on Close
+type jsonIndex struct {
+	path  string
+	state jsonState
+	dirty bool
+}
+
+// openJSONIndex reads a json index. State files written before the album order
+// was recorded hold the entries only
+func openJSONIndex(path string) (*jsonIndex, error) {
+	index := &jsonIndex{path: path, state: jsonState{Entries: make(map[string]indexEntry)}}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state jsonState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, err
+	}
+	if state.Entries == nil {
+		if err := json.Unmarshal(raw, &index.state.Entries); err != nil {
+			return nil, err
+		}
+		return index, nil
+	}
+	index.state = state
+	return index, nil
+}
+
+func (i *jsonIndex) Lookup(path string) (indexEntry, bool, error) {
+	entry, ok := i.state.Entries[path]
+	return entry, ok, nil
+}
+
+func (i *jsonIndex) Put(entry indexEntry) error {
+	i.state.Entries[entry.Path] = entry
+	i.dirty = true
+	return nil
+}
+
+func (i *jsonIndex) AlbumOrder() ([]string, error) {
+	return i.state.AlbumOrder, nil
+}
+
+func (i *jsonIndex) SetAlbumOrder(titles []string) error {
+	i.state.AlbumOrder = titles
+	i.dirty = true
+	return nil
+}
+
+// Close writes the index atomically when it changed
+func (i *jsonIndex) Close() error {
+	if !i.dirty {
+		return nil
+	}
+	raw, err := json.Marshal(i.state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(i.path, raw)
+}
+
+// openIndex opens the index of a run and lists the photos on flickr
+func (r *syncRun) openIndex() error {
+	index, err := openIndex(r.config)
+	if err != nil {
+		return err
+	}
+	r.index = index
+	r.flickrIDs = make(map[string]bool)
+	for _, albums := range r.fromFlickr {
+		for _, album := range albums {
+			for _, ph := range album.Photos {
+				r.flickrIDs[ph.ID] = true
+			}
+		}
+	}
+	return nil
+}
+
+// indexedUpload tells whether the index records the upload of the file, as it
+// is now, of a photo still on flickr
+func (r *syncRun) indexedUpload(path string) bool {
+	if r.index == nil {
+		return false
+	}
+	entry, ok, err := r.index.Lookup(path)
+	if err != nil || !ok || !r.flickrIDs[entry.PhotoID] {
+		return false
+	}
+	info, err := statLibraryFile(r.config, path)
+	return err == nil && !entry.stale(info, func() (string, error) { return r.checksum(path) })
+}
+
+// indexUpload records an upload into the index
+func (r *syncRun) indexUpload(logger *logrus.Entry, path string, result UploadResult) {
+	if r.index == nil {
+		return
+	}
+	r.flickrIDs[result.PhotoID] = true
+	info, err := statLibraryFile(r.config, path)
+	if err == nil {
+		entry := indexEntry{Path: path, PhotoID: result.PhotoID, AlbumID: result.AlbumID, ModTime: info.ModTime(), Size: info.Size()}
+		if entry.Checksum, err = r.checksum(path); err == nil {
+			err = r.index.Put(entry)
+		}
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("[WARNING] Could not record the upload into the index")
+	}
+}
@@ -0,0 +1,122 @@
+package synckr
+
+import (
+	"database/sql"
+	"time"
+)
+
+// sqliteDriver is the database/sql driver of the sqlite backend. It is linked
+// when building with the sqlite tag
+const sqliteDriver = "sqlite3"
+
+// sqliteLinked tells whether the driver of the sqlite backend was linked
+func sqliteLinked() bool {
+	for _, driver := range sql.Drivers() {
+		if driver == sqliteDriver {
+			return true
+		}
+	}
+	return false
+}
+
+// sqliteIndex queries the index from a sqlite database instead of loading it,
+// which large libraries need
+type sqliteIndex struct {
+	db *sql.DB
+}
+
+func openSQLiteIndex(path string) (*sqliteIndex, error) {
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to ":memory:" is a distinct database
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS uploads (
+		path     TEXT PRIMARY KEY,
+		checksum TEXT NOT NULL,
+		photo_id TEXT NOT NULL,
+		album_id TEXT NOT NULL,
+		mod_time INTEGER NOT NULL,
+		size     INTEGER NOT NULL DEFAULT 0
+	)`)
+	if err == nil {
+		// Databases created before the size was recorded lack its column
+		var hasSize int
+		err = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('uploads') WHERE name = 'size'`).Scan(&hasSize)
+		if err == nil && hasSize == 0 {
+			_, err = db.Exec(`ALTER TABLE uploads ADD COLUMN size INTEGER NOT NULL DEFAULT 0`)
+		}
+	}
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS album_order (
+			position INTEGER PRIMARY KEY,
+			title    TEXT NOT NULL
+		)`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteIndex{db}, nil
+}
+
+func (i *sqliteIndex) Lookup(path string) (indexEntry, bool, error) {
+	entry := indexEntry{Path: path}
+	var modTime int64
+	err := i.db.QueryRow(`SELECT checksum, photo_id, album_id, mod_time, size FROM uploads WHERE path = ?`, path).
+		Scan(&entry.Checksum, &entry.PhotoID, &entry.AlbumID, &modTime, &entry.Size)
+	if err == sql.ErrNoRows {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+	entry.ModTime = time.Unix(0, modTime)
+	return entry, true, nil
+}
+
+func (i *sqliteIndex) Put(entry indexEntry) error {
+	_, err := i.db.Exec(`INSERT OR REPLACE INTO uploads (path, checksum, photo_id, album_id, mod_time, size) VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Path, entry.Checksum, entry.PhotoID, entry.AlbumID, entry.ModTime.UnixNano(), entry.Size)
+	return err
+}
+
+func (i *sqliteIndex) AlbumOrder() ([]string, error) {
+	rows, err := i.db.Query(`SELECT title FROM album_order ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var titles []string
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+	return titles, rows.Err()
+}
+
+func (i *sqliteIndex) SetAlbumOrder(titles []string) error {
+	tx, err := i.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM album_order`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for position, title := range titles {
+		if _, err := tx.Exec(`INSERT INTO album_order (position, title) VALUES (?, ?)`, position, title); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (i *sqliteIndex) Close() error {
+	return i.db.Close()
+}
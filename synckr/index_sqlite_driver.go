@@ -0,0 +1,8 @@
+//go:build sqlite
+
+package synckr
+
+import (
+	// Registers the sqlite3 driver used by the sqlite state backend
+	_ "github.com/mattn/go-sqlite3"
+)
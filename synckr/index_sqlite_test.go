@@ -0,0 +1,13 @@
+//go:build sqlite
+
+package synckr
+
+import "testing"
+
+func TestSQLiteIndex(t *testing.T) {
+	index, err := openSQLiteIndex(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIndex(t, index, nil)
+}
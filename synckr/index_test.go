@@ -0,0 +1,193 @@
+package synckr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testIndex exercises insert, lookup and stale detection of an index backend.
+// reopen returns the index as a new run would open it
+func testIndex(t *testing.T, index uploadIndex, reopen func() uploadIndex) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.jpg")
+	ioutil.WriteFile(path, []byte("a"), 0644)
+	info, _ := os.Stat(path)
+
+	if _, ok, err := index.Lookup(path); ok || err != nil {
+		t.Fatalf("An empty index should not hold %s, got %v %v", path, ok, err)
+	}
+	entry := indexEntry{Path: path, Checksum: "sum", PhotoID: "1", AlbumID: "2", ModTime: info.ModTime(), Size: info.Size()}
+	checksum := func(sum string) func() (string, error) {
+		return func() (string, error) { return sum, nil }
+	}
+	if err := index.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.SetAlbumOrder([]string{"b", "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if reopen != nil {
+		if err := index.Close(); err != nil {
+			t.Fatal(err)
+		}
+		index = reopen()
+	}
+	defer index.Close()
+
+	got, ok, err := index.Lookup(path)
+	if err != nil || !ok {
+		t.Fatalf("Expected %s to be found, got %v %v", path, ok, err)
+	}
+	if got.Checksum != "sum" || got.PhotoID != "1" || got.AlbumID != "2" || !got.ModTime.Equal(entry.ModTime) || got.Size != entry.Size {
+		t.Errorf("Expected %v, got %v", entry, got)
+	}
+	if got.stale(info, checksum("sum")) {
+		t.Error("An unchanged file should not be stale")
+	}
+	if !got.stale(info, checksum("other")) {
+		t.Error("A file whose content changed should be stale")
+	}
+	if order, err := index.AlbumOrder(); err != nil || !reflect.DeepEqual(order, []string{"b", "a"}) {
+		t.Errorf("Expected the album order to be kept, got %v %v", order, err)
+	}
+
+	ioutil.WriteFile(path, []byte("ab"), 0644)
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	if resized, _ := os.Stat(path); !got.stale(resized, checksum("sum")) {
+		t.Error("A file whose size changed should be stale")
+	}
+
+	later := info.ModTime().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	info, _ = os.Stat(path)
+	if !got.stale(info, checksum("sum")) {
+		t.Error("A modified file should be stale")
+	}
+}
+
+func TestJSONIndex(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	index, err := openJSONIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIndex(t, index, func() uploadIndex {
+		index, err := openJSONIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	})
+}
+
+func TestLegacyJSONIndex(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	ioutil.WriteFile(path, []byte(`{"/photos/a.jpg":{"Path":"/photos/a.jpg","PhotoID":"1"}}`), 0644)
+
+	index, err := openJSONIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok, _ := index.Lookup("/photos/a.jpg"); !ok || entry.PhotoID != "1" {
+		t.Errorf("State files holding the entries only should still be read, got %v %v", entry, ok)
+	}
+	if order, _ := index.AlbumOrder(); order != nil {
+		t.Errorf("Expected no album order, got %v", order)
+	}
+}
+
+func TestProcessUploadIndex(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.StateFile = filepath.Join(root, "state.json")
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new title template does not make the indexed photo look missing
+	config.PhotoTitleTemplate = "{dir} {filename}"
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 1 {
+		t.Errorf("The indexed photo should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+
+	// Until the file changes
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "album", "a.jpg"), later, later)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("A modified file should be uploaded again, got %d uploads", stub.count("upload"))
+	}
+
+	// Or its content changes without its modification time and size
+	config.PhotoTitleTemplate = "{filename} {dir}"
+	photo := filepath.Join(root, "album", "a.jpg")
+	info, _ := os.Stat(photo)
+	ioutil.WriteFile(photo, []byte("b"+string(make([]byte, info.Size()-1))), 0644)
+	os.Chtimes(photo, info.ModTime(), info.ModTime())
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 3 {
+		t.Errorf("A file whose content changed should be uploaded again, got %d uploads", stub.count("upload"))
+	}
+
+	// Going on without the index would upload everything again
+	ioutil.WriteFile(config.StateFile, []byte("{"), 0644)
+	if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+		t.Errorf("An unreadable state file should fail the run with an ErrConfig, got %v", err)
+	}
+	if stub.count("upload") != 3 {
+		t.Errorf("Nothing should be uploaded without the index, got %d uploads", stub.count("upload"))
+	}
+
+	config.StateBackend = "xml"
+	if _, err := openIndex(&config); err == nil {
+		t.Error("An unknown backend should be an error")
+	}
+}
+
+func TestSQLiteBackendNotLinked(t *testing.T) {
+	if sqliteLinked() {
+		t.Skip("built with the sqlite tag")
+	}
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "synckr.conf.json")
+	ioutil.WriteFile(path, []byte(`{"api_key": "key", "api_secret": "secret", "state_backend": "sqlite"}`), 0644)
+	if _, err := LoadConfiguration(path); !errors.Is(err, ErrConfig) {
+		t.Errorf("The sqlite backend should be rejected without its driver, got %v", err)
+	}
+
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	config := testConfig(root)
+	config.StateFile = filepath.Join(root, "state.db")
+	config.StateBackend = StateBackendSQLite
+	if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+		t.Errorf("Process should not run without the index, got %v", err)
+	}
+	if stub.count("upload") != 0 {
+		t.Errorf("Nothing should be uploaded, got %d uploads", stub.count("upload"))
+	}
+}
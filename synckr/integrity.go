@@ -0,0 +1,24 @@
+package synckr
+
+import (
+	"image"
+)
+
+// verifiableExtensions are the extensions of the files VerifyLocalIntegrity
+// decodes. Other files are uploaded unverified
+var verifiableExtensions = []string{".jpg", ".jpeg", ".png"}
+
+// verifyImage fully decodes an image so that truncated or corrupt files are
+// detected before being uploaded
+func verifyImage(config *Config, path string) error {
+	if !matchesExtension(path, verifiableExtensions) {
+		return nil
+	}
+	file, err := openLibraryFile(config, path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, _, err = image.Decode(file)
+	return err
+}
@@ -0,0 +1,55 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyImage(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid.jpg")
+	writeJPEG(t, valid, 64, 48, 0)
+	if err := verifyImage(&Config{}, valid); err != nil {
+		t.Errorf("A valid JPEG should pass, got %v", err)
+	}
+
+	// A half-copied file keeps a valid header
+	raw, _ := ioutil.ReadFile(valid)
+	truncated := filepath.Join(dir, "truncated.jpg")
+	ioutil.WriteFile(truncated, raw[:len(raw)/2], 0644)
+	if err := verifyImage(&Config{}, truncated); err == nil {
+		t.Error("A truncated JPEG should fail to decode")
+	}
+
+	other := filepath.Join(dir, "clip.mov")
+	ioutil.WriteFile(other, []byte("not decodable"), 0644)
+	if err := verifyImage(&Config{}, other); err != nil {
+		t.Errorf("Files which can't be decoded should not be verified, got %v", err)
+	}
+}
+
+func TestProcessSkipsCorruptImages(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "album"), 0755)
+	writeJPEG(t, filepath.Join(root, "album", "valid.jpg"), 64, 48, 0)
+	raw, _ := ioutil.ReadFile(filepath.Join(root, "album", "valid.jpg"))
+	ioutil.WriteFile(filepath.Join(root, "album", "truncated.jpg"), raw[:len(raw)/2], 0644)
+
+	config := testConfig(root)
+	config.VerifyLocalIntegrity = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, []string{"valid"}) {
+		t.Errorf("Only the valid image should be uploaded, got %v", titles)
+	}
+}
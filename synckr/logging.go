@@ -0,0 +1,33 @@
+package synckr
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConfigureLogging sends the logs of logger, and the ones synckr logs on its
+// own, to LogOutput. When the file can't be opened, e.g. because it's a directory,
+// a warning is logged and the logs go to stderr; the error is returned.
+// An empty LogOutput logs to stderr
+func ConfigureLogging(config *Config, logger *logrus.Logger) error {
+	if config.LogOutput == "" {
+		logger.Out = os.Stderr
+		log.Out = os.Stderr
+		return nil
+	}
+
+	file, err := os.OpenFile(config.LogOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		logger.Out = os.Stderr
+		log.Out = os.Stderr
+		logger.WithFields(logrus.Fields{
+			"log_output": config.LogOutput,
+			"error":      err,
+		}).Warn("[WARNING] Could not open log file, logging to stderr")
+		return err
+	}
+	logger.Out = file
+	log.Out = file
+	return nil
+}
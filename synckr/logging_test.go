@@ -0,0 +1,62 @@
+package synckr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestConfigureLogging(t *testing.T) {
+	defer func() { log.Out = os.Stderr }()
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	logger := logrus.New()
+	config := Config{LogOutput: filepath.Join(dir, "synckr.log")}
+	if err := ConfigureLogging(&config, logger); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("to the file")
+	log.Error("from synckr")
+	logger.Out.(*os.File).Close()
+	raw, _ := ioutil.ReadFile(config.LogOutput)
+	if !strings.Contains(string(raw), "to the file") || !strings.Contains(string(raw), "from synckr") {
+		t.Errorf("Both loggers should write to the log file, got %q", raw)
+	}
+
+	// A directory can't be opened as a log file
+	config.LogOutput = dir
+	if err := ConfigureLogging(&config, logger); err == nil {
+		t.Error("The error should be returned")
+	}
+	if logger.Out != os.Stderr || log.Out != os.Stderr {
+		t.Error("Logs should fall back to stderr")
+	}
+
+	// The fallback is warned about
+	var out bytes.Buffer
+	logger.Hooks.Add(copyHook{&out})
+	ConfigureLogging(&config, logger)
+	if !strings.Contains(out.String(), "Could not open log file") {
+		t.Errorf("A warning should be logged, got %q", out.String())
+	}
+}
+
+// copyHook copies the messages of a logger whose output can't be captured
+type copyHook struct {
+	out *bytes.Buffer
+}
+
+func (h copyHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h copyHook) Fire(entry *logrus.Entry) error {
+	h.out.WriteString(entry.Message + "\n")
+	return nil
+}
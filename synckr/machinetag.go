@@ -0,0 +1,72 @@
+package synckr
+
+import (
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// pathMachineTagPrefix starts the machine tag recording the path of an upload
+// relative to PhotoLibraryPath
+const pathMachineTagPrefix = "synckr:path="
+
+// photosetPhotosResponse is the response of flickr.photosets.getPhotos along with
+// the machine tags of the photos, which the flickr library does not request
+type photosetPhotosResponse struct {
+	flickr.BasicResponse
+	Photoset struct {
+		Page   int `xml:"page,attr"`
+		Pages  int `xml:"pages,attr"`
+		Total  int `xml:"total,attr"`
+		Photos []struct {
+			Id          string `xml:"id,attr"`
+			Title       string `xml:"title,attr"`
+			MachineTags string `xml:"machine_tags,attr"`
+		} `xml:"photo"`
+	} `xml:"photoset"`
+}
+
+func getPhotosetPhotos(client *flickr.FlickrClient, photosetID string, page int) (*photosetPhotosResponse, error) {
+	client.Init()
+	client.Args.Set("method", "flickr.photosets.getPhotos")
+	client.Args.Set("photoset_id", photosetID)
+	client.Args.Set("extras", "machine_tags")
+	if page > 1 {
+		client.Args.Set("page", strconv.Itoa(page))
+	}
+	client.OAuthSign()
+
+	response := &photosetPhotosResponse{}
+	err := flickr.DoGet(client, response)
+	return response, err
+}
+
+// pathMachineTag returns the machine tag identifying a local file, or an empty
+// string for files outside the library. The path is escaped so that the tag holds
+// no space and survives flickr lowercasing it
+func pathMachineTag(config *Config, path string) string {
+	rel, err := filepath.Rel(config.PhotoLibraryPath, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return pathMachineTagPrefix + (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath()
+}
+
+// parseMachineTags splits the space separated machine tags returned by flickr
+func parseMachineTags(tags string) []string {
+	return strings.Fields(tags)
+}
+
+// taggedPath returns the lowercased path machine tag of a photo, empty when
+// the photo was not uploaded with one
+func (ph FlickrPhoto) taggedPath() string {
+	for _, tag := range ph.Tags {
+		if strings.HasPrefix(strings.ToLower(tag), pathMachineTagPrefix) {
+			return strings.ToLower(tag)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package synckr
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// photoMeta holds the metadata of a file listed in MetadataCSV. Empty fields
+// keep the defaults
+type photoMeta struct {
+	Title       string
+	Description string
+	Tags        []string
+}
+
+// errNoPathColumn is returned for a MetadataCSV without path nor filename column
+var errNoPathColumn = errors.New("metadata csv has no path or filename column")
+
+// readMetadataCSV reads a csv whose header names its columns: path (or filename),
+// title, description and tags. Tags are comma separated.
+// Rows are keyed by the slash separated path relative to PhotoLibraryPath, or by
+// the bare filename
+func readMetadataCSV(path string) (map[string]photoMeta, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseMetadataCSV(file)
+}
+
+func parseMetadataCSV(r io.Reader) (map[string]photoMeta, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	key, ok := columns["path"]
+	if !ok {
+		if key, ok = columns["filename"]; !ok {
+			return nil, errNoPathColumn
+		}
+	}
+
+	result := make(map[string]photoMeta)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+		field := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		meta := photoMeta{
+			Title:       field("title"),
+			Description: field("description"),
+		}
+		for _, tag := range strings.Split(field("tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				meta.Tags = append(meta.Tags, tag)
+			}
+		}
+		if key < len(record) && strings.TrimSpace(record[key]) != "" {
+			result[filepath.ToSlash(strings.TrimSpace(record[key]))] = meta
+		}
+	}
+}
+
+// lookupPhotoMeta returns the row of a file, looked up by relative path first
+func lookupPhotoMeta(config *Config, metas map[string]photoMeta, path string) (photoMeta, bool) {
+	if rel, err := filepath.Rel(config.PhotoLibraryPath, path); err == nil {
+		if meta, ok := metas[filepath.ToSlash(rel)]; ok {
+			return meta, true
+		}
+	}
+	meta, ok := metas[filepath.Base(path)]
+	return meta, ok
+}
+
+// apply sets the title and the description of the photo to upload parameters
+// and adds its tags
+func (meta photoMeta) apply(params *flickr.UploadParams) *flickr.UploadParams {
+	if meta.Title == "" && meta.Description == "" && len(meta.Tags) == 0 {
+		return params
+	}
+
+	params = withTags(params, sanitizeTags(meta.Tags)...)
+	if meta.Title != "" {
+		params.Title = meta.Title
+	}
+	if meta.Description != "" {
+		params.Description = meta.Description
+	}
+	return params
+}
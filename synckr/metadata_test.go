@@ -0,0 +1,89 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleMetadataCSV = `Path,Title,Tags,Description
+2024/trip/a.jpg,Sunrise,"beach, summer holidays",First morning
+b.jpg,Sunset,,
+c.jpg,,night,
+`
+
+func TestParseMetadataCSV(t *testing.T) {
+	metas, err := parseMetadataCSV(strings.NewReader(sampleMetadataCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]photoMeta{
+		"2024/trip/a.jpg": {"Sunrise", "First morning", []string{"beach", "summer holidays"}},
+		"b.jpg":           {Title: "Sunset"},
+		"c.jpg":           {Tags: []string{"night"}},
+	}
+	if !reflect.DeepEqual(metas, expected) {
+		t.Errorf("Expected %v, got %v", expected, metas)
+	}
+
+	if _, err := parseMetadataCSV(strings.NewReader("title,tags\na,b\n")); err != errNoPathColumn {
+		t.Errorf("Expected errNoPathColumn, got %v", err)
+	}
+}
+
+func TestPhotoMetaApply(t *testing.T) {
+	metas, _ := parseMetadataCSV(strings.NewReader(sampleMetadataCSV))
+	config := Config{PhotoLibraryPath: "/photos", TagFromPath: true}
+
+	meta, ok := lookupPhotoMeta(&config, metas, "/photos/2024/trip/a.jpg")
+	if !ok {
+		t.Fatal("a.jpg should be found by its relative path")
+	}
+	params := meta.apply(buildUploadParams(&config, "/photos/2024/trip/a.jpg"))
+	if params.Title != "Sunrise" || params.Description != "First morning" {
+		t.Errorf("Unexpected title and description %q %q", params.Title, params.Description)
+	}
+	if !reflect.DeepEqual(params.Tags, []string{"2024", "trip", "beach", "\"summer holidays\""}) {
+		t.Errorf("Unexpected tags %v", params.Tags)
+	}
+
+	// Rows keyed by filename match in any directory
+	if meta, ok := lookupPhotoMeta(&config, metas, "/photos/other/b.jpg"); !ok || meta.Title != "Sunset" {
+		t.Errorf("b.jpg should be found by its filename, got %v", meta)
+	}
+
+	// Files without a row keep the defaults
+	config.TagFromPath = false
+	meta, ok = lookupPhotoMeta(&config, metas, "/photos/d.jpg")
+	if params := meta.apply(buildUploadParams(&config, "/photos/d.jpg")); ok || params != nil {
+		t.Errorf("Files missing from the csv should keep the default params, got %v", params)
+	}
+}
+
+func TestProcessMetadataCSV(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/b.jpg", "album/d.jpg")
+	defer os.RemoveAll(root)
+	csvPath := filepath.Join(root, "metadata.csv")
+	ioutil.WriteFile(csvPath, []byte(sampleMetadataCSV), 0644)
+
+	config := testConfig(root)
+	config.MetadataCSV = csvPath
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, []string{"Sunset", "d"}) {
+		t.Errorf("The csv title should override the filename, got %v", titles)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("Photos titled from the csv should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+}
@@ -0,0 +1,215 @@
+package synckr
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics exposed in the prometheus text format when Config.MetricsAddr is set
+var (
+	uploadsTotal       = newCounter("synckr_uploads_total", "Number of photos successfully uploaded to flickr.")
+	failuresTotal      = newCounter("synckr_failures_total", "Number of photos which could not be uploaded after all attempts.")
+	skippedTotal       = newCounter("synckr_skipped_total", "Number of local files skipped.")
+	skipReasonsTotal   = newCounterVec("synckr_skips_total", "Number of skips, by reason.", "reason")
+	bytesUploadedTotal = newCounter("synckr_uploaded_bytes_total", "Size of the photos successfully uploaded to flickr.")
+	retrieveDuration   = newHistogram("synckr_retrieve_duration_seconds", "Time spent retrieving albums from flickr.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600})
+	queueDepth = newGauge("synckr_queue_depth", "Number of new or changed files Watch is waiting to upload.")
+)
+
+// metric is implemented by every metric exposed on the metrics endpoint
+type metric interface {
+	write(w io.Writer)
+}
+
+var metricsRegistry []metric
+
+// counter is a monotonically increasing value
+type counter struct {
+	name  string
+	help  string
+	value uint64
+}
+
+func newCounter(name string, help string) *counter {
+	c := &counter{name: name, help: help}
+	metricsRegistry = append(metricsRegistry, c)
+	return c
+}
+
+// Inc increments the counter by one
+func (c *counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add increments the counter by n
+func (c *counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns the current value of the counter
+func (c *counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *counter) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.Value())
+}
+
+// gauge is a value which can go up and down
+type gauge struct {
+	name  string
+	help  string
+	value int64
+}
+
+func newGauge(name string, help string) *gauge {
+	g := &gauge{name: name, help: help}
+	metricsRegistry = append(metricsRegistry, g)
+	return g
+}
+
+// Set sets the gauge to n
+func (g *gauge) Set(n int64) {
+	atomic.StoreInt64(&g.value, n)
+}
+
+// Value returns the current value of the gauge
+func (g *gauge) Value() int64 {
+	return atomic.LoadInt64(&g.value)
+}
+
+func (g *gauge) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, g.Value())
+}
+
+// counterVec is a set of counters told apart by the value of a label
+type counterVec struct {
+	name  string
+	help  string
+	label string
+
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name string, help string, label string) *counterVec {
+	c := &counterVec{name: name, help: help, label: label, values: make(map[string]uint64)}
+	metricsRegistry = append(metricsRegistry, c)
+	return c
+}
+
+// Inc increments the counter of a label value by one
+func (c *counterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[value]++
+}
+
+// Values returns a copy of the current value of each counter
+func (c *counterVec) Values() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make(map[string]uint64, len(c.values))
+	for k, v := range c.values {
+		values[k] = v
+	}
+	return values
+}
+
+func (c *counterVec) write(w io.Writer) {
+	values := c.Values()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", c.name, c.label, k, values[k])
+	}
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name string, help string, buckets []float64) *histogram {
+	h := &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	metricsRegistry = append(metricsRegistry, h)
+	return h
+}
+
+// Observe records a duration in the histogram
+func (h *histogram) Observe(d time.Duration) {
+	v := d.Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(b), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatFloat(h.sum), h.name, h.count)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// MetricsHandler serves all synckr metrics in the prometheus text format
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, m := range metricsRegistry {
+			m.write(w)
+		}
+	})
+}
+
+// ServeMetrics exposes the metrics on /metrics at the given address.
+// The server runs in the background until the returned listener is closed
+func ServeMetrics(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	go http.Serve(listener, mux)
+
+	log.WithField("addr", listener.Addr().String()).Info("[OK] Serving metrics")
+	return listener, nil
+}
@@ -0,0 +1,108 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// metricValue extracts the value of a metric from a prometheus text output
+func metricValue(body string, name string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimPrefix(line, name+" ")
+		}
+	}
+	return ""
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "existing")
+
+	root := makeTree(t, "root.jpg", "album/existing.jpg", "album/new.jpg", "album/notes.txt", "other/photo.png")
+	defer os.RemoveAll(root)
+
+	listener, err := ServeMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	uploads, failures, skipped := uploadsTotal.Value(), failuresTotal.Value(), skippedTotal.Value()
+
+	config := testConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	body := readBody(t, "http://"+listener.Addr().String()+"/metrics")
+
+	expected := map[string]uint64{
+		"synckr_uploads_total":  uploads + 2,
+		"synckr_failures_total": failures,
+		"synckr_skipped_total":  skipped + 3,
+	}
+	for name, value := range expected {
+		if got := metricValue(body, name); got != strconv.FormatUint(value, 10) {
+			t.Errorf("%s: expected %d, got %q", name, value, got)
+		}
+	}
+	if metricValue(body, "synckr_retrieve_duration_seconds_count") == "0" {
+		t.Error("Retrieve duration should have been observed")
+	}
+}
+
+func TestMetricsQueueDepth(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/existing.jpg")
+	defer os.RemoveAll(root)
+
+	listener, err := ServeMetrics("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	endpoint := "http://" + listener.Addr().String() + "/metrics"
+
+	config := testConfig(root)
+	client := stub.client()
+	fromFlickr, err := Process(&config, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, finish, err := newWatch(&config, client, fromFlickr, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer finish()
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if err := ioutil.WriteFile(filepath.Join(root, "album", name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// New files wait in the queue until they settle on the next scan
+	if err := w.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := metricValue(readBody(t, endpoint), "synckr_queue_depth"); got != "2" {
+		t.Errorf("Expected 2 files queued, got %q", got)
+	}
+	if err := w.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := metricValue(readBody(t, endpoint), "synckr_queue_depth"); got != "0" {
+		t.Errorf("Expected the queue to be empty once the files were uploaded, got %q", got)
+	}
+	if stub.count("upload") != 3 {
+		t.Errorf("Expected the queued files to be uploaded, got %d uploads", stub.count("upload"))
+	}
+}
@@ -0,0 +1,152 @@
+package synckr
+
+import (
+	"sort"
+
+	"gopkg.in/masci/flickr.v2/photosets"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sync modes of the albums listed in AlbumSyncMode
+const (
+	// AlbumSyncModeAppend uploads the local photos missing from the album. This is the default
+	AlbumSyncModeAppend = "append"
+	// AlbumSyncModeMirror also removes from the album the photos without a local file
+	AlbumSyncModeMirror = "mirror"
+)
+
+// defaultMirrorMaxRemovals is the number of photos a mirrored album may lose
+// during a run when MirrorMaxRemovals is not set
+const defaultMirrorMaxRemovals = 20
+
+// isMirrored tells whether the album titled title is mirrored
+func isMirrored(config *Config, title string) bool {
+	return config.AlbumSyncMode[title] == AlbumSyncModeMirror
+}
+
+// pruneMirroredAlbums removes from the mirrored albums the photos which were
+// not seen locally. As a safety valve, an album whose local files were not found
+// at all, or which would lose more than MirrorMaxRemovals photos, is left untouched.
+// Photos are only removed from the album, they stay in the photostream.
+// Albums left without photos are deleted when DeleteEmptyAlbums is set.
+// It stops at ErrAuthorization
+func (r *syncRun) pruneMirroredAlbums() error {
+	maxRemovals := r.config.MirrorMaxRemovals
+	if maxRemovals < 1 {
+		maxRemovals = defaultMirrorMaxRemovals
+	}
+
+	var titles []string
+	for title := range r.config.AlbumSyncMode {
+		if isMirrored(r.config, title) {
+			titles = append(titles, title)
+		}
+	}
+	sort.Strings(titles)
+
+	for _, title := range titles {
+		logger := r.albumLog(title)
+		if len(r.mirror.seen[title]) == 0 {
+			skipLog(logger, skipReasonMirrorNoLocal).Warn("[SKIP] No local photo for mirrored album, nothing removed")
+			continue
+		}
+
+		albums := r.fromFlickr[title]
+		var emptied []string
+		for i, album := range albums {
+			extras := r.mirror.extras(title, album)
+			if len(extras) == 0 {
+				continue
+			}
+			if len(extras) > maxRemovals {
+				skipLog(logger, skipReasonMirrorMaxRemoval).WithFields(logrus.Fields{
+					"album.id":            album.ID,
+					"removals":            len(extras),
+					"mirror_max_removals": maxRemovals,
+				}).Warn("[SKIP] Too many photos to remove from mirrored album")
+				continue
+			}
+
+			if r.plan != nil {
+				for _, ph := range extras {
+					r.plan.Remove(title, ph.Title)
+				}
+				if r.config.DeleteEmptyAlbums && len(extras) == len(album.Photos) {
+					r.plan.DeleteAlbum(title)
+				}
+				continue
+			}
+
+			ids := make([]string, len(extras))
+			removed := make(map[string]bool)
+			for j, ph := range extras {
+				ids[j] = ph.ID
+				removed[ph.ID] = true
+			}
+			resp, err := photosets.RemovePhotos(r.client, album.ID, ids)
+			if err != nil {
+				if isAuthError(resp) {
+					logger.Error(authFailedMessage)
+					return ErrAuthorization
+				}
+				logger.WithFields(logrus.Fields{
+					"album.id": album.ID,
+					"error":    resp.ErrorMsg(),
+				}).Error("[ERROR] Could not remove photos from mirrored album")
+				continue
+			}
+
+			var kept []FlickrPhoto
+			for _, ph := range album.Photos {
+				if !removed[ph.ID] {
+					kept = append(kept, ph)
+				}
+			}
+			albums[i].Photos = kept
+			for _, ph := range extras {
+				logger.WithFields(logrus.Fields{
+					"album.id":   album.ID,
+					"photo.id":   ph.ID,
+					"photo.name": ph.Title,
+				}).Info("[DELETE] Photo removed from mirrored album")
+			}
+			if len(kept) == 0 && r.config.DeleteEmptyAlbums {
+				emptied = append(emptied, album.ID)
+			}
+		}
+
+		for _, id := range emptied {
+			resp, err := photosets.Delete(r.client, id)
+			if err != nil {
+				if isAuthError(resp) {
+					logger.Error(authFailedMessage)
+					return ErrAuthorization
+				}
+				logger.WithFields(logrus.Fields{
+					"album.id": id,
+					"error":    resp.ErrorMsg(),
+				}).Error("[ERROR] Could not delete empty album")
+				continue
+			}
+			r.forgetAlbum(title, id)
+			logger.WithField("album.id", id).Info("[DELETE] Empty album deleted")
+		}
+	}
+	return nil
+}
+
+// forgetAlbum drops a deleted album from fromFlickr
+func (r *syncRun) forgetAlbum(title string, id string) {
+	var albums []FlickrPhotoset
+	for _, album := range r.fromFlickr[title] {
+		if album.ID != id {
+			albums = append(albums, album)
+		}
+	}
+	if len(albums) == 0 {
+		delete(r.fromFlickr, title)
+		return
+	}
+	r.fromFlickr[title] = albums
+}
@@ -0,0 +1,155 @@
+package synckr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessMirrorAlbum(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("mirrored", "a", "old")
+	stub.addSet("appended", "c", "extra")
+
+	root := makeTree(t, "mirrored/a.jpg", "mirrored/b.jpg", "appended/c.jpg", "appended/d.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.AlbumSyncMode = map[string]string{"mirrored": AlbumSyncModeMirror, "appended": AlbumSyncModeAppend}
+	fromFlickr, err := Process(&config, stub.client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if titles := stub.titles(stub.set("mirrored")); !reflect.DeepEqual(titles, []string{"a", "b"}) {
+		t.Errorf("The mirrored album should match the local files, got %v", titles)
+	}
+	if titles := stub.titles(stub.set("appended")); !reflect.DeepEqual(titles, []string{"c", "extra", "d"}) {
+		t.Errorf("The appended album should only receive the new files, got %v", titles)
+	}
+	if len(fromFlickr["mirrored"][0].Photos) != 2 {
+		t.Errorf("The removed photos should be dropped from the returned map, got %v", fromFlickr["mirrored"])
+	}
+	if stub.count("flickr.photosets.removePhotos") != 1 {
+		t.Errorf("Expected a single removal call, got %d", stub.count("flickr.photosets.removePhotos"))
+	}
+}
+
+func TestMirrorKeepsSkippedFiles(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("mirrored", "a", "b", "old")
+
+	root := makeTree(t, "mirrored/a.jpg", "mirrored/b.jpg")
+	defer os.RemoveAll(root)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(root, "mirrored", "a.jpg"), old, old)
+
+	// b was modified too recently to be synced
+	config := testConfig(root)
+	config.AlbumSyncMode = map[string]string{"mirrored": AlbumSyncModeMirror}
+	config.MinFileAge = 60
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if titles := stub.titles(stub.set("mirrored")); !reflect.DeepEqual(titles, []string{"a", "b"}) {
+		t.Errorf("Only the photo without local file should be removed, got %v", titles)
+	}
+}
+
+func TestMirrorSafetyValve(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("mirrored", "a", "x1", "x2", "x3")
+	stub.addSet("gone", "y")
+
+	root := makeTree(t, "mirrored/a.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.AlbumSyncMode = map[string]string{"mirrored": AlbumSyncModeMirror, "gone": AlbumSyncModeMirror}
+	config.MirrorMaxRemovals = 2
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("flickr.photosets.removePhotos") != 0 {
+		t.Errorf("Nothing should be removed beyond the limit nor without local files, got %d removals", stub.count("flickr.photosets.removePhotos"))
+	}
+	if len(stub.set("mirrored").Photos) != 4 || len(stub.set("gone").Photos) != 1 {
+		t.Error("The albums should be left untouched")
+	}
+}
+
+func TestMirrorDryRun(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("mirrored", "a", "old")
+
+	root := makeTree(t, "mirrored/a.jpg", "mirrored/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.AlbumSyncMode = map[string]string{"mirrored": AlbumSyncModeMirror}
+	config.DryRun = true
+	config.PlanFile = filepath.Join(root, "plan.txt")
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("flickr.photosets.removePhotos") != 0 || len(stub.set("mirrored").Photos) != 2 {
+		t.Error("A dry run should not remove anything")
+	}
+	plan, _ := ioutil.ReadFile(config.PlanFile)
+	if !bytes.Contains(plan, []byte("- remove old from mirrored\n")) || !strings.Contains(string(plan), "+ upload mirrored/b.jpg") {
+		t.Errorf("The plan should list the upload and the removal, got %q", plan)
+	}
+}
+
+func TestMirrorDeleteEmptyAlbums(t *testing.T) {
+	for _, deleteEmpty := range []bool{false, true} {
+		stub := newFlickrStub(t)
+		defer stub.Close()
+		stub.addSet("mirrored", "old1", "old2")
+		// The only local photo can't be uploaded: pruning empties the album
+		stub.hook("upload", func(args url.Values) string {
+			return stubError(105, "Service currently unavailable")
+		})
+
+		root := makeTree(t, "mirrored/new.jpg")
+		defer os.RemoveAll(root)
+
+		config := testConfig(root)
+		config.AlbumSyncMode = map[string]string{"mirrored": AlbumSyncModeMirror}
+		config.DeleteEmptyAlbums = deleteEmpty
+		fromFlickr, err := Process(&config, stub.client(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if deleteEmpty && (stub.count("flickr.photosets.delete") != 1 || stub.set("mirrored") != nil || fromFlickr["mirrored"] != nil) {
+			t.Errorf("The emptied album should be deleted, got %d calls and %v", stub.count("flickr.photosets.delete"), fromFlickr["mirrored"])
+		}
+		if !deleteEmpty && (stub.count("flickr.photosets.delete") != 0 || stub.set("mirrored") == nil) {
+			t.Errorf("The emptied album should be kept without DeleteEmptyAlbums, got %d calls", stub.count("flickr.photosets.delete"))
+		}
+
+		// A dry run plans the deletion
+		config.DryRun = true
+		config.PlanFile = filepath.Join(root, "plan.txt")
+		stub.addSet("mirrored", "old3")
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		plan, _ := ioutil.ReadFile(config.PlanFile)
+		if planned := strings.Contains(string(plan), "- delete empty album mirrored\n"); planned != deleteEmpty {
+			t.Errorf("DeleteEmptyAlbums %v: unexpected plan %q", deleteEmpty, plan)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package synckr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultNamingTimeout is the number of seconds NamingCommand is given per file
+// when NamingTimeout is not set
+const defaultNamingTimeout = 10
+
+// naming is the output of NamingCommand for a file. Empty fields keep the defaults
+type naming struct {
+	Album string   `json:"album"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+// commandRunner runs NamingCommand. Tests replace it
+var commandRunner = runShellCommand
+
+// runShellCommand runs a shell command feeding it stdin, and returns its standard
+// output
+func runShellCommand(ctx context.Context, command string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(stdin)
+	// Children of the shell may keep its output open once it is killed
+	cmd.WaitDelay = time.Second
+	return cmd.Output()
+}
+
+// runNamingCommand runs NamingCommand for a file, passing its path on stdin, and
+// parses the naming it prints
+func runNamingCommand(config *Config, path string) (naming, error) {
+	timeout := config.NamingTimeout * time.Second
+	if timeout <= 0 {
+		timeout = defaultNamingTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var result naming
+	out, err := commandRunner(ctx, config.NamingCommand, []byte(path+"\n"))
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(out, &result)
+	return result, err
+}
+
+// meta returns the upload metadata of a naming
+func (n naming) meta(config *Config) photoMeta {
+	meta := photoMeta{Tags: n.Tags}
+	if n.Title != "" {
+		meta.Title = normalizeTitle(config, n.Title)
+	}
+	return meta
+}
+
+// naming returns the naming of a file by NamingCommand, running it once per file.
+// Failures are logged and keep the defaults
+func (r *syncRun) naming(path string) naming {
+	if r.config.NamingCommand == "" {
+		return naming{}
+	}
+	if result, ok := r.namings[path]; ok {
+		return result
+	}
+	result, err := runNamingCommand(r.config, path)
+	if err != nil {
+		r.log.WithFields(logrus.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("[WARNING] Naming command failed, using the default names")
+		result = naming{}
+	}
+	r.namings[path] = result
+	return result
+}
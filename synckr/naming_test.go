@@ -0,0 +1,81 @@
+package synckr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamingCommand(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "2024/a.jpg", "2024/b.jpg", "2024/notes.txt")
+	defer os.RemoveAll(root)
+
+	var named []string
+	commandRunner = func(ctx context.Context, command string, stdin []byte) ([]byte, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("The naming command should run with a timeout")
+		}
+		path := strings.TrimSpace(string(stdin))
+		named = append(named, path)
+		if strings.HasSuffix(path, "b.jpg") {
+			return nil, errors.New("exit status 1")
+		}
+		return []byte(`{"album": "Holidays", "title": "Beach", "tags": ["sea", "summer 2024"]}`), nil
+	}
+	defer func() { commandRunner = runShellCommand }()
+
+	config := testConfig(root)
+	config.NamingCommand = "./name.sh"
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(named) != 4 {
+		t.Errorf("The command should run once per supported file and run, got %v", named)
+	}
+	if titles := stub.titles(stub.set("Holidays")); !reflect.DeepEqual(titles, []string{"Beach"}) {
+		t.Errorf("The command naming should be applied, got %v", titles)
+	}
+	if titles := stub.titles(stub.set("2024")); !reflect.DeepEqual(titles, []string{"b"}) {
+		t.Errorf("A failing command should keep the default naming, got %v", titles)
+	}
+	for _, ph := range stub.photos {
+		if ph.Title == "Beach" && ph.Args.Get("tags") != `sea "summer 2024"` {
+			t.Errorf("The command tags should be added, got %q", ph.Args.Get("tags"))
+		}
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("Photos named by the command should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestRunNamingCommand(t *testing.T) {
+	config := Config{NamingCommand: `read path; printf '{"album": "%s"}' "$(basename "$(dirname "$path")")"`}
+	result, err := runNamingCommand(&config, "/photos/trip/a.jpg")
+	if err != nil || result.Album != "trip" {
+		t.Errorf("Expected the album printed by the command, got %v %v", result, err)
+	}
+
+	config = Config{NamingCommand: "sleep 5", NamingTimeout: 1}
+	start := time.Now()
+	if _, err := runNamingCommand(&config, "/photos/trip/a.jpg"); err == nil {
+		t.Error("A command exceeding the timeout should fail")
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Error("The command should be stopped after the timeout")
+	}
+
+	config = Config{NamingCommand: "echo not json"}
+	if _, err := runNamingCommand(&config, "/photos/trip/a.jpg"); err == nil {
+		t.Error("An invalid output should be an error")
+	}
+}
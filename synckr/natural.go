@@ -0,0 +1,71 @@
+package synckr
+
+import (
+	"sort"
+	"strings"
+)
+
+// naturalLess compares strings treating runs of digits as numbers, so that
+// "IMG_2" sorts before "IMG_10". Strings which only differ by leading zeros are
+// ordered lexically
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na := strings.TrimLeft(a[si:i], "0")
+			nb := strings.TrimLeft(b[sj:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// FlickrPhotosByNaturalTitle implements Sort interface to sort photos
+// by their title using naturalLess
+type FlickrPhotosByNaturalTitle []FlickrPhoto
+
+func (a FlickrPhotosByNaturalTitle) Len() int           { return len(a) }
+func (a FlickrPhotosByNaturalTitle) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a FlickrPhotosByNaturalTitle) Less(i, j int) bool { return naturalLess(a[i].Title, a[j].Title) }
+
+// titleLess returns the order photos titles are sorted in
+func titleLess(config *Config) func(a, b string) bool {
+	if config.NaturalSort {
+		return naturalLess
+	}
+	return func(a, b string) bool { return a < b }
+}
+
+// sortPhotos sorts photos by title in the order of the configuration
+func sortPhotos(config *Config, photos []FlickrPhoto) {
+	if config.NaturalSort {
+		sort.Sort(FlickrPhotosByNaturalTitle(photos))
+	} else {
+		sort.Sort(FlickrPhotosByTitle(photos))
+	}
+}
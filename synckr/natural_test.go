@@ -0,0 +1,82 @@
+package synckr
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"IMG_2", "IMG_10", true},
+		{"IMG_10", "IMG_2", false},
+		{"IMG_2", "IMG_2", false},
+		{"IMG_02", "IMG_2", true},
+		{"IMG_2", "IMG_02", false},
+		{"IMG_2a", "IMG_2b", true},
+		{"IMG_2", "IMG_2a", true},
+		{"a10b", "a9c", false},
+		{"DSC", "IMG", true},
+		{"photo 9 edit", "photo 10", true},
+		{"2024-01-9", "2024-01-10", true},
+		{"10", "abc", true},
+	}
+
+	for _, tt := range tests {
+		if got := naturalLess(tt.a, tt.b); got != tt.expected {
+			t.Errorf("naturalLess(%q, %q): expected %v, got %v", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestFlickrPhotosByNaturalTitle(t *testing.T) {
+	photos := []FlickrPhoto{{Title: "IMG_10"}, {Title: "IMG_1"}, {Title: "DSC_3"}, {Title: "IMG_2"}, {Title: "IMG_2"}}
+	sort.Sort(FlickrPhotosByNaturalTitle(photos))
+
+	var titles []string
+	for _, ph := range photos {
+		titles = append(titles, ph.Title)
+	}
+	if expected := []string{"DSC_3", "IMG_1", "IMG_2", "IMG_2", "IMG_10"}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("Expected %v, got %v", expected, titles)
+	}
+}
+
+func TestProcessNaturalSort(t *testing.T) {
+	tests := []struct {
+		natural  bool
+		expected []string
+	}{
+		{false, []string{"IMG_1", "IMG_10", "IMG_2"}},
+		{true, []string{"IMG_1", "IMG_2", "IMG_10"}},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/IMG_10.jpg", "album/IMG_2.jpg", "album/IMG_1.jpg")
+
+		config := testConfig(root)
+		config.NaturalSort = tt.natural
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, tt.expected) {
+			t.Errorf("NaturalSort %v: expected upload order %v, got %v", tt.natural, tt.expected, titles)
+		}
+
+		// Photos are recognized on the next run whatever the order
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if stub.count("upload") != 3 {
+			t.Errorf("NaturalSort %v: expected no new upload, got %d uploads", tt.natural, stub.count("upload"))
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
@@ -0,0 +1,39 @@
+package synckr
+
+import "strings"
+
+// Normalizations applied to local and flickr titles before comparing them, as
+// flickr may alter whitespace of the titles it is sent
+const (
+	// TitleNormalizationNone compares titles as they are. This is the default
+	TitleNormalizationNone = "none"
+	// TitleNormalizationTrim ignores leading and trailing whitespace
+	TitleNormalizationTrim = "trim"
+	// TitleNormalizationCollapseWS also treats runs of whitespace as a single space
+	TitleNormalizationCollapseWS = "collapse_ws"
+)
+
+// normalizeTitle applies TitleNormalization to a title
+func normalizeTitle(config *Config, title string) string {
+	switch config.TitleNormalization {
+	case TitleNormalizationTrim:
+		return strings.TrimSpace(title)
+	case TitleNormalizationCollapseWS:
+		return strings.Join(strings.Fields(title), " ")
+	}
+	return title
+}
+
+// normalizeTitles applies TitleNormalization to the titles of photos retrieved from flickr
+func normalizeTitles(config *Config, photos []FlickrPhoto) {
+	for i := range photos {
+		photos[i].Title = normalizeTitle(config, photos[i].Title)
+	}
+}
+
+// indexPhotos prepares the photos of an album for title lookups: titles are
+// normalized, then sorted
+func indexPhotos(config *Config, photos []FlickrPhoto) {
+	normalizeTitles(config, photos)
+	sortPhotos(config, photos)
+}
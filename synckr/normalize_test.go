@@ -0,0 +1,54 @@
+package synckr
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		normalization string
+		title         string
+		expected      string
+	}{
+		{"", " a  b ", " a  b "},
+		{TitleNormalizationNone, " a  b ", " a  b "},
+		{TitleNormalizationTrim, " a  b \t", "a  b"},
+		{TitleNormalizationCollapseWS, " a  b \t c ", "a b c"},
+	}
+	for _, tt := range tests {
+		config := Config{TitleNormalization: tt.normalization}
+		if got := normalizeTitle(&config, tt.title); got != tt.expected {
+			t.Errorf("%q %q: expected %q, got %q", tt.normalization, tt.title, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessTitleNormalization(t *testing.T) {
+	tests := []struct {
+		normalization string
+		uploaded      int
+	}{
+		{TitleNormalizationNone, 2},
+		{TitleNormalizationTrim, 1},
+		{TitleNormalizationCollapseWS, 0},
+	}
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		// flickr trimmed and collapsed the titles it was sent
+		stub.addSet("album", "a", "b c")
+		root := makeTree(t, "album/a .jpg", "album/b  c.jpg")
+
+		config := testConfig(root)
+		config.TitleNormalization = tt.normalization
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if stub.count("upload") != tt.uploaded {
+			t.Errorf("%s: expected %d uploads, got %d", tt.normalization, tt.uploaded, stub.count("upload"))
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
@@ -0,0 +1,151 @@
+package synckr
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSMTPPort is used when SMTPConfig.Port is not set
+const defaultSMTPPort = 25
+
+// SMTPConfig describes how the summary of a run is mailed.
+// Authentication is only attempted when Username is set
+type SMTPConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+}
+
+// mailer sends a message, like smtp.SendMail. Tests replace it
+var mailer = smtp.SendMail
+
+// runSummary sums up what a Process did
+type runSummary struct {
+	library       string
+	start         time.Time
+	duration      time.Duration
+	uploaded      uint64
+	skipped       uint64
+	failed        uint64
+	bytesUploaded uint64
+	skipReasons   map[string]uint64
+	err           error
+}
+
+// startRunSummary records the metrics at the start of a run, the summary
+// counts what happened since
+func startRunSummary(config *Config) runSummary {
+	return runSummary{
+		library:       config.PhotoLibraryPath,
+		start:         time.Now(),
+		uploaded:      uploadsTotal.Value(),
+		skipped:       skippedTotal.Value(),
+		failed:        failuresTotal.Value(),
+		bytesUploaded: bytesUploadedTotal.Value(),
+		skipReasons:   skipReasonsTotal.Values(),
+	}
+}
+
+// finish returns the summary of the run, which ended with err
+func (s runSummary) finish(err error) runSummary {
+	skipReasons := make(map[string]uint64)
+	for reason, n := range skipReasonsTotal.Values() {
+		if n > s.skipReasons[reason] {
+			skipReasons[reason] = n - s.skipReasons[reason]
+		}
+	}
+	return runSummary{
+		library:       s.library,
+		start:         s.start,
+		duration:      time.Since(s.start),
+		uploaded:      uploadsTotal.Value() - s.uploaded,
+		skipped:       skippedTotal.Value() - s.skipped,
+		failed:        failuresTotal.Value() - s.failed,
+		bytesUploaded: bytesUploadedTotal.Value() - s.bytesUploaded,
+		skipReasons:   skipReasons,
+		err:           err,
+	}
+}
+
+// formatBytes returns a size in bytes in a human readable form, e.g. "1.5 MiB"
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 5; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// composeSummary returns the mail describing a run
+func composeSummary(config *SMTPConfig, s runSummary) []byte {
+	status := "completed"
+	if s.err != nil || s.failed > 0 {
+		status = "failed"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&b, "Subject: synckr run %s: %d uploaded, %d failed\r\n", status, s.uploaded, s.failed)
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "Library: %s\r\n", s.library)
+	fmt.Fprintf(&b, "Started: %s\r\n", s.start.Format(time.RFC3339))
+	fmt.Fprintf(&b, "Duration: %s\r\n", s.duration.Round(time.Second))
+	fmt.Fprintf(&b, "Uploaded: %d\r\n", s.uploaded)
+	fmt.Fprintf(&b, "Skipped: %d\r\n", s.skipped)
+	fmt.Fprintf(&b, "Failed: %d\r\n", s.failed)
+	fmt.Fprintf(&b, "Bytes uploaded: %d (%s)\r\n", s.bytesUploaded, formatBytes(s.bytesUploaded))
+	reasons := make([]string, 0, len(s.skipReasons))
+	for reason := range s.skipReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	if len(reasons) > 0 {
+		b.WriteString("Skipped by reason:\r\n")
+	}
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "  %s: %d\r\n", reason, s.skipReasons[reason])
+	}
+	if s.err != nil {
+		fmt.Fprintf(&b, "Error: %v\r\n", s.err)
+	}
+	return b.Bytes()
+}
+
+// notify mails the summary of a run. Failures are logged only
+func notify(config *SMTPConfig, logger *logrus.Logger, s runSummary) {
+	port := config.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(port))
+	if err := mailer(addr, auth, config.From, config.To, composeSummary(config, s)); err != nil {
+		logger.WithFields(logrus.Fields{
+			"smtp":  addr,
+			"error": err,
+		}).Error("[ERROR] Could not send the run summary")
+		return
+	}
+	logger.WithField("to", config.To).Info("[OK] Run summary sent")
+}
@@ -0,0 +1,142 @@
+package synckr
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProcessMailsSummary(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/notes.txt")
+	defer os.RemoveAll(root)
+
+	var sent []string
+	var recipients []string
+	mailer = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "mail.example.com:587" || auth == nil || from != "nas@example.com" {
+			t.Errorf("Unexpected mail settings %s %v %s", addr, auth, from)
+		}
+		recipients = to
+		sent = append(sent, string(msg))
+		return nil
+	}
+	defer func() { mailer = smtp.SendMail }()
+
+	config := testConfig(root)
+	config.SMTP = &SMTPConfig{
+		Host:     "mail.example.com",
+		Port:     587,
+		From:     "nas@example.com",
+		To:       []string{"me@example.com"},
+		Username: "nas",
+		Password: "secret",
+	}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 1 || !reflect.DeepEqual(recipients, config.SMTP.To) {
+		t.Fatalf("Expected one mail to %v, got %d to %v", config.SMTP.To, len(sent), recipients)
+	}
+	for _, expected := range []string{
+		"Subject: synckr run completed: 1 uploaded, 0 failed\r\n",
+		"\r\n\r\nLibrary: " + root + "\r\n",
+		"Uploaded: 1\r\nSkipped: 2\r\nFailed: 0\r\n",
+	} {
+		if !strings.Contains(sent[0], expected) {
+			t.Errorf("The summary should contain %q, got %q", expected, sent[0])
+		}
+	}
+	if strings.Contains(sent[0], "Error:") {
+		t.Errorf("A successful run reports no error, got %q", sent[0])
+	}
+}
+
+func TestComposeSummaryError(t *testing.T) {
+	config := &SMTPConfig{From: "nas@example.com", To: []string{"a@example.com", "b@example.com"}}
+	msg := string(composeSummary(config, runSummary{library: "/photos", uploaded: 3, err: ErrUploadQuota}))
+	for _, expected := range []string{
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: synckr run failed: 3 uploaded, 0 failed\r\n",
+		"Error: upload quota reached\r\n",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("The summary should contain %q, got %q", expected, msg)
+		}
+	}
+}
+
+func TestNotifyFailureIsLogged(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+
+	mailer = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		return errors.New("connection refused")
+	}
+	defer func() { mailer = smtp.SendMail }()
+
+	config := testConfig(root)
+	config.SMTP = &SMTPConfig{Host: "localhost", To: []string{"me@example.com"}}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Errorf("Failing to send the summary should not fail the run, got %v", err)
+	}
+}
+
+func TestSummaryBytesUploaded(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t)
+	defer os.RemoveAll(root)
+	sizes := map[string]int{"a.jpg": 10, "b.jpg": 200, "c.png": 3000}
+	os.Mkdir(filepath.Join(root, "album"), 0755)
+	for name, size := range sizes {
+		ioutil.WriteFile(filepath.Join(root, "album", name), make([]byte, size), 0644)
+	}
+	ioutil.WriteFile(filepath.Join(root, "album", "notes.txt"), make([]byte, 50), 0644)
+
+	var sent string
+	mailer = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent = string(msg)
+		return nil
+	}
+	defer func() { mailer = smtp.SendMail }()
+
+	config := testConfig(root)
+	config.SMTP = &SMTPConfig{Host: "mail.example.com", To: []string{"me@example.com"}}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sent, "Bytes uploaded: 3210 (3.1 KiB)\r\n") {
+		t.Errorf("The summary should sum the sizes of the uploaded files, got %q", sent)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 40, "3.0 TiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.expected {
+			t.Errorf("%d: expected %q, got %q", tt.n, tt.expected, got)
+		}
+	}
+}
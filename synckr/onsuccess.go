@@ -0,0 +1,120 @@
+package synckr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OnSuccess actions. move and exec are followed by their directory or command
+const (
+	OnSuccessNone   = "none"
+	OnSuccessDelete = "delete"
+	OnSuccessMove   = "move:"
+	OnSuccessExec   = "exec:"
+)
+
+// onSuccessTimeout is the number of seconds the exec action is given per file
+const onSuccessTimeout = 60
+
+// successRunner runs the command of the exec action. Tests replace it
+var successRunner = runShellCommand
+
+// successAction is a parsed OnSuccess. arg is the absolute archive directory of
+// move, or the command of exec
+type successAction struct {
+	kind string
+	arg  string
+}
+
+// parseOnSuccess parses an OnSuccess action. An empty action is none
+func parseOnSuccess(action string) (successAction, error) {
+	switch {
+	case action == "" || action == OnSuccessNone:
+		return successAction{kind: OnSuccessNone}, nil
+	case action == OnSuccessDelete:
+		return successAction{kind: OnSuccessDelete}, nil
+	case strings.HasPrefix(action, OnSuccessMove) && len(action) > len(OnSuccessMove):
+		dir, err := filepath.Abs(strings.TrimPrefix(action, OnSuccessMove))
+		return successAction{OnSuccessMove, dir}, err
+	case strings.HasPrefix(action, OnSuccessExec) && len(action) > len(OnSuccessExec):
+		return successAction{OnSuccessExec, strings.TrimPrefix(action, OnSuccessExec)}, nil
+	}
+	return successAction{}, fmt.Errorf("unknown on_success action %q", action)
+}
+
+// isArchiveDir tells whether dir is the archive directory of a move OnSuccess,
+// which walks skip so that archived files are not uploaded again
+func isArchiveDir(config *Config, dir string) bool {
+	action, err := parseOnSuccess(config.OnSuccess)
+	if err != nil || action.kind != OnSuccessMove {
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	return err == nil && abs == action.arg
+}
+
+// afterUpload performs the OnSuccess action on a file uploaded successfully.
+// Moved files keep their path relative to PhotoLibraryPath in the archive
+// directory. Failures are logged, the upload itself is not undone
+func (r *syncRun) afterUpload(logger logrus.FieldLogger, path string) {
+	if r.plan != nil {
+		return
+	}
+
+	switch r.success.kind {
+	case OnSuccessDelete:
+		if err := os.Remove(path); err != nil {
+			logger.WithFields(logrus.Fields{
+				"path":  path,
+				"error": err,
+			}).Error("[ERROR] Could not delete uploaded file")
+			return
+		}
+		logger.WithField("path", path).Info("[OK] Uploaded file deleted")
+
+	case OnSuccessMove:
+		dest := filepath.Join(r.success.arg, filepath.FromSlash(relPath(r.config, path)))
+		err := os.MkdirAll(filepath.Dir(dest), 0755)
+		if err == nil {
+			// Rename would silently replace a file archived before
+			if _, statErr := os.Lstat(dest); statErr == nil {
+				err = fmt.Errorf("%s already exists", dest)
+			} else {
+				err = os.Rename(path, dest)
+			}
+		}
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"path":        path,
+				"destination": dest,
+				"error":       err,
+			}).Error("[ERROR] Could not move uploaded file")
+			return
+		}
+		logger.WithFields(logrus.Fields{
+			"path":        path,
+			"destination": dest,
+		}).Info("[OK] Uploaded file moved")
+
+	case OnSuccessExec:
+		ctx, cancel := context.WithTimeout(context.Background(), onSuccessTimeout*time.Second)
+		defer cancel()
+		_, err := successRunner(ctx, r.success.arg, []byte(path+"\n"))
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"path":    path,
+				"command": r.success.arg,
+				"error":   err,
+			}).Warn("[WARNING] On success command failed")
+		}
+	}
+}
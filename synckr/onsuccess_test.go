@@ -0,0 +1,108 @@
+package synckr
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseOnSuccess(t *testing.T) {
+	tests := []struct {
+		action string
+		kind   string
+		arg    string
+		valid  bool
+	}{
+		{"", OnSuccessNone, "", true},
+		{"none", OnSuccessNone, "", true},
+		{"delete", OnSuccessDelete, "", true},
+		{"move:/archive/uploaded", OnSuccessMove, "/archive/uploaded", true},
+		{"exec:touch done", OnSuccessExec, "touch done", true},
+		{"move:", "", "", false},
+		{"exec:", "", "", false},
+		{"rename", "", "", false},
+	}
+	for _, tt := range tests {
+		got, err := parseOnSuccess(tt.action)
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: expected valid %v, got %v", tt.action, tt.valid, err)
+		}
+		if tt.valid && (got.kind != tt.kind || got.arg != tt.arg) {
+			t.Errorf("%q: expected %s %q, got %s %q", tt.action, tt.kind, tt.arg, got.kind, got.arg)
+		}
+	}
+}
+
+func TestOnSuccessMove(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "album/a.jpg", "album/b.jpg")
+	defer os.RemoveAll(root)
+	archive := filepath.Join(root, "uploaded")
+
+	config := testConfig(root)
+	config.OnSuccess = "move:" + archive
+	for run := 0; run < 2; run++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		if _, err := os.Stat(filepath.Join(root, "album", name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be moved out of the library", name)
+		}
+		if _, err := os.Stat(filepath.Join(archive, "album", name)); err != nil {
+			t.Errorf("%s should be moved to the archive: %v", name, err)
+		}
+	}
+	if stub.count("upload") != 2 || stub.set("uploaded") != nil {
+		t.Errorf("The archive should not be uploaded, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestOnSuccessExec(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg")
+	defer os.RemoveAll(root)
+
+	var commands, inputs []string
+	defer func(r func(context.Context, string, []byte) ([]byte, error)) { successRunner = r }(successRunner)
+	successRunner = func(ctx context.Context, command string, stdin []byte) ([]byte, error) {
+		commands = append(commands, command)
+		inputs = append(inputs, string(stdin))
+		return nil, errors.New("exit status 1")
+	}
+
+	config := testConfig(root)
+	config.OnSuccess = "exec:archive-photo"
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{filepath.Join(root, "album", "b.jpg") + "\n", filepath.Join(root, "album", "c.jpg") + "\n"}
+	if !reflect.DeepEqual(inputs, expected) || commands[0] != "archive-photo" {
+		t.Errorf("The command should be run for each uploaded file, got %v %v", commands, inputs)
+	}
+	if _, err := os.Stat(filepath.Join(root, "album", "b.jpg")); err != nil {
+		t.Error("The exec action should leave the file in place")
+	}
+
+	// Dry runs never act on the files
+	inputs = nil
+	config.DryRun = true
+	config.PlanFile = filepath.Join(root, "plan.txt")
+	ioutil.WriteFile(filepath.Join(root, "album", "d.jpg"), []byte("d"), 0644)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 0 {
+		t.Errorf("A dry run should not run the command, got %v", inputs)
+	}
+}
@@ -0,0 +1,67 @@
+package synckr
+
+import (
+	"strconv"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// notInSetPerPage is the number of photos requested per page of getNotInSet
+const notInSetPerPage = 500
+
+// notInSetResponse is the response of flickr.photos.getNotInSet, which the
+// flickr library does not implement
+type notInSetResponse struct {
+	flickr.BasicResponse
+	Photos struct {
+		Page   int `xml:"page,attr"`
+		Pages  int `xml:"pages,attr"`
+		Photos []struct {
+			ID    string `xml:"id,attr"`
+			Title string `xml:"title,attr"`
+		} `xml:"photo"`
+	} `xml:"photos"`
+}
+
+func getNotInSet(client *flickr.FlickrClient, page int) (*notInSetResponse, error) {
+	client.Init()
+	client.EndpointUrl = flickr.API_ENDPOINT
+	client.Args.Set("method", "flickr.photos.getNotInSet")
+	client.Args.Set("page", strconv.Itoa(page))
+	client.Args.Set("per_page", strconv.Itoa(notInSetPerPage))
+	client.OAuthSign()
+
+	response := &notInSetResponse{}
+	err := flickr.DoGet(client, response)
+	return response, err
+}
+
+// RetrieveNotInSet returns the photos of the user which do not belong to any album,
+// e.g. because a previous run uploaded them but failed to add them to their album
+func RetrieveNotInSet(client *flickr.FlickrClient) ([]FlickrPhoto, error) {
+	var result []FlickrPhoto
+	for page := 1; ; page++ {
+		resp, err := getNotInSet(client, page)
+		if err != nil {
+			return result, err
+		}
+		for _, ph := range resp.Photos.Photos {
+			result = append(result, FlickrPhoto{ID: ph.ID, Title: ph.Title})
+		}
+		if len(resp.Photos.Photos) == 0 || resp.Photos.Page >= resp.Photos.Pages {
+			return result, nil
+		}
+	}
+}
+
+// orphansByTitle indexes photos not in any album by title, keeping the first
+// photo of each title
+func orphansByTitle(orphans []FlickrPhoto) map[string]FlickrPhoto {
+	result := make(map[string]FlickrPhoto)
+	for _, ph := range orphans {
+		if _, ok := result[ph.Title]; !ok {
+			result[ph.Title] = ph
+		}
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package synckr
+
+import "fmt"
+
+// overflowTitle returns the title of the n-th album holding the photos of the
+// album titled base when it exceeds MaxAlbumSize: base, then "base (2)", "base (3)"...
+func overflowTitle(base string, n int) string {
+	if n <= 1 {
+		return base
+	}
+	return fmt.Sprintf("%s (%d)", base, n)
+}
+
+// albumSize returns the number of photos of the albums titled title
+func (r *syncRun) albumSize(title string) int {
+	size := 0
+	for _, album := range r.fromFlickr[title] {
+		size += len(album.Photos)
+	}
+	return size
+}
+
+// overflowAlbums returns the albums titled base and the overflow albums which
+// follow it, up to the first missing one
+func (r *syncRun) overflowAlbums(base string) []FlickrPhotoset {
+	var result []FlickrPhotoset
+	for n := 1; ; n++ {
+		albums, ok := r.fromFlickr[overflowTitle(base, n)]
+		if !ok {
+			return result
+		}
+		result = append(result, albums...)
+	}
+}
+
+// currentOverflow returns the title of the album receiving the new photos of
+// the album titled base: the first one holding less than MaxAlbumSize photos.
+// The current album of each base title is remembered, it never goes back
+func (r *syncRun) currentOverflow(base string) string {
+	n := r.overflow[base]
+	if n < 1 {
+		n = 1
+	}
+	for r.albumSize(overflowTitle(base, n)) >= r.config.MaxAlbumSize {
+		n++
+	}
+	r.overflow[base] = n
+	return overflowTitle(base, n)
+}
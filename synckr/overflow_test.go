@@ -0,0 +1,46 @@
+package synckr
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestProcessAlbumOverflow(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("full", "a", "b")
+
+	root := makeTree(t, "big/a.jpg", "big/b.jpg", "big/c.jpg", "big/d.jpg", "big/e.jpg",
+		"full/a.jpg", "full/b.jpg", "full/c.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.MaxAlbumSize = 2
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string][]string{
+		"big":      {"a", "b"},
+		"big (2)":  {"c", "d"},
+		"big (3)":  {"e"},
+		"full":     {"a", "b"},
+		"full (2)": {"c"},
+	}
+	for title, photos := range expected {
+		set := stub.set(title)
+		if set == nil {
+			t.Errorf("Expected the album %q to be created", title)
+			continue
+		}
+		if titles := stub.titles(set); !reflect.DeepEqual(titles, photos) {
+			t.Errorf("Expected %v in %q, got %v", photos, title, titles)
+		}
+	}
+	if stub.count("upload") != 6 {
+		t.Errorf("Photos of overflow albums should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+}
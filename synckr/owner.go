@@ -0,0 +1,58 @@
+package synckr
+
+// uploadedPhoto is an upload to record into a fromFlickr map
+type uploadedPhoto struct {
+	album  string
+	result UploadResult
+	photo  FlickrPhoto
+}
+
+// albumOwner owns a fromFlickr map on behalf of concurrent uploaders: they
+// send their results, and a single goroutine records them into the map, which
+// is handed back once the owner is closed. The map must not be used in between
+type albumOwner struct {
+	results chan uploadedPhoto
+	done    chan map[string][]FlickrPhotoset
+}
+
+// newAlbumOwner starts the goroutine owning fromFlickr. Photos are kept sorted
+// in the less order
+func newAlbumOwner(fromFlickr map[string][]FlickrPhotoset, less func(a, b string) bool) *albumOwner {
+	o := &albumOwner{
+		results: make(chan uploadedPhoto),
+		done:    make(chan map[string][]FlickrPhotoset),
+	}
+	go func() {
+		for u := range o.results {
+			recordPhoto(fromFlickr, u.album, u.result.AlbumID, u.photo, less)
+		}
+		o.done <- fromFlickr
+	}()
+	return o
+}
+
+// Send records an uploaded photo into the album titled album. It is safe
+// for concurrent use
+func (o *albumOwner) Send(album string, result UploadResult, photo FlickrPhoto) {
+	o.results <- uploadedPhoto{album, result, photo}
+}
+
+// Close waits for the results sent so far to be recorded and returns the map.
+// Send must not be called afterwards
+func (o *albumOwner) Close() map[string][]FlickrPhotoset {
+	close(o.results)
+	return <-o.done
+}
+
+// recordPhoto adds a photo to the album albumID titled title, which is added to
+// fromFlickr when it's not there yet
+func recordPhoto(fromFlickr map[string][]FlickrPhotoset, title string, albumID string, photo FlickrPhoto, less func(a, b string) bool) {
+	albums := fromFlickr[title]
+	for i, album := range albums {
+		if album.ID == albumID {
+			albums[i] = album.withPhoto(photo, less)
+			return
+		}
+	}
+	fromFlickr[title] = append(albums, FlickrPhotoset{albumID, []FlickrPhoto{photo}})
+}
@@ -0,0 +1,51 @@
+package synckr
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestAlbumOwnerConcurrentResults(t *testing.T) {
+	fromFlickr := map[string][]FlickrPhotoset{
+		"existing": {{"1", []FlickrPhoto{{ID: "10", Title: "a"}}}},
+	}
+	owner := newAlbumOwner(fromFlickr, titleLess(&Config{}))
+
+	const uploaders = 50
+	const uploads = 20
+	var wg sync.WaitGroup
+	for i := 0; i < uploaders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < uploads; j++ {
+				album, albumID := "existing", "1"
+				if j%2 == 1 {
+					album, albumID = fmt.Sprint("album ", i), fmt.Sprint("set", i)
+				}
+				photo := FlickrPhoto{ID: fmt.Sprint(i, "-", j), Title: fmt.Sprintf("IMG_%02d_%02d", i, j)}
+				owner.Send(album, UploadResult{PhotoID: photo.ID, AlbumID: albumID}, photo)
+			}
+		}(i)
+	}
+	wg.Wait()
+	result := owner.Close()
+
+	if len(result) != uploaders+1 {
+		t.Fatalf("Expected %d albums, got %d", uploaders+1, len(result))
+	}
+	existing := result["existing"]
+	if len(existing) != 1 || len(existing[0].Photos) != 1+uploaders*uploads/2 {
+		t.Errorf("Every result should be recorded into the existing album, got %d photos", len(existing[0].Photos))
+	}
+	if !sort.SliceIsSorted(existing[0].Photos, func(i, j int) bool { return existing[0].Photos[i].Title < existing[0].Photos[j].Title }) {
+		t.Error("Photos should be kept sorted by title")
+	}
+	for i := 0; i < uploaders; i++ {
+		if albums := result[fmt.Sprint("album ", i)]; len(albums) != 1 || len(albums[0].Photos) != uploads/2 {
+			t.Errorf("album %d: expected a single album of %d photos, got %v", i, uploads/2, albums)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package synckr
+
+import (
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// buildUploadParams computes the optional upload parameters sent along with a photo.
+// The description is read from the sidecar of the photo, if any.
+// It returns nil when there is nothing to send so that flickr keeps applying the user's
+// default preferences, which it doesn't when parameters are provided.
+func buildUploadParams(config *Config, path string) *flickr.UploadParams {
+	var tags []string
+	if config.TagFromPath {
+		tags = append(tags, pathTags(config, path)...)
+	}
+
+	if config.PathMachineTag {
+		if tag := pathMachineTag(config, path); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	if config.batchID != "" {
+		tags = append(tags, batchMachineTag(config.batchID))
+	}
+
+	var title string
+	if config.PhotoTitleTemplate != "" || hasTitleRules(config) {
+		title = photoTitle(config, path)
+	}
+
+	description := sidecarDescription(config, path)
+
+	if len(tags) == 0 && title == "" && description == "" && !config.HiddenFromSearch {
+		return nil
+	}
+
+	params := flickr.NewUploadParams()
+	params.Title = title
+	params.Description = description
+	params.Tags = tags
+	if config.HiddenFromSearch {
+		params.Hidden = hiddenFromSearch
+	}
+	return params
+}
+
+// Values of the hidden upload parameter
+const (
+	visibleInSearch  = 1
+	hiddenFromSearch = 2
+)
+
+// searchVisibility returns the hidden upload parameter
+func searchVisibility(hidden bool) int {
+	if hidden {
+		return hiddenFromSearch
+	}
+	return visibleInSearch
+}
+
+// withTags adds tags to upload parameters, creating them when needed
+func withTags(params *flickr.UploadParams, tags ...string) *flickr.UploadParams {
+	if params == nil {
+		params = flickr.NewUploadParams()
+	}
+	params.Tags = append(params.Tags, tags...)
+	return params
+}
+
+// pathTags returns one tag per directory between PhotoLibraryPath and the photo
+func pathTags(config *Config, path string) []string {
+	rel, err := filepath.Rel(config.PhotoLibraryPath, filepath.Dir(path))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+
+	var tags []string
+	for _, component := range strings.Split(rel, string(filepath.Separator)) {
+		if tag := sanitizeTag(component); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// sanitizeTags sanitizes every tag of a list
+func sanitizeTags(tags []string) []string {
+	var result []string
+	for _, tag := range tags {
+		result = append(result, sanitizeTag(tag))
+	}
+	return result
+}
+
+// sanitizeTag makes a string usable as a flickr tag. Tags are sent space separated,
+// so tags containing spaces are double quoted, which flickr understands as a
+// single multi-words tag. Double quotes can't be escaped and are removed.
+func sanitizeTag(tag string) string {
+	tag = strings.Join(strings.Fields(strings.Replace(tag, "\"", "", -1)), " ")
+	if strings.Contains(tag, " ") {
+		return "\"" + tag + "\""
+	}
+	return tag
+}
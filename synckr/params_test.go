@@ -0,0 +1,106 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildUploadParamsTagFromPath(t *testing.T) {
+	root := filepath.FromSlash("/photos")
+	config := Config{PhotoLibraryPath: root, TagFromPath: true}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"album/a.jpg", []string{"album"}},
+		{"2023/Italy/Rome/a.jpg", []string{"2023", "Italy", "Rome"}},
+		{"2023/New York/Central  Park/a.jpg", []string{"2023", "\"New York\"", "\"Central Park\""}},
+		{"2023/\"quoted\"/a.jpg", []string{"2023", "quoted"}},
+	}
+	for _, tt := range tests {
+		params := buildUploadParams(&config, filepath.Join(root, filepath.FromSlash(tt.path)))
+		if params == nil {
+			t.Errorf("%s: params should be set", tt.path)
+			continue
+		}
+		if !reflect.DeepEqual(params.Tags, tt.expected) {
+			t.Errorf("%s: expected tags %v, got %v", tt.path, tt.expected, params.Tags)
+		}
+	}
+
+	if params := buildUploadParams(&config, filepath.Join(root, "a.jpg")); params != nil {
+		t.Errorf("Root files have no tags, params should be nil. Got %v", params)
+	}
+
+	config.TagFromPath = false
+	if params := buildUploadParams(&config, filepath.Join(root, "album", "a.jpg")); params != nil {
+		t.Errorf("Params should be nil when TagFromPath is disabled. Got %v", params)
+	}
+}
+
+func TestPathMachineTag(t *testing.T) {
+	config := Config{PhotoLibraryPath: "/photos", PathMachineTag: true}
+	params := buildUploadParams(&config, "/photos/2024/My Trip/IMG 1.jpg")
+	if params == nil || len(params.Tags) != 1 || params.Tags[0] != "synckr:path=2024/My%20Trip/IMG%201.jpg" {
+		t.Errorf("Unexpected path machine tag %v", params)
+	}
+
+	config.PathMachineTag = false
+	if params := buildUploadParams(&config, "/photos/2024/a.jpg"); params != nil {
+		t.Errorf("No machine tag should be sent unless enabled, got %v", params.Tags)
+	}
+}
+
+func TestSidecarDescription(t *testing.T) {
+	root := makeTree(t, "album/txt.jpg", "album/json.jpg", "album/both.jpg", "album/none.jpg")
+	defer os.RemoveAll(root)
+	write := func(name string, content string) {
+		ioutil.WriteFile(filepath.Join(root, "album", name), []byte(content), 0644)
+	}
+	write("txt.jpg.txt", "From the text sidecar\n")
+	write("json.jpg.json", `{"title": "json.jpg", "description": "From the JSON sidecar"}`)
+	write("both.jpg.txt", "Ignored")
+	write("both.jpg.json", `{"description": "JSON wins"}`)
+
+	config := testConfig(root)
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"txt.jpg", "From the text sidecar"},
+		{"json.jpg", "From the JSON sidecar"},
+		{"both.jpg", "JSON wins"},
+	}
+	for _, tt := range tests {
+		params := buildUploadParams(&config, filepath.Join(root, "album", tt.name))
+		if params == nil || params.Description != tt.expected {
+			t.Errorf("%s: expected description %q, got %v", tt.name, tt.expected, params)
+		}
+	}
+	if params := buildUploadParams(&config, filepath.Join(root, "album", "none.jpg")); params != nil {
+		t.Errorf("Photos without sidecar should keep the default params, got %v", params)
+	}
+}
+
+func TestProcessSendsSidecarDescription(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "album", "a.jpg.txt"), []byte("Sunrise"), 0644)
+
+	config := testConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, ph := range stub.photos {
+		if ph.Args.Get("description") != "Sunrise" {
+			t.Errorf("The sidecar description should be uploaded, got %q", ph.Args.Get("description"))
+		}
+	}
+}
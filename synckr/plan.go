@@ -0,0 +1,66 @@
+package synckr
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// PlanWriter writes what a dry run would change on flickr, one change per line:
+// "+" for uploads, "~" for metadata updates and "-" for deletions.
+// It is kept separate from the logs so that the plan is easy to parse
+type PlanWriter struct {
+	w io.Writer
+}
+
+// NewPlanWriter returns a PlanWriter writing to w
+func NewPlanWriter(w io.Writer) *PlanWriter {
+	return &PlanWriter{w}
+}
+
+// Upload records the upload of a file into an album
+func (p *PlanWriter) Upload(path string, album string) {
+	fmt.Fprintf(p.w, "+ upload %s → %s\n", path, album)
+}
+
+// Update records a metadata change, described by format and args
+func (p *PlanWriter) Update(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, "~ "+format+"\n", args...)
+}
+
+// Delete records the deletion of a duplicate photo from an album
+func (p *PlanWriter) Delete(album string, title string) {
+	fmt.Fprintf(p.w, "- delete dupe %s in %s\n", title, album)
+}
+
+// Remove records the removal of a photo from a mirrored album
+func (p *PlanWriter) Remove(album string, title string) {
+	fmt.Fprintf(p.w, "- remove %s from %s\n", title, album)
+}
+
+// DeleteAlbum records the deletion of an album left empty
+func (p *PlanWriter) DeleteAlbum(album string) {
+	fmt.Fprintf(p.w, "- delete empty album %s\n", album)
+}
+
+// openPlan returns the output of the plan of a dry run: PlanFile, or stdout when
+// it is not set. The returned function closes it
+func openPlan(config *Config) (io.Writer, func(), error) {
+	if config.PlanFile == "" {
+		return os.Stdout, func() {}, nil
+	}
+	file, err := os.Create(config.PlanFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// relPath returns the slash separated path of a file relative to PhotoLibraryPath
+func relPath(config *Config, path string) string {
+	if rel, err := filepath.Rel(config.PhotoLibraryPath, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(path)
+}
@@ -0,0 +1,43 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessDryRunPlan(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a", "a", "b")
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg")
+	defer os.RemoveAll(root)
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	config := testConfig(root)
+	config.DeleteDupes = true
+	config.DryRun = true
+	config.PlanFile = filepath.Join(dir, "plan.txt")
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("upload") != 0 || stub.count("flickr.photos.delete") != 0 {
+		t.Error("A dry run should not change anything on flickr")
+	}
+	raw, err := ioutil.ReadFile(config.PlanFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"- delete dupe a in album",
+		"+ upload album/c.jpg → album",
+	}
+	if lines := strings.Split(strings.TrimSpace(string(raw)), "\n"); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected plan %q, got %q", expected, lines)
+	}
+}
@@ -0,0 +1,119 @@
+package synckr
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// heldPhoto is a photo uploaded while the creation of its album failed. It is
+// added to the album once the next upload of the directory created it, or
+// once the walk is over
+type heldPhoto struct {
+	logger      *logrus.Entry
+	path        string
+	title       string
+	description string
+	tagged      []string
+	result      UploadResult
+}
+
+// countUpload records a photo which reached flickr in the metrics and the
+// per-run upload count
+func (r *syncRun) countUpload(result UploadResult) {
+	uploadsTotal.Inc()
+	bytesUploadedTotal.Add(uint64(result.BytesUploaded))
+	r.eta.Observe(result.Duration)
+	r.uploads++
+}
+
+// hold keeps a photo uploaded without album, so that its upload is not retried
+// only to fail creating the album again with it as primary photo
+func (r *syncRun) hold(currentDir string, photo heldPhoto) {
+	photo.logger.WithFields(logrus.Fields{
+		"photo.name": photo.title,
+		"photo.id":   photo.result.PhotoID,
+	}).Warn("[WARNING] Could not create album, retrying with the next photo as primary")
+	r.held[currentDir] = append(r.held[currentDir], photo)
+}
+
+// filed records a photo uploaded into its album
+func (r *syncRun) filed(logger *logrus.Entry, currentDir string, path string, title string, tagged []string, result UploadResult) error {
+	photo := FlickrPhoto{ID: result.PhotoID, Title: title}
+	if tag := pathMachineTag(r.config, path); r.config.PathMachineTag && tag != "" {
+		photo.Tags = []string{tag}
+	}
+	r.addPhoto(currentDir, result.AlbumID, photo)
+	r.addToCollection(path, result.AlbumID)
+	r.recordOrder(result.AlbumID, result.PhotoID, true)
+	r.indexUpload(logger, path, result)
+	if err := r.addToAlbums(tagged, photo); err != nil {
+		return err
+	}
+	r.afterUpload(logger, path)
+	return nil
+}
+
+// fileHeld adds the photos held for an album to it once it was created. Photos
+// which can't be added stay on flickr outside of any album
+func (r *syncRun) fileHeld(currentDir string, albumID string) error {
+	held := r.held[currentDir]
+	delete(r.held, currentDir)
+	for _, photo := range held {
+		if _, err := AppendPhotoIntoExistingAlbum(r.client, photo.logger, albumID, photo.result.PhotoID); err != nil {
+			if err == ErrAuthorization {
+				return err
+			}
+			continue
+		}
+		photo.result.AlbumID = albumID
+		if err := r.filed(photo.logger, currentDir, photo.path, photo.title, photo.tagged, photo.result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushHeld creates, once the walk is over, the albums photos are still held
+// for, with the first of them as primary photo. The photos left without album
+// are recorded as failures
+func (r *syncRun) flushHeld() error {
+	albums := make([]string, 0, len(r.held))
+	for album := range r.held {
+		albums = append(albums, album)
+	}
+	sort.Strings(albums)
+
+	for _, album := range albums {
+		held := r.held[album]
+		primary := held[0]
+		albumID, err := CreateAlbum(r.client, primary.logger, album, primary.description, primary.result.PhotoID)
+		if err == ErrAuthorization {
+			return err
+		}
+		if err == nil {
+			r.held[album] = held[1:]
+			primary.result.AlbumID = albumID
+			primary.result.AlbumCreated = true
+			if err := r.filed(primary.logger, album, primary.path, primary.title, primary.tagged, primary.result); err != nil {
+				return err
+			}
+			if err := r.fileHeld(album, albumID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		delete(r.held, album)
+		for _, photo := range held {
+			photo.logger.WithFields(logrus.Fields{
+				"path":       photo.path,
+				"photo.name": photo.title,
+				"photo.id":   photo.result.PhotoID,
+				"error":      err,
+			}).Error("[ERROR] Could not create album, photo left outside of any album")
+			r.recordFailure(photo.logger, photo.path, err, 0)
+		}
+	}
+	return nil
+}
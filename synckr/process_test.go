@@ -0,0 +1,475 @@
+package synckr
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestProcessStopsWhenUploadQuotaIsReached(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("existing", "a")
+	stub.hook("upload", func(args url.Values) string {
+		return stubError(uploadLimitErrorCode, "User exceeded upload limit")
+	})
+
+	root := makeTree(t, "existing/a.jpg", "existing/b.jpg", "one/c.jpg", "one/d.jpg", "two/e.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UploadAttempts = 3
+	fromFlickr, err := Process(&config, stub.client(), nil)
+	if err != ErrUploadQuota {
+		t.Errorf("Expected ErrUploadQuota, got %v", err)
+	}
+	if stub.count("upload") != 1 {
+		t.Errorf("No upload should be attempted once the quota is reached, got %d", stub.count("upload"))
+	}
+	if len(fromFlickr["existing"][0].Photos) != 1 {
+		t.Errorf("The partial map should still be returned, got %v", fromFlickr)
+	}
+}
+
+func TestProcessSameTitledAlbums(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	first := stub.addSet("trip", "a")
+	second := stub.addSet("trip", "b")
+
+	root := makeTree(t, "trip/a.jpg", "trip/b.jpg", "trip/c.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromFlickr["trip"]) != 2 || fromFlickr["trip"][0].ID != first || fromFlickr["trip"][1].ID != second {
+		t.Fatalf("Both albums titled trip should be retained, got %v", fromFlickr)
+	}
+
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 1 {
+		t.Errorf("Only c should be uploaded, got %d uploads", stub.count("upload"))
+	}
+	if titles := stub.titles(stub.findSet(first)); len(titles) != 2 || titles[1] != "c" {
+		t.Errorf("c should be added to the first album, got %v", titles)
+	}
+}
+
+func TestProcessReconcileOrphans(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	existing := stub.addSet("existing", "a")
+	orphanB := stub.addPhoto("b")
+	orphanC := stub.addPhoto("c")
+
+	root := makeTree(t, "existing/a.jpg", "existing/b.jpg", "new/c.jpg", "new/d.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.ReconcileOrphans = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("upload") != 1 {
+		t.Errorf("Only d should be uploaded, got %d uploads", stub.count("upload"))
+	}
+	if set := stub.findSet(existing); len(set.Photos) != 2 || set.Photos[1] != orphanB {
+		t.Errorf("b should be added to its existing album, got %v", set.Photos)
+	}
+	if set := stub.set("new"); set == nil || set.Photos[0] != orphanC || len(set.Photos) != 2 {
+		t.Errorf("The new album should be created around c, got %v", set)
+	}
+}
+
+func TestProcessOrphansIgnoredByDefault(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("existing", "a")
+	stub.addPhoto("b")
+
+	root := makeTree(t, "existing/a.jpg", "existing/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("flickr.photos.getNotInSet") != 0 || stub.count("upload") != 1 {
+		t.Errorf("Orphans should only be looked up with ReconcileOrphans, got %d lookups and %d uploads",
+			stub.count("flickr.photos.getNotInSet"), stub.count("upload"))
+	}
+}
+
+func TestProcessSkipHidden(t *testing.T) {
+	tests := []struct {
+		skipHidden bool
+		expected   int
+	}{
+		{true, 2},
+		{false, 5},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/a.jpg", "album/.hidden.jpg", "album/.thumbs/b.jpg", ".git/c.jpg", "visible/d.jpg")
+
+		config := testConfig(root)
+		config.SkipHidden = tt.skipHidden
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if stub.count("upload") != tt.expected {
+			t.Errorf("SkipHidden %v: expected %d uploads, got %d", tt.skipHidden, tt.expected, stub.count("upload"))
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestProcessExcludeGlobs(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.tmp.jpg", "album/private/c.jpg", "other/d.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.ExcludeGlobs = []string{"*.tmp.jpg", "album/private", "other"}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stub.titles(stub.set("album")); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Expected only a to be uploaded to album, got %v", got)
+	}
+	for _, title := range []string{"private", "other"} {
+		if stub.set(title) != nil {
+			t.Errorf("Excluded directory %s should not have been uploaded", title)
+		}
+	}
+
+	config.ExcludeGlobs = []string{"["}
+	if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+		t.Errorf("An invalid glob should fail the run with an ErrConfig, got %v", err)
+	}
+}
+
+func TestProcessMaxDepth(t *testing.T) {
+	tests := []struct {
+		maxDepth int
+		expected []string
+	}{
+		{1, []string{"a"}},
+		{2, []string{"a", "b"}},
+		{0, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "one/a.jpg", "one/two/b.jpg", "one/two/three/c.jpg")
+
+		config := testConfig(root)
+		config.MaxDepth = tt.maxDepth
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		var uploaded []string
+		for _, title := range []string{"one", "two", "three"} {
+			if set := stub.set(title); set != nil {
+				uploaded = append(uploaded, stub.titles(set)...)
+			}
+		}
+		if !reflect.DeepEqual(uploaded, tt.expected) {
+			t.Errorf("MaxDepth %d: expected %v, got %v", tt.maxDepth, tt.expected, uploaded)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestProcessRecognizesPathMachineTags(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/B.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.PathMachineTag = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photos := fromFlickr["album"][0].Photos
+	if len(photos) != 2 || photos[0].taggedPath() != "synckr:path=album/b.jpg" || photos[1].taggedPath() != "synckr:path=album/a.jpg" {
+		t.Fatalf("The path machine tags should be retrieved, got %v", photos)
+	}
+
+	// Titles changed since the first run, the uploads are still recognized
+	config.PhotoTitleTemplate = "{dir} {filename}"
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("Tagged photos should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestProcessMaxUploadsPerRun(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("existing", "a")
+
+	root := makeTree(t, "existing/a.jpg", "existing/b.jpg", "one/c.jpg", "one/d.jpg", "two/e.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.MaxUploadsPerRun = 3
+	fromFlickr, err := Process(&config, stub.client(), nil)
+	if err != nil {
+		t.Errorf("Reaching the cap should not be an error, got %v", err)
+	}
+	if stub.count("upload") != 3 {
+		t.Errorf("Expected exactly 3 uploads, got %d", stub.count("upload"))
+	}
+	if len(fromFlickr["existing"][0].Photos) != 2 || len(fromFlickr["one"][0].Photos) != 2 {
+		t.Errorf("The partial map should be returned, got %v", fromFlickr)
+	}
+
+	// The next run resumes with the remaining file
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 4 || stub.set("two") == nil {
+		t.Errorf("The next run should upload the remaining file, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestProcessFileLimit(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	var files []string
+	for i := 0; i < 20; i++ {
+		files = append(files, fmt.Sprintf("album/%02d.jpg", i))
+	}
+	root := makeTree(t, files...)
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.FileLimit = 5
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Errorf("Reaching the file limit should not be an error, got %v", err)
+	}
+	if stub.count("upload") != 5 || len(stub.titles(stub.set("album"))) != 5 {
+		t.Errorf("Expected exactly 5 files processed, got %d uploads", stub.count("upload"))
+	}
+}
+
+func TestProcessAbortsWhenTokenIsRejected(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	// The token is revoked once the first photo was uploaded
+	stub.hook("upload", func(args url.Values) string {
+		if stub.count("upload") > 1 {
+			return stubError(invalidAuthTokenErrorCode, "Invalid auth token")
+		}
+		return ""
+	})
+
+	root := makeTree(t, "one/a.jpg", "one/b.jpg", "two/c.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UploadAttempts = 3
+	_, err := Process(&config, stub.client(), nil)
+	if err != ErrAuthorization {
+		t.Errorf("Expected ErrAuthorization, got %v", err)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("Uploads should neither be retried nor attempted once the token is rejected, got %d", stub.count("upload"))
+	}
+}
+
+func TestProcessFailedUploadsCreateNoAlbum(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.hook("upload", func(args url.Values) string {
+		return stubError(105, "Service currently unavailable")
+	})
+
+	root := makeTree(t, "failing/a.jpg", "failing/b.jpg", "other/c.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UploadAttempts = 2
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 9 {
+		t.Errorf("Every upload should be attempted, got %d", stub.count("upload"))
+	}
+	if stub.count("flickr.photosets.create") != 0 {
+		t.Errorf("No album should be created when every upload of a directory failed, got %d albums", stub.count("flickr.photosets.create"))
+	}
+}
+
+func TestProcessPrimaryPhotoUploadFails(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	// Every attempt to upload the first photo fails
+	stub.hook("upload", func(args url.Values) string {
+		if stub.count("upload") <= 3 {
+			return stubError(105, "Service currently unavailable")
+		}
+		return ""
+	})
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UploadAttempts = 2
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	set := stub.set("album")
+	if set == nil || stub.count("flickr.photosets.create") != 1 {
+		t.Fatalf("The album should be created once, got %d creations", stub.count("flickr.photosets.create"))
+	}
+	if primary := stub.photos[set.Photos[0]]; primary.Title != "b" || len(set.Photos) != 1 {
+		t.Errorf("The album should be created with b as primary photo, got %v", stub.titles(set))
+	}
+}
+
+func TestProcessRetriesAlbumCreation(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.hook("flickr.photosets.create", func(args url.Values) string {
+		if stub.count("flickr.photosets.create") == 1 {
+			return stubError(105, "Service currently unavailable")
+		}
+		return ""
+	})
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.UploadAttempts = 2
+	fromFlickr, err := Process(&config, stub.client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("A photo uploaded without album should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+	set := stub.set("album")
+	if set == nil || stub.photos[set.Photos[0]].Title != "b" {
+		t.Fatal("The album should be created with the next photo as primary")
+	}
+	titles := stub.titles(set)
+	sort.Strings(titles)
+	if !reflect.DeepEqual(titles, []string{"a", "b"}) {
+		t.Errorf("The first photo should be added once the album exists, got %v", titles)
+	}
+	if len(fromFlickr["album"]) != 1 || len(fromFlickr["album"][0].Photos) != 2 {
+		t.Errorf("Both photos should be recorded in the album, got %v", fromFlickr["album"])
+	}
+}
+
+func TestProcessFlushesHeldPhotos(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected []string
+		failed   bool
+	}{
+		// The creation fails with every photo, but not once the walk is over
+		{2, []string{"a", "b"}, false},
+		{3, nil, true},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		stub.hook("flickr.photosets.create", func(args url.Values) string {
+			if stub.count("flickr.photosets.create") <= tt.failures {
+				return stubError(105, "Service currently unavailable")
+			}
+			return ""
+		})
+		root := makeTree(t, "album/a.jpg", "album/b.jpg")
+
+		config := testConfig(root)
+		config.FailuresFile = filepath.Join(root, "failures.json")
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if stub.count("upload") != 2 {
+			t.Errorf("%d failures: held photos should not be uploaded again, got %d uploads", tt.failures, stub.count("upload"))
+		}
+		var titles []string
+		if set := stub.set("album"); set != nil {
+			titles = stub.titles(set)
+			sort.Strings(titles)
+		}
+		if !reflect.DeepEqual(titles, tt.expected) {
+			t.Errorf("%d failures: expected the album %v, got %v", tt.failures, tt.expected, titles)
+		}
+		failures, _ := loadFailures(config.FailuresFile)
+		if tt.failed && len(failures) != 2 || !tt.failed && len(failures) != 0 {
+			t.Errorf("%d failures: expected failed %v, got %v", tt.failures, tt.failed, failures)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestProcessHonorsNoMedia(t *testing.T) {
+	tests := []struct {
+		honor    bool
+		expected []string
+	}{
+		{true, []string{"a", "d"}},
+		{false, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "one/a.jpg", "scratch/b.jpg", "scratch/nested/c.jpg", "two/d.jpg", "scratch/.nomedia")
+
+		config := testConfig(root)
+		config.HonorNoMedia = tt.honor
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		var uploaded []string
+		for _, title := range []string{"one", "scratch", "nested", "two"} {
+			if set := stub.set(title); set != nil {
+				uploaded = append(uploaded, stub.titles(set)...)
+			}
+		}
+		if !reflect.DeepEqual(uploaded, tt.expected) {
+			t.Errorf("HonorNoMedia %v: expected %v, got %v", tt.honor, tt.expected, uploaded)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
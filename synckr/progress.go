@@ -0,0 +1,81 @@
+package synckr
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultETAWindow is the number of recent uploads averaged by the ETA when
+// ETAWindow is not set
+const defaultETAWindow = 20
+
+// etaEstimator predicts the time left from the moving average of the durations
+// of the last uploads
+type etaEstimator struct {
+	durations []time.Duration
+	next      int
+	count     int
+	sum       time.Duration
+}
+
+func newETAEstimator(window int) *etaEstimator {
+	if window < 1 {
+		window = defaultETAWindow
+	}
+	return &etaEstimator{durations: make([]time.Duration, window)}
+}
+
+// Observe records the duration of an upload, replacing the oldest one once the
+// window is full
+func (e *etaEstimator) Observe(d time.Duration) {
+	if e.count == len(e.durations) {
+		e.sum -= e.durations[e.next]
+	} else {
+		e.count++
+	}
+	e.durations[e.next] = d
+	e.sum += d
+	e.next = (e.next + 1) % len(e.durations)
+}
+
+// Average returns the average duration of the uploads in the window, zero
+// before the first one
+func (e *etaEstimator) Average() time.Duration {
+	if e.count == 0 {
+		return 0
+	}
+	return e.sum / time.Duration(e.count)
+}
+
+// Estimate returns the time needed by the remaining uploads, one after the other
+func (e *etaEstimator) Estimate(remaining int) time.Duration {
+	return e.Average() * time.Duration(remaining)
+}
+
+// startProgress counts the files of the library so that progress lines can
+// tell how many are left
+func (r *syncRun) startProgress() {
+	r.total, _ = countLocalPhotos(r.config, r.config.PhotoLibraryPath, true)
+	r.lastProgress = time.Now()
+}
+
+// logProgress logs how many files were processed, every ProgressInterval.
+// The ETA assumes the remaining files need an upload in the same proportion as
+// the processed ones
+func (r *syncRun) logProgress() {
+	if r.config.ProgressInterval <= 0 || time.Since(r.lastProgress) < r.config.ProgressInterval*time.Second {
+		return
+	}
+	r.lastProgress = time.Now()
+
+	fields := logrus.Fields{
+		"processed": r.processed,
+		"total":     r.total,
+		"uploaded":  r.uploads,
+	}
+	if remaining := r.total - r.processed; remaining > 0 && r.processed > 0 && r.eta.Average() > 0 {
+		fields["eta"] = r.eta.Estimate(remaining * r.uploads / r.processed).Round(time.Second).String()
+	}
+	r.log.WithFields(fields).Info("[OK] Progress")
+}
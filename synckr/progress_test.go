@@ -0,0 +1,73 @@
+package synckr
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestETAEstimator(t *testing.T) {
+	eta := newETAEstimator(3)
+	if eta.Estimate(10) != 0 {
+		t.Error("No estimate is possible before the first upload")
+	}
+
+	tests := []struct {
+		duration time.Duration
+		average  time.Duration
+	}{
+		{1 * time.Second, 1 * time.Second},
+		{2 * time.Second, 1500 * time.Millisecond},
+		{3 * time.Second, 2 * time.Second},
+		// The window is full, the oldest durations are dropped
+		{7 * time.Second, 4 * time.Second},
+		{8 * time.Second, 6 * time.Second},
+		{3 * time.Second, 6 * time.Second},
+	}
+	for i, tt := range tests {
+		eta.Observe(tt.duration)
+		if eta.Average() != tt.average {
+			t.Errorf("%d: expected an average of %v, got %v", i, tt.average, eta.Average())
+		}
+		if eta.Estimate(5) != 5*tt.average {
+			t.Errorf("%d: expected %v for 5 uploads, got %v", i, 5*tt.average, eta.Estimate(5))
+		}
+	}
+
+	if len(newETAEstimator(0).durations) != defaultETAWindow {
+		t.Error("The window should default to defaultETAWindow")
+	}
+}
+
+func TestLogProgress(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	config := testConfig("/photos")
+	config.ProgressInterval = 60
+	r := newSyncRun(&config, nil, nil, logger)
+	r.total, r.processed, r.uploads = 10, 4, 2
+	r.eta.Observe(3 * time.Second)
+
+	r.lastProgress = time.Now()
+	r.logProgress()
+	if out.Len() != 0 {
+		t.Errorf("Nothing should be logged before ProgressInterval, got %s", out.String())
+	}
+
+	r.lastProgress = time.Now().Add(-time.Minute)
+	r.logProgress()
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	// Half of the 6 remaining files should need an upload, 3s each
+	if entry["eta"] != "9s" || entry["processed"] != 4.0 || entry["total"] != 10.0 {
+		t.Errorf("Unexpected progress line %v", entry)
+	}
+}
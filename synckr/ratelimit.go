@@ -0,0 +1,73 @@
+package synckr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sleep waits between two attempts. Tests replace it
+var sleep = time.Sleep
+
+// rateLimitError is returned for the requests flickr refused because of its rate
+// limit, telling when to try again
+type rateLimitError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("rate limited by flickr (HTTP %d), retry after %s", e.status, e.retryAfter)
+}
+
+// retryAfterTransport turns the 429 and 503 responses carrying a Retry-After
+// header into a rateLimitError
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return resp, err
+	}
+	wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return nil, &rateLimitError{resp.StatusCode, wait}
+}
+
+// parseRetryAfter parses a Retry-After header, either a number of seconds or a
+// date. A date already past is no wait
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// retryDelay returns the wait flickr asked for when err is a rateLimitError,
+// fallback otherwise
+func retryDelay(err error, fallback time.Duration) time.Duration {
+	var limited *rateLimitError
+	if errors.As(err, &limited) {
+		return limited.retryAfter
+	}
+	return fallback
+}
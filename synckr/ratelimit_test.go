@@ -0,0 +1,84 @@
+package synckr
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// recordSleeps replaces sleep with a recorder, the returned function restores it
+func recordSleeps(waits *[]time.Duration) func() {
+	original := sleep
+	sleep = func(d time.Duration) { *waits = append(*waits, d) }
+	return func() { sleep = original }
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"Fri, 01 May 2020 12:00:30 GMT", 30 * time.Second, true},
+		{"Fri, 01 May 2020 11:00:00 GMT", 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if wait, ok := parseRetryAfter(tt.value, now); wait != tt.expected || ok != tt.ok {
+			t.Errorf("%q: expected %s %v, got %s %v", tt.value, tt.expected, tt.ok, wait, ok)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.UploadAttempts = 2
+	config.UploadInterval = 30
+	config.RetrieveAttempts = 2
+	config.RetrieveInterval = 10
+
+	u, _ := url.Parse(stub.server.URL)
+	client := stub.client()
+	client.HTTPClient = NewHTTPClient(&config, flickr.RewriteTransport{URL: u})
+
+	var waits []time.Duration
+	defer recordSleeps(&waits)()
+
+	// The album list and the first upload are rate limited, the first attempt
+	// of the second upload fails
+	stub.rateLimit("flickr.photosets.getList", "3")
+	stub.rateLimit("upload", "7")
+	stub.hook("upload", func(args url.Values) string {
+		if stub.count("upload") == 3 {
+			return stubError(105, "Service currently unavailable")
+		}
+		return ""
+	})
+
+	if _, err := Process(&config, client, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a Retry-After, the upload falls back to UploadInterval
+	expected := []time.Duration{3 * time.Second, 7 * time.Second, 30 * time.Second}
+	if !reflect.DeepEqual(waits, expected) {
+		t.Errorf("Expected the waits %v, got %v", expected, waits)
+	}
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, []string{"a", "b", "c"}) {
+		t.Errorf("The photos should be uploaded once the waits are over, got %v", titles)
+	}
+}
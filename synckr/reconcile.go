@@ -0,0 +1,180 @@
+package synckr
+
+import (
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// photoInfoResponse is the response of flickr.photos.getInfo, reduced to the
+// metadata synckr reconciles
+type photoInfoResponse struct {
+	flickr.BasicResponse
+	Photo struct {
+		ID          string `xml:"id,attr"`
+		Title       string `xml:"title"`
+		Description string `xml:"description"`
+		Tags        []struct {
+			Raw        string `xml:"raw,attr"`
+			MachineTag string `xml:"machine_tag,attr"`
+		} `xml:"tags>tag"`
+	} `xml:"photo"`
+}
+
+func getPhotoInfo(client *flickr.FlickrClient, photoID string) (*photoInfoResponse, error) {
+	client.Init()
+	client.Args.Set("method", "flickr.photos.getInfo")
+	client.Args.Set("photo_id", photoID)
+	client.OAuthSign()
+
+	response := &photoInfoResponse{}
+	err := flickr.DoGet(client, response)
+	return response, err
+}
+
+func setPhotoMeta(client *flickr.FlickrClient, photoID string, title string, description string) (*flickr.BasicResponse, error) {
+	client.Init()
+	client.HTTPVerb = "POST"
+	client.Args.Set("method", "flickr.photos.setMeta")
+	client.Args.Set("photo_id", photoID)
+	client.Args.Set("title", title)
+	client.Args.Set("description", description)
+	client.OAuthSign()
+	response := &flickr.BasicResponse{}
+	err := flickr.DoPost(client, response)
+	return response, err
+}
+
+func setPhotoTags(client *flickr.FlickrClient, photoID string, tags []string) (*flickr.BasicResponse, error) {
+	client.Init()
+	client.HTTPVerb = "POST"
+	client.Args.Set("method", "flickr.photos.setTags")
+	client.Args.Set("photo_id", photoID)
+	client.Args.Set("tags", strings.Join(tags, " "))
+	client.OAuthSign()
+	response := &flickr.BasicResponse{}
+	err := flickr.DoPost(client, response)
+	return response, err
+}
+
+// isMachineTag tells whether a tag is a namespace:predicate=value machine tag
+func isMachineTag(tag string) bool {
+	return strings.Contains(tag, ":") && strings.Contains(tag, "=")
+}
+
+// plainTags returns the tags of upload parameters which are not machine tags,
+// lowercased and unquoted the way flickr returns the raw tags of a photo
+func plainTags(params *flickr.UploadParams) map[string]bool {
+	tags := make(map[string]bool)
+	if params == nil {
+		return tags
+	}
+	for _, tag := range params.Tags {
+		if !isMachineTag(tag) {
+			tags[strings.ToLower(strings.Trim(tag, "\""))] = true
+		}
+	}
+	return tags
+}
+
+// findTagged returns the photo of fromFlickr uploaded with a lowercased path
+// machine tag
+func (r *syncRun) findTagged(tag string) (FlickrPhoto, bool) {
+	for _, albums := range r.fromFlickr {
+		for _, album := range albums {
+			for _, photo := range album.Photos {
+				if photo.taggedPath() == tag {
+					return photo, true
+				}
+			}
+		}
+	}
+	return FlickrPhoto{}, false
+}
+
+// reconcileMetadata updates the title, the description and the tags of a photo
+// already on flickr when they differ from the ones it would be uploaded with.
+// Empty descriptions and tags are not desired values: they leave the photo as is.
+// Machine tags are kept, they record what synckr knows about the photo
+func (r *syncRun) reconcileMetadata(logger logrus.FieldLogger, photo FlickrPhoto, title string, params *flickr.UploadParams) error {
+	info, err := getPhotoInfo(r.client, photo.ID)
+	if err != nil {
+		if isAuthError(info) {
+			logger.Error(authFailedMessage)
+			return ErrAuthorization
+		}
+		logger.WithFields(logrus.Fields{
+			"photo.name": photo.Title,
+			"error":      err,
+		}).Warn("[WARNING] Could not retrieve photo metadata")
+		return nil
+	}
+
+	description := info.Photo.Description
+	if params != nil && params.Title != "" {
+		title = params.Title
+	}
+	if params != nil && params.Description != "" {
+		description = params.Description
+	}
+
+	current := make(map[string]bool)
+	var machineTags []string
+	for _, tag := range info.Photo.Tags {
+		if tag.MachineTag == "1" || isMachineTag(tag.Raw) {
+			machineTags = append(machineTags, tag.Raw)
+			continue
+		}
+		current[strings.ToLower(tag.Raw)] = true
+	}
+	desired := plainTags(params)
+	tagsDiffer := len(desired) > 0 && len(desired) != len(current)
+	for tag := range desired {
+		if !current[tag] {
+			tagsDiffer = true
+		}
+	}
+
+	if title != info.Photo.Title || description != info.Photo.Description {
+		if r.plan != nil {
+			r.plan.Update("meta %s → %q", photo.Title, title)
+		} else if resp, err := setPhotoMeta(r.client, photo.ID, title, description); err != nil {
+			if isAuthError(resp) {
+				logger.Error(authFailedMessage)
+				return ErrAuthorization
+			}
+			logger.WithFields(logrus.Fields{
+				"photo.name": photo.Title,
+				"error":      err,
+			}).Error("[ERROR] Could not update photo metadata")
+		} else {
+			logger.WithField("photo.name", title).Info("[OK] Photo metadata updated")
+		}
+	}
+
+	if tagsDiffer {
+		var tags []string
+		for _, tag := range params.Tags {
+			if !isMachineTag(tag) {
+				tags = append(tags, tag)
+			}
+		}
+		if r.plan != nil {
+			r.plan.Update("tags %s → %s", photo.Title, strings.Join(tags, " "))
+		} else if resp, err := setPhotoTags(r.client, photo.ID, append(tags, machineTags...)); err != nil {
+			if isAuthError(resp) {
+				logger.Error(authFailedMessage)
+				return ErrAuthorization
+			}
+			logger.WithFields(logrus.Fields{
+				"photo.name": photo.Title,
+				"error":      err,
+			}).Error("[ERROR] Could not update photo tags")
+		} else {
+			logger.WithField("photo.name", title).Info("[OK] Photo tags updated")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessMetadataOnly(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a", "b")
+	a, b := stub.photos[stub.set("album").Photos[0]], stub.photos[stub.set("album").Photos[1]]
+	a.setArg("description", "Old description")
+	a.setArg("tags", "beach synckr:path=album/a.jpg")
+	b.setArg("description", "Night")
+	b.setArg("tags", "day")
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "album", "a.jpg.txt"), []byte("New description"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "album", "b.jpg.txt"), []byte("Night"), 0644)
+	csvPath := filepath.Join(root, "metadata.csv")
+	ioutil.WriteFile(csvPath, []byte("path,tags\nalbum/a.jpg,beach\nalbum/b.jpg,night\n"), 0644)
+
+	config := testConfig(root)
+	config.MetadataCSV = csvPath
+	config.MetadataOnly = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("upload") != 0 {
+		t.Errorf("Nothing should be uploaded, got %d uploads", stub.count("upload"))
+	}
+	if stub.count("flickr.photos.setMeta") != 1 || a.Args.Get("description") != "New description" {
+		t.Errorf("Only the description of a should be updated, got %d calls and %q", stub.count("flickr.photos.setMeta"), a.Args.Get("description"))
+	}
+	if stub.count("flickr.photos.setTags") != 1 || b.Args.Get("tags") != "night" {
+		t.Errorf("Only the tags of b should be updated, got %d calls and %q", stub.count("flickr.photos.setTags"), b.Args.Get("tags"))
+	}
+	if a.Args.Get("tags") != "beach synckr:path=album/a.jpg" {
+		t.Errorf("The machine tags should be kept, got %q", a.Args.Get("tags"))
+	}
+
+	// The photos now have their desired metadata
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("flickr.photos.setMeta") != 1 || stub.count("flickr.photos.setTags") != 1 {
+		t.Errorf("Up to date photos should not be edited, got %d setMeta and %d setTags",
+			stub.count("flickr.photos.setMeta"), stub.count("flickr.photos.setTags"))
+	}
+}
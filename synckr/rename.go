@@ -0,0 +1,130 @@
+package synckr
+
+import (
+	"path/filepath"
+
+	"gopkg.in/masci/flickr.v2/photosets"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultRenameThreshold is the share of common photo titles above which a local
+// directory is considered a renamed flickr album, when RenameThreshold is not set
+const defaultRenameThreshold = 0.8
+
+// renameCandidate is a flickr album which may be the previous name of a directory
+type renameCandidate struct {
+	title string
+	album FlickrPhotoset
+}
+
+// detectRename renames the flickr album matching the photos of dir to title, when
+// title is not on flickr yet and the photos of exactly one other album strongly
+// overlap with the local ones. Directories are only checked once
+func (r *syncRun) detectRename(logger *logrus.Entry, dir string, title string) {
+	if r.renameChecked[title] {
+		return
+	}
+	r.renameChecked[title] = true
+
+	local := r.localTitles(dir)
+	if len(local) == 0 {
+		return
+	}
+
+	threshold := r.config.RenameThreshold
+	if threshold <= 0 {
+		threshold = defaultRenameThreshold
+	}
+
+	var candidates []renameCandidate
+	for flickrTitle, albums := range r.fromFlickr {
+		if flickrTitle == title {
+			continue
+		}
+		for _, album := range albums {
+			if titleOverlap(local, album) >= threshold {
+				candidates = append(candidates, renameCandidate{flickrTitle, album})
+			}
+		}
+	}
+
+	if len(candidates) > 1 {
+		var titles []string
+		for _, c := range candidates {
+			titles = append(titles, c.title)
+		}
+		logger.WithField("candidates", titles).Warn("[WARNING] Ambiguous album rename, creating a new album")
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	previous := candidates[0]
+	// The previous directory still exists: both albums live side by side
+	if _, err := statLibraryFile(r.config, filepath.Join(filepath.Dir(dir), previous.title)); err == nil {
+		return
+	}
+
+	if r.plan != nil {
+		r.plan.Update("rename album %s → %s", previous.title, title)
+	} else {
+		if _, err := photosets.EditMeta(r.client, previous.album.ID, title, ""); err != nil {
+			logger.WithFields(logrus.Fields{
+				"album.previous": previous.title,
+				"error":          err,
+			}).Error("[ERROR] Could not rename album")
+			return
+		}
+		logger.WithFields(logrus.Fields{
+			"album.previous": previous.title,
+			"album.id":       previous.album.ID,
+		}).Info("[OK] Album renamed")
+	}
+
+	var remaining []FlickrPhotoset
+	for _, album := range r.fromFlickr[previous.title] {
+		if album.ID != previous.album.ID {
+			remaining = append(remaining, album)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(r.fromFlickr, previous.title)
+	} else {
+		r.fromFlickr[previous.title] = remaining
+	}
+	r.fromFlickr[title] = append(r.fromFlickr[title], previous.album)
+}
+
+// localTitles returns the titles of the photos directly in dir
+func (r *syncRun) localTitles(dir string) map[string]bool {
+	titles := make(map[string]bool)
+	entries, err := readLibraryDir(r.config, dir)
+	if err != nil {
+		return titles
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() && hasAllowedExtension(r.config, path) && !isHidden(r.config, path) {
+			titles[r.photoTitle(path)] = true
+		}
+	}
+	return titles
+}
+
+// titleOverlap returns the number of titles shared by the local photos and the
+// album, relative to the larger of the two
+func titleOverlap(local map[string]bool, album FlickrPhotoset) float64 {
+	common := 0
+	for _, ph := range album.Photos {
+		if local[ph.Title] {
+			common++
+		}
+	}
+	size := len(local)
+	if len(album.Photos) > size {
+		size = len(album.Photos)
+	}
+	return float64(common) / float64(size)
+}
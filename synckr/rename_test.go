@@ -0,0 +1,52 @@
+package synckr
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDetectRenames(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	renamed := stub.addSet("Holidays", "a", "b", "c", "d", "e")
+
+	root := makeTree(t, "Summer 2024/a.jpg", "Summer 2024/b.jpg", "Summer 2024/c.jpg", "Summer 2024/d.jpg", "Summer 2024/e.jpg", "Summer 2024/f.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.DetectRenames = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	set := stub.findSet(renamed)
+	if set.Title != "Summer 2024" || len(set.Photos) != 6 {
+		t.Errorf("The album should be renamed and only f uploaded into it, got %+v", set)
+	}
+	if stub.count("upload") != 1 || stub.count("flickr.photosets.create") != 0 {
+		t.Errorf("Expected 1 upload and no album creation, got %d and %d", stub.count("upload"), stub.count("flickr.photosets.create"))
+	}
+}
+
+func TestDetectRenamesAmbiguous(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("Holidays", "a", "b", "c", "d")
+	stub.addSet("Holidays copy", "a", "b", "c", "d")
+
+	root := makeTree(t, "Summer/a.jpg", "Summer/b.jpg", "Summer/c.jpg", "Summer/d.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.DetectRenames = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("flickr.photosets.editMeta") != 0 {
+		t.Error("No album should be renamed when several match")
+	}
+	if stub.set("Summer") == nil || stub.count("upload") != 4 {
+		t.Errorf("A new album should be created, got %d uploads", stub.count("upload"))
+	}
+}
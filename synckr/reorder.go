@@ -0,0 +1,20 @@
+package synckr
+
+import (
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// reorderAlbum sets the order of the photos of an album, which the flickr library
+// does not implement. Photos missing from orderedIDs are left where flickr puts them
+func reorderAlbum(client *flickr.FlickrClient, albumID string, orderedIDs []string) error {
+	client.Init()
+	client.HTTPVerb = "POST"
+	client.Args.Set("method", "flickr.photosets.reorderPhotos")
+	client.Args.Set("photoset_id", albumID)
+	client.Args.Set("photo_ids", strings.Join(orderedIDs, ","))
+	client.OAuthSign()
+
+	return flickr.DoPost(client, &flickr.BasicResponse{})
+}
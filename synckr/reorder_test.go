@@ -0,0 +1,50 @@
+package synckr
+
+import (
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnforcePhotoOrder(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "b")
+	stub.addSet("complete", "x")
+
+	var sent [][]string
+	stub.hook("flickr.photosets.reorderPhotos", func(args url.Values) string {
+		sent = append(sent, strings.Split(args.Get("photo_ids"), ","))
+		return ""
+	})
+
+	root := makeTree(t, "album/c.jpg", "album/a.jpg", "album/b.jpg", "complete/x.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.EnforcePhotoOrder = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 1 {
+		t.Fatalf("Only the album which received photos should be reordered, got %v", sent)
+	}
+	set := stub.set("album")
+	var ids []string
+	for _, title := range []string{"a", "b", "c"} {
+		for _, id := range set.Photos {
+			if stub.photos[id].Title == title {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if !reflect.DeepEqual(sent[0], ids) {
+		t.Errorf("Expected the IDs of a, b and c in order %v, got %v", ids, sent[0])
+	}
+	if titles := stub.titles(set); !reflect.DeepEqual(titles, []string{"a", "b", "c"}) {
+		t.Errorf("The album should follow the local order, got %v", titles)
+	}
+}
@@ -0,0 +1,164 @@
+package synckr
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/masci/flickr.v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// titleRepair is the title a photo of flickr should have according to its local
+// file
+type titleRepair struct {
+	Path  string
+	Photo FlickrPhoto
+	Title string
+}
+
+// dotCutTitle returns the title of a file when PhotoTitleTemplate is not set:
+// its name up to the first dot, which turns "2008.01.02 beach.jpg" into "2008"
+func dotCutTitle(config *Config, path string) string {
+	return normalizeTitle(config, cleanFilename(config, strings.Split(filepath.Base(path), ".")[0]))
+}
+
+// matchTitleRepairs pairs the local files whose title differs from their dot
+// cut title with the photos of their album still titled after the latter.
+// paths are in upload order, titles holds their expected title. The files
+// sharing a dot cut title are paired in upload order with the photos having it,
+// by increasing IDs: a file whose title is its dot cut title keeps its photo.
+// Files already having their title on flickr are left alone, and so are the
+// files beyond the photos, which the next sync uploads
+func matchTitleRepairs(config *Config, paths []string, titles map[string]string, photos []FlickrPhoto) []titleRepair {
+	onFlickr := make(map[string]int)
+	byTitle := make(map[string][]FlickrPhoto)
+	for _, ph := range photos {
+		onFlickr[ph.Title]++
+		byTitle[ph.Title] = append(byTitle[ph.Title], ph)
+	}
+
+	var wrongTitles []string
+	files := make(map[string][]string)
+	for _, path := range paths {
+		wrong := dotCutTitle(config, path)
+		title := titles[path]
+		if wrong != title && onFlickr[title] > 0 {
+			onFlickr[title]--
+			continue
+		}
+		if files[wrong] == nil {
+			wrongTitles = append(wrongTitles, wrong)
+		}
+		files[wrong] = append(files[wrong], path)
+	}
+
+	var repairs []titleRepair
+	for _, wrong := range wrongTitles {
+		candidates := byTitle[wrong]
+		sort.Slice(candidates, func(i, j int) bool { return naturalLess(candidates[i].ID, candidates[j].ID) })
+		for i, path := range files[wrong] {
+			if i >= len(candidates) {
+				break
+			}
+			if titles[path] != wrong {
+				repairs = append(repairs, titleRepair{path, candidates[i], titles[path]})
+			}
+		}
+	}
+	return repairs
+}
+
+// RepairTitles fixes the titles of the photos uploaded from dir while their
+// title was cut at the first dot, after PhotoTitleTemplate or FullNameTitles
+// changed: each photo
+// of the album of dir receives the title synckr now gives its local file.
+// Descriptions are kept. With DryRun the renames are only written to the plan
+func RepairTitles(config *Config, client *flickr.FlickrClient, dir string) error {
+	fromFlickr, err := RetrieveFromFlickr(client, config)
+	if err != nil {
+		return err
+	}
+
+	r := newSyncRun(config, client, fromFlickr, log)
+	if config.DryRun {
+		out, closePlan, err := openPlan(config)
+		if err != nil {
+			return kindError(ErrConfig, "repair titles", err)
+		}
+		defer closePlan()
+		r.plan = NewPlanWriter(out)
+	}
+
+	entries, err := readLibraryDir(config, dir)
+	if err != nil {
+		return kindError(ErrConfig, "repair titles", err)
+	}
+	var paths []string
+	titles := make(map[string]string)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() && hasAllowedExtension(config, path) && !isHidden(config, path) {
+			paths = append(paths, path)
+			titles[path] = r.photoTitle(path)
+		}
+	}
+	less := titleLess(config)
+	sort.SliceStable(paths, func(i, j int) bool { return less(filepath.Base(paths[i]), filepath.Base(paths[j])) })
+
+	album := albumTitleForDir(config, dir)
+	if meta := r.albumMeta(dir); meta.Title != "" {
+		album = meta.Title
+	}
+	logger := r.albumLog(album)
+	if len(fromFlickr[album]) == 0 {
+		logger.WithField("path", dir).Warn("[SKIP] No album on flickr for the directory")
+		return nil
+	}
+	var photos []FlickrPhoto
+	for _, set := range fromFlickr[album] {
+		photos = append(photos, set.Photos...)
+	}
+
+	repairs := matchTitleRepairs(config, paths, titles, photos)
+	for _, repair := range repairs {
+		if err := r.repairTitle(logger, repair); err != nil {
+			return err
+		}
+	}
+	logger.WithField("repaired", len(repairs)).Info("[OK] Photo titles repaired")
+	return nil
+}
+
+// repairTitle renames a photo, keeping its description
+func (r *syncRun) repairTitle(logger *logrus.Entry, repair titleRepair) error {
+	if r.plan != nil {
+		r.plan.Update("title %s → %q", repair.Photo.Title, repair.Title)
+		return nil
+	}
+
+	info, err := getPhotoInfo(r.client, repair.Photo.ID)
+	if err == nil {
+		var resp *flickr.BasicResponse
+		if resp, err = setPhotoMeta(r.client, repair.Photo.ID, repair.Title, info.Photo.Description); err != nil && isAuthError(resp) {
+			logger.Error(authFailedMessage)
+			return ErrAuthorization
+		}
+	} else if isAuthError(info) {
+		logger.Error(authFailedMessage)
+		return ErrAuthorization
+	}
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"path":  repair.Path,
+			"error": err,
+		}).Error("[ERROR] Could not repair photo title")
+		return nil
+	}
+	logger.WithFields(logrus.Fields{
+		"path":     repair.Path,
+		"photo.id": repair.Photo.ID,
+	}).Info("[OK] Photo title repaired")
+	return nil
+}
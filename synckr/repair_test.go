@@ -0,0 +1,115 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchTitleRepairs(t *testing.T) {
+	config := Config{PhotoTitleTemplate: "{filename}"}
+	tests := []struct {
+		name     string
+		files    []string
+		photos   []FlickrPhoto
+		expected map[string]string
+	}{
+		{
+			"by wrong title",
+			[]string{"2008.01.02 beach.jpg", "IMG_1.jpg", "v1.2.png"},
+			[]FlickrPhoto{{ID: "10", Title: "2008"}, {ID: "11", Title: "IMG_1"}, {ID: "12", Title: "v1"}},
+			map[string]string{"10": "2008.01.02 beach", "12": "v1.2"},
+		},
+		{
+			"by upload order",
+			[]string{"2008.01.02.jpg", "2008.01.03.jpg", "2008.01.04.jpg"},
+			[]FlickrPhoto{{ID: "101", Title: "2008"}, {ID: "99", Title: "2008"}, {ID: "100", Title: "2008"}},
+			map[string]string{"99": "2008.01.02", "100": "2008.01.03", "101": "2008.01.04"},
+		},
+		{
+			"partly repaired",
+			[]string{"2008.01.02.jpg", "2008.01.03.jpg"},
+			[]FlickrPhoto{{ID: "10", Title: "2008.01.02"}, {ID: "11", Title: "2008"}},
+			map[string]string{"11": "2008.01.03"},
+		},
+		{
+			"missing photo",
+			[]string{"2008.01.02.jpg", "2008.01.03.jpg"},
+			[]FlickrPhoto{{ID: "10", Title: "2008"}},
+			map[string]string{"10": "2008.01.02"},
+		},
+		{
+			"file titled like the wrong title",
+			[]string{"2008.jpg", "2008.01.02.jpg"},
+			[]FlickrPhoto{{ID: "10", Title: "2008"}, {ID: "11", Title: "2008"}},
+			map[string]string{"11": "2008.01.02"},
+		},
+	}
+	for _, tt := range tests {
+		var paths []string
+		titles := make(map[string]string)
+		for _, f := range tt.files {
+			path := filepath.Join("album", f)
+			paths = append(paths, path)
+			titles[path] = photoTitle(&config, path)
+		}
+		repairs := matchTitleRepairs(&config, paths, titles, tt.photos)
+		got := make(map[string]string)
+		for _, repair := range repairs {
+			got[repair.Photo.ID] = repair.Title
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected the repairs %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestRepairTitles(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	set := stub.addSet("album", "2008", "2008", "IMG_1")
+	for _, id := range stub.set("album").Photos {
+		stub.photos[id].setArg("description", "kept")
+	}
+
+	root := makeTree(t, "album/2008.01.02 beach.jpg", "album/2008.01.03 hike.jpg", "album/IMG_1.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.PhotoTitleTemplate = "{filename}"
+
+	// Dry runs only write the plan
+	config.DryRun = true
+	config.PlanFile = filepath.Join(root, "plan.txt")
+	if err := RepairTitles(&config, stub.client(), filepath.Join(root, "album")); err != nil {
+		t.Fatal(err)
+	}
+	plan, _ := ioutil.ReadFile(config.PlanFile)
+	if strings.Count(string(plan), "~ title 2008 → ") != 2 || stub.count("flickr.photos.setMeta") != 0 {
+		t.Errorf("The dry run should plan two renames and apply none, got %q", plan)
+	}
+
+	config.DryRun = false
+	if err := RepairTitles(&config, stub.client(), filepath.Join(root, "album")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"2008.01.02 beach", "2008.01.03 hike", "IMG_1"}
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, expected) {
+		t.Errorf("Expected the titles %v, got %v", expected, titles)
+	}
+	for _, id := range stub.set("album").Photos {
+		if description := stub.photos[id].Args.Get("description"); description != "kept" {
+			t.Errorf("Photo %s of %s should keep its description, got %q", id, set, description)
+		}
+	}
+
+	// Once repaired, a sync finds every photo
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 0 {
+		t.Errorf("Repaired photos should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+}
@@ -0,0 +1,199 @@
+package synckr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// jpegQuality is used when encoding resized JPEG photos
+const jpegQuality = 90
+
+// Resizer scales an image to the given dimensions
+type Resizer func(img image.Image, width int, height int) image.Image
+
+// ImageResizer is the Resizer used when MaxDimension is set.
+// It may be replaced to use a different resampling algorithm
+var ImageResizer Resizer = boxResize
+
+// shouldResize tells whether a file is subject to MaxDimension: any photo when
+// ResizeExtensions is empty, otherwise only the listed extensions. Videos are
+// never resized
+func shouldResize(config *Config, path string) bool {
+	if matchesExtension(path, videoExtensions) {
+		return false
+	}
+	return len(config.ResizeExtensions) == 0 || matchesExtension(path, config.ResizeExtensions)
+}
+
+// resizeIfNeeded writes a downscaled copy of a photo whose long edge exceeds maxDim.
+// The copy keeps the base name of the original so that flickr derives the same title,
+// and lives in its own temporary directory which the caller must remove.
+// The returned bool tells whether a resized copy was written; when false the original
+// path is returned.
+func resizeIfNeeded(config *Config, path string, maxDim int) (string, bool, error) {
+	raw, err := readLibraryFile(config, path)
+	if err != nil {
+		return path, false, err
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return path, false, err
+	}
+	if maxDim <= 0 || (cfg.Width <= maxDim && cfg.Height <= maxDim) || (format != "jpeg" && format != "png") {
+		return path, false, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return path, false, err
+	}
+
+	// Re-encoding drops the EXIF metadata, so the orientation is applied to the pixels
+	// and the copy is tagged with a normal orientation. The copy of an unchanged photo
+	// is then identical from one run to the next
+	if format == "jpeg" {
+		if exif, err := readExif(config, path); err == nil {
+			img = normalizeOrientation(img, exif.Orientation)
+		}
+	}
+
+	width, height := scaledDimensions(img.Bounds().Dx(), img.Bounds().Dy(), maxDim)
+	img = ImageResizer(img, width, height)
+
+	dir, err := ioutil.TempDir("", "synckr")
+	if err != nil {
+		return path, false, err
+	}
+	resized := filepath.Join(dir, filepath.Base(path))
+	out, err := os.Create(resized)
+	if err != nil {
+		os.RemoveAll(dir)
+		return path, false, err
+	}
+
+	if format == "jpeg" {
+		err = encodeNormalizedJPEG(out, img)
+	} else {
+		err = png.Encode(out, img)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return path, false, err
+	}
+
+	return resized, true, nil
+}
+
+// encodeNormalizedJPEG encodes an image whose orientation was applied, along with
+// an Exif segment stating its normal orientation
+func encodeNormalizedJPEG(w io.Writer, img image.Image) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return err
+	}
+	encoded := buf.Bytes()
+	// The segment goes right after the start of image marker
+	if _, err := w.Write(encoded[:2]); err != nil {
+		return err
+	}
+	if _, err := w.Write(normalOrientationSegment()); err != nil {
+		return err
+	}
+	_, err := w.Write(encoded[2:])
+	return err
+}
+
+// scaledDimensions returns the dimensions fitting in maxDim while preserving the aspect ratio
+func scaledDimensions(width int, height int, maxDim int) (int, int) {
+	if width >= height {
+		h := height * maxDim / width
+		if h < 1 {
+			h = 1
+		}
+		return maxDim, h
+	}
+	w := width * maxDim / height
+	if w < 1 {
+		w = 1
+	}
+	return w, maxDim
+}
+
+// boxResize downscales an image averaging all the source pixels covered by
+// each destination pixel
+func boxResize(img image.Image, width int, height int) image.Image {
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := src.Min.Y + y*src.Dy()/height
+		y1 := src.Min.Y + (y+1)*src.Dy()/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := src.Min.X + x*src.Dx()/width
+			x1 := src.Min.X + (x+1)*src.Dx()/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// normalizeOrientation returns the image as it should be displayed according to
+// its EXIF orientation, so that it no longer depends on the orientation tag
+func normalizeOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	// source returns the source coordinates of a destination pixel
+	source := map[int]func(x, y int) (int, int){
+		2: func(x, y int) (int, int) { return w - 1 - x, y },
+		3: func(x, y int) (int, int) { return w - 1 - x, h - 1 - y },
+		4: func(x, y int) (int, int) { return x, h - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return y, h - 1 - x },
+		7: func(x, y int) (int, int) { return w - 1 - y, h - 1 - x },
+		8: func(x, y int) (int, int) { return w - 1 - y, x },
+	}[orientation]
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := source(x, y)
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,323 @@
+package synckr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// exifSegment builds an APP1 segment holding an orientation tag when orientation > 0
+// and a DateTimeOriginal tag when date is not empty
+func exifSegment(orientation int, date string) []byte {
+	order := binary.LittleEndian
+	entry := func(tag uint16, typ uint16, count uint32, value uint32) []byte {
+		e := make([]byte, 12)
+		order.PutUint16(e[0:], tag)
+		order.PutUint16(e[2:], typ)
+		order.PutUint32(e[4:], count)
+		order.PutUint32(e[8:], value)
+		return e
+	}
+
+	var ifd0 [][]byte
+	if orientation > 0 {
+		ifd0 = append(ifd0, entry(exifTagOrientation, 3, 1, uint32(orientation)))
+	}
+	if date != "" {
+		ifd0 = append(ifd0, nil)
+	}
+
+	// header, then IFD0, then the Exif IFD, then the date string
+	ifd0Size := 2 + 12*len(ifd0) + 4
+	exifIFDOffset := 8 + ifd0Size
+	dateOffset := exifIFDOffset + 2 + 12 + 4
+	if date != "" {
+		ifd0[len(ifd0)-1] = entry(exifTagExifIFDPointer, 4, 1, uint32(exifIFDOffset))
+	}
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	count := make([]byte, 2)
+	order.PutUint16(count, uint16(len(ifd0)))
+	tiff = append(tiff, count...)
+	for _, e := range ifd0 {
+		tiff = append(tiff, e...)
+	}
+	tiff = append(tiff, 0, 0, 0, 0)
+	if date != "" {
+		value := append([]byte(date), 0)
+		tiff = append(tiff, 1, 0)
+		tiff = append(tiff, entry(exifTagDateTimeOriginal, 2, uint32(len(value)), uint32(dateOffset))...)
+		tiff = append(tiff, 0, 0, 0, 0)
+		tiff = append(tiff, value...)
+	}
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testImage returns an image whose top left pixel is red, the rest being white
+func testImage(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	return img
+}
+
+// writeJPEG writes a width x height JPEG fixture, with an EXIF orientation tag when orientation > 0
+func writeJPEG(t *testing.T, path string, width int, height int, orientation int) {
+	var segment []byte
+	if orientation > 0 {
+		segment = exifSegment(orientation, "")
+	}
+	writeJPEGExif(t, path, width, height, segment)
+}
+
+// writeJPEGExif writes a width x height JPEG fixture holding the given APP1 segment
+func writeJPEGExif(t *testing.T, path string, width int, height int, segment []byte) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(width, height), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if segment != nil {
+		data = append(append([]byte{0xFF, 0xD8}, segment...), data[2:]...)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func imageSize(t *testing.T, path string) (int, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestReadExifOrientation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "rotated.jpg")
+	writeJPEG(t, path, 20, 10, 6)
+	exif, err := readExif(&Config{}, path)
+	if err != nil || exif.Orientation != 6 {
+		t.Errorf("Expected orientation 6, got %d (%v)", exif.Orientation, err)
+	}
+
+	path = filepath.Join(dir, "plain.jpg")
+	writeJPEG(t, path, 20, 10, 0)
+	if _, err := readExif(&Config{}, path); err != errNoExif {
+		t.Errorf("Expected errNoExif, got %v", err)
+	}
+}
+
+func TestResizeIfNeeded(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	small := filepath.Join(dir, "small.jpg")
+	writeJPEG(t, small, 100, 50, 0)
+	path, resized, err := resizeIfNeeded(&Config{}, small, 200)
+	if err != nil || resized || path != small {
+		t.Errorf("Photo below the limit should not be resized: %s %v %v", path, resized, err)
+	}
+
+	large := filepath.Join(dir, "large.jpg")
+	writeJPEG(t, large, 400, 200, 0)
+	path, resized, err = resizeIfNeeded(&Config{}, large, 100)
+	if err != nil || !resized {
+		t.Fatalf("Photo above the limit should be resized: %v %v", resized, err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+	if filepath.Base(path) != "large.jpg" {
+		t.Errorf("Resized copy should keep the original name, got %s", path)
+	}
+	if w, h := imageSize(t, path); w != 100 || h != 50 {
+		t.Errorf("Expected 100x50, got %dx%d", w, h)
+	}
+
+	rotated := filepath.Join(dir, "rotated.jpg")
+	writeJPEG(t, rotated, 400, 200, 6)
+	path, resized, err = resizeIfNeeded(&Config{}, rotated, 100)
+	if err != nil || !resized {
+		t.Fatalf("Rotated photo above the limit should be resized: %v %v", resized, err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+	if w, h := imageSize(t, path); w != 50 || h != 100 {
+		t.Errorf("Orientation should be applied, expected 50x100, got %dx%d", w, h)
+	}
+
+	pngPath := filepath.Join(dir, "large.png")
+	file, _ := os.Create(pngPath)
+	png.Encode(file, testImage(300, 600))
+	file.Close()
+	path, resized, err = resizeIfNeeded(&Config{}, pngPath, 60)
+	if err != nil || !resized {
+		t.Fatalf("PNG above the limit should be resized: %v %v", resized, err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+	if w, h := imageSize(t, path); w != 30 || h != 60 {
+		t.Errorf("Expected 30x60, got %dx%d", w, h)
+	}
+}
+
+func TestNormalizeOrientation(t *testing.T) {
+	// A B C
+	// D E F
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	copy(src.Pix, "ABCDEF")
+
+	tests := []struct {
+		orientation int
+		expected    []string
+	}{
+		{1, []string{"ABC", "DEF"}},
+		{2, []string{"CBA", "FED"}},
+		{3, []string{"FED", "CBA"}},
+		{4, []string{"DEF", "ABC"}},
+		{5, []string{"AD", "BE", "CF"}},
+		{6, []string{"DA", "EB", "FC"}},
+		{7, []string{"FC", "EB", "DA"}},
+		{8, []string{"CF", "BE", "AD"}},
+	}
+	for _, tt := range tests {
+		img := normalizeOrientation(src, tt.orientation)
+		var rows []string
+		for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+			var row []byte
+			for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+				row = append(row, color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			}
+			rows = append(rows, string(row))
+		}
+		if !reflect.DeepEqual(rows, tt.expected) {
+			t.Errorf("Orientation %d: expected %v, got %v", tt.orientation, tt.expected, rows)
+		}
+	}
+}
+
+func TestResizedCopyIsStable(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	rotated := filepath.Join(dir, "rotated.jpg")
+	writeJPEG(t, rotated, 400, 200, 6)
+
+	var sums []string
+	for i := 0; i < 2; i++ {
+		path, resized, err := resizeIfNeeded(&Config{}, rotated, 100)
+		if err != nil || !resized {
+			t.Fatalf("Photo above the limit should be resized: %v %v", resized, err)
+		}
+		defer os.RemoveAll(filepath.Dir(path))
+
+		if exif, err := readExif(&Config{}, path); err != nil || exif.Orientation != 1 {
+			t.Errorf("The copy should state a normal orientation, got %d (%v)", exif.Orientation, err)
+		}
+		sum, err := fileChecksum(&Config{}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sums = append(sums, sum)
+	}
+	if sums[0] != sums[1] {
+		t.Error("Resizing an unchanged photo again should produce the same copy")
+	}
+}
+
+func TestImageResizerIsPluggable(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	large := filepath.Join(dir, "large.jpg")
+	writeJPEG(t, large, 400, 200, 0)
+
+	called := false
+	defer func(r Resizer) { ImageResizer = r }(ImageResizer)
+	ImageResizer = func(img image.Image, width int, height int) image.Image {
+		called = true
+		return boxResize(img, width, height)
+	}
+
+	path, _, err := resizeIfNeeded(&Config{}, large, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(filepath.Dir(path))
+	if !called {
+		t.Error("Custom resizer should have been used")
+	}
+}
+
+func TestShouldResize(t *testing.T) {
+	tests := []struct {
+		exts     []string
+		path     string
+		expected bool
+	}{
+		{nil, "a.jpg", true},
+		{nil, "a.png", true},
+		{nil, "clip.mp4", false},
+		{[]string{".jpg", "jpeg"}, "a.JPG", true},
+		{[]string{".jpg", "jpeg"}, "a.jpeg", true},
+		{[]string{".jpg", "jpeg"}, "a.png", false},
+		{[]string{".mp4"}, "clip.mp4", false},
+	}
+	for _, tt := range tests {
+		config := Config{ResizeExtensions: tt.exts}
+		if got := shouldResize(&config, tt.path); got != tt.expected {
+			t.Errorf("%v %s: expected %v, got %v", tt.exts, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestResizeExtensions(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "album/a.jpg", "album/b.png")
+	defer os.RemoveAll(root)
+	writeJPEG(t, filepath.Join(root, "album", "a.jpg"), 400, 200, 0)
+	file, _ := os.Create(filepath.Join(root, "album", "b.png"))
+	png.Encode(file, testImage(400, 200))
+	file.Close()
+
+	var resized []image.Rectangle
+	defer func(r Resizer) { ImageResizer = r }(ImageResizer)
+	ImageResizer = func(img image.Image, width int, height int) image.Image {
+		resized = append(resized, img.Bounds())
+		return boxResize(img, width, height)
+	}
+
+	config := testConfig(root)
+	config.MaxDimension = 100
+	config.ResizeExtensions = []string{".jpg"}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resized) != 1 {
+		t.Errorf("Only the JPEG photo should be resized, got %d resizes", len(resized))
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("Both photos should be uploaded, got %d uploads", stub.count("upload"))
+	}
+}
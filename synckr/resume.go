@@ -0,0 +1,193 @@
+package synckr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// resumedAlbum is an album fully loaded from flickr by an earlier retrieval
+type resumedAlbum struct {
+	Title    string
+	Photoset FlickrPhotoset
+}
+
+// retrievalState is persisted in ResumeFile as each album is loaded so that an
+// interrupted RetrieveFromFlickr picks up from the next album
+type retrievalState struct {
+	Albums []resumedAlbum
+}
+
+// resumeRecord is a record of a resume file. The file holds one album per line,
+// so that albums are appended as they are loaded; each line is a gzip member of its
+// own when compressed. Files written before held a single record listing all Albums
+type resumeRecord struct {
+	resumedAlbum
+	Albums []resumedAlbum `json:",omitempty"`
+}
+
+// loadRetrievalState reads a resume file, gzip compressed or not. A missing file
+// is an empty state. Records cut short by an interruption are ignored, as well as
+// the members following a truncated gzip member
+func loadRetrievalState(path string) (retrievalState, error) {
+	var state retrievalState
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if bytes.HasPrefix(raw, gzipMagic) {
+		reader, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return state, err
+		}
+		// The members read before a truncated one are kept
+		raw, _ = ioutil.ReadAll(reader)
+	}
+
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		var record resumeRecord
+		if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &record) != nil {
+			continue
+		}
+		if len(record.Albums) > 0 {
+			state.Albums = append(state.Albums, record.Albums...)
+		} else {
+			state.Albums = append(state.Albums, record.resumedAlbum)
+		}
+	}
+	return state, nil
+}
+
+// loaded indexes the albums of the state by ID
+func (s retrievalState) loaded() map[string]resumedAlbum {
+	result := make(map[string]resumedAlbum)
+	for _, album := range s.Albums {
+		result[album.Photoset.ID] = album
+	}
+	return result
+}
+
+// encodeAlbums returns the records of albums, gzip compressed when compress is set
+func encodeAlbums(albums []resumedAlbum, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	encoder := json.NewEncoder(w)
+	for _, album := range albums {
+		if err := encoder.Encode(resumeRecord{resumedAlbum: album}); err != nil {
+			return nil, err
+		}
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// compressState tells whether a resume file is gzip compressed: when compress is
+// set or its name ends with .gz
+func compressState(path string, compress bool) bool {
+	return compress || strings.HasSuffix(path, ".gz")
+}
+
+// saveRetrievalState writes the whole resume file atomically, so that an
+// interruption while saving never leaves a truncated file behind
+func saveRetrievalState(path string, state retrievalState, compress bool) error {
+	raw, err := encodeAlbums(state.Albums, compressState(path, compress))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, raw)
+}
+
+// resumeWriter appends the albums to a resume file as they are loaded. It may be
+// used by concurrent retrievals
+type resumeWriter struct {
+	mu       sync.Mutex
+	path     string
+	compress bool
+}
+
+// newResumeWriter returns a writer appending to path. Albums appended to an
+// existing file follow its compression
+func newResumeWriter(path string, compress bool) *resumeWriter {
+	compress = compressState(path, compress)
+	if file, err := os.Open(path); err == nil {
+		magic := make([]byte, len(gzipMagic))
+		if n, _ := io.ReadFull(file, magic); n > 0 {
+			compress = bytes.Equal(magic, gzipMagic)
+		}
+		file.Close()
+	}
+	return &resumeWriter{path: path, compress: compress}
+}
+
+// Append adds an album to the resume file, in a single write
+func (w *resumeWriter) Append(album resumedAlbum) error {
+	raw, err := encodeAlbums([]resumedAlbum{album}, w.compress)
+	if err != nil {
+		return err
+	}
+	// A record cut short by an interruption stays alone on its line
+	if !w.compress {
+		raw = append([]byte("\n"), raw...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(raw); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// openResumeFile rewrites the resume file with the albums of state, then returns
+// a writer appending to it. The records cut short by an interruption are dropped:
+// a truncated gzip member would hide the members appended after it
+func openResumeFile(path string, state retrievalState, compress bool) (*resumeWriter, error) {
+	if err := saveRetrievalState(path, state, compress); err != nil {
+		return nil, err
+	}
+	return newResumeWriter(path, compress), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, then renames it
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,217 @@
+package synckr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRetrieveRecordsProgress(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	first := stub.addSet("first", "a")
+	second := stub.addSet("second", "b", "c")
+	third := stub.addSet("third", "d")
+
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	config := testConfig(dir)
+	config.ResumeFile = filepath.Join(dir, "resume.json")
+
+	// Check what an interruption while loading the third album would leave behind
+	var recorded map[string]resumedAlbum
+	stub.hook("flickr.photosets.getPhotos", func(args url.Values) string {
+		if args.Get("photoset_id") == third && recorded == nil {
+			state, err := loadRetrievalState(config.ResumeFile)
+			if err != nil {
+				t.Error(err)
+			}
+			recorded = state.loaded()
+		}
+		return ""
+	})
+
+	RetrieveFromFlickr(stub.client(), &config)
+
+	if len(recorded) != 2 || len(recorded[first].Photoset.Photos) != 1 || len(recorded[second].Photoset.Photos) != 2 {
+		t.Errorf("The first two albums should be recorded before the third is loaded, got %v", recorded)
+	}
+	if _, err := os.Stat(config.ResumeFile); !os.IsNotExist(err) {
+		t.Error("The resume file should be removed once the retrieval completed")
+	}
+}
+
+func TestRetrieveResumesInterruptedRetrieval(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	first := stub.addSet("first", "a")
+	second := stub.addSet("second", "b", "c")
+	stub.addSet("third", "d")
+
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	config := testConfig(dir)
+	config.ResumeFile = filepath.Join(dir, "resume.json")
+
+	saveRetrievalState(config.ResumeFile, retrievalState{Albums: []resumedAlbum{
+		{"first", FlickrPhotoset{first, []FlickrPhoto{{ID: "1", Title: "a"}}}},
+		{"second", FlickrPhotoset{second, []FlickrPhoto{{ID: "2", Title: "b"}, {ID: "3", Title: "c"}}}},
+	}}, false)
+
+	fetched := make(map[string]bool)
+	stub.hook("flickr.photosets.getPhotos", func(args url.Values) string {
+		fetched[args.Get("photoset_id")] = true
+		return ""
+	})
+
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fetched) != 1 || fetched[first] || fetched[second] {
+		t.Errorf("Only the third album should be fetched, got %v", fetched)
+	}
+	if len(fromFlickr) != 3 || len(fromFlickr["second"][0].Photos) != 2 || len(fromFlickr["third"][0].Photos) != 1 {
+		t.Errorf("Resumed and fetched albums should all be returned, got %v", fromFlickr)
+	}
+}
+
+func TestCompressedRetrievalState(t *testing.T) {
+	var state retrievalState
+	for i := 0; i < 1000; i++ {
+		set := FlickrPhotoset{ID: fmt.Sprint("set", i)}
+		for j := 0; j < 50; j++ {
+			set.Photos = append(set.Photos, FlickrPhoto{ID: fmt.Sprint(i*50 + j), Title: fmt.Sprintf("IMG_%04d", j)})
+		}
+		state.Albums = append(state.Albums, resumedAlbum{fmt.Sprint("album ", i), set})
+	}
+	expected, _ := json.Marshal(state)
+
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"resume.json", true},
+		{"resume.json.gz", false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := saveRetrievalState(path, state, tt.compress); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := ioutil.ReadFile(path)
+		if !bytes.HasPrefix(raw, gzipMagic) || len(raw) >= len(expected) {
+			t.Errorf("%s: the state should be gzip compressed, got %d bytes for %d", tt.name, len(raw), len(expected))
+		}
+		if files, _ := filepath.Glob(path + ".tmp*"); len(files) != 0 {
+			t.Errorf("%s: temporary files should not be left behind, got %v", tt.name, files)
+		}
+
+		loaded, err := loadRetrievalState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := json.Marshal(loaded); !bytes.Equal(got, expected) {
+			t.Errorf("%s: the reloaded state differs from the saved one", tt.name)
+		}
+	}
+}
+
+func TestResumeWriterConcurrentAppends(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprint("resume-", compress, ".json"))
+		w := newResumeWriter(path, compress)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				set := FlickrPhotoset{ID: fmt.Sprint("set", i), Photos: []FlickrPhoto{{ID: fmt.Sprint(i), Title: "a"}}}
+				if err := w.Append(resumedAlbum{fmt.Sprint("album ", i), set}); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		state, err := loadRetrievalState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := state.loaded()
+		for i := 0; i < 20; i++ {
+			if album, ok := loaded[fmt.Sprint("set", i)]; !ok || album.Title != fmt.Sprint("album ", i) || len(album.Photoset.Photos) != 1 {
+				t.Errorf("compress %v: album %d should be read back, got %v", compress, i, album)
+			}
+		}
+		if len(state.Albums) != 20 {
+			t.Errorf("compress %v: expected 20 albums, got %d", compress, len(state.Albums))
+		}
+	}
+}
+
+func TestResumeFileInterruptedAppend(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(dir, fmt.Sprint("resume-", compress, ".json"))
+		w := newResumeWriter(path, compress)
+		w.Append(resumedAlbum{"first", FlickrPhotoset{ID: "1"}})
+		w.Append(resumedAlbum{"second", FlickrPhotoset{ID: "2"}})
+
+		// An interruption during the third append leaves half a record behind
+		third, _ := encodeAlbums([]resumedAlbum{{"third", FlickrPhotoset{ID: "3"}}}, w.compress)
+		file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		file.Write(third[:len(third)/2])
+		file.Close()
+
+		state, err := loadRetrievalState(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(state.Albums) != 2 || state.Albums[0].Title != "first" || state.Albums[1].Title != "second" {
+			t.Errorf("compress %v: the complete albums should be resumed, got %v", compress, state.Albums)
+		}
+
+		// The next retrieval appends after what was resumed
+		w, err = openResumeFile(path, state, compress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Append(resumedAlbum{"fourth", FlickrPhotoset{ID: "4"}})
+		state, err = loadRetrievalState(path)
+		if err != nil || len(state.Albums) != 3 || state.Albums[2].Title != "fourth" {
+			t.Errorf("compress %v: the albums appended after a cut record should be read, got %v %v", compress, state.Albums, err)
+		}
+	}
+}
+
+func TestLegacyResumeFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "resume.json")
+
+	ioutil.WriteFile(path, []byte(`{"Albums":[{"Title":"a","Photoset":{"ID":"1","Photos":null}},{"Title":"b","Photoset":{"ID":"2","Photos":null}}]}`), 0644)
+	state, err := loadRetrievalState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Albums) != 2 || state.Albums[1].Title != "b" {
+		t.Errorf("Resume files listing all albums at once should still be read, got %v", state.Albums)
+	}
+}
@@ -0,0 +1,93 @@
+package synckr
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+)
+
+func TestRetrieveRetriesPartialAlbums(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	id := stub.addSet("album", "a", "b", "c")
+	first := stub.set("album").Photos[0]
+
+	// The first fetch only returns one of the three photos flickr reports
+	stub.hook("flickr.photosets.getPhotos", func(args url.Values) string {
+		if stub.count("flickr.photosets.getPhotos") == 1 {
+			return fmt.Sprintf(`<rsp stat="ok"><photoset id="%s" page="1" pages="1" perpage="500" total="3"><photo id="%s" title="a"/></photoset></rsp>`, id, first)
+		}
+		return ""
+	})
+
+	config := testConfig("")
+	config.RetrieveAttempts = 2
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photos := fromFlickr["album"][0].Photos; len(photos) != 3 {
+		t.Errorf("The album should be fetched again until complete, got %v", photos)
+	}
+}
+
+func TestRetrieveKeepsPartialAlbumsAfterAttempts(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	id := stub.addSet("album", "a", "b")
+	first := stub.set("album").Photos[0]
+
+	stub.hook("flickr.photosets.getPhotos", func(args url.Values) string {
+		if args.Get("page") == "" {
+			return fmt.Sprintf(`<rsp stat="ok"><photoset id="%s" page="1" pages="1" perpage="500" total="2"><photo id="%s" title="a"/></photoset></rsp>`, id, first)
+		}
+		return ""
+	})
+
+	config := testConfig("")
+	config.RetrieveAttempts = 2
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photos := fromFlickr["album"][0].Photos; len(photos) != 1 {
+		t.Errorf("The partial album should be kept, got %v", photos)
+	}
+	// Per attempt, the page is fetched once and the empty page after it is
+	// tried RetrieveAttempts+1 times
+	if calls := stub.count("flickr.photosets.getPhotos"); calls != 3*(1+3) {
+		t.Errorf("Expected 3 attempts, got %d calls", calls)
+	}
+}
+
+func TestRetrieveRetriesAlbumList(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	stub.hook("flickr.photosets.getList", func(args url.Values) string {
+		if stub.count("flickr.photosets.getList") <= 2 {
+			return stubError(105, "Service currently unavailable")
+		}
+		return ""
+	})
+
+	config := testConfig("")
+	config.RetrieveAttempts = 2
+	fromFlickr, err := RetrieveFromFlickr(stub.client(), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromFlickr["album"]) != 1 || stub.count("flickr.photosets.getList") != 3 {
+		t.Errorf("The album list should be retrieved on the third attempt, got %v after %d calls", fromFlickr, stub.count("flickr.photosets.getList"))
+	}
+
+	// Once the attempts are exhausted, the error is returned
+	stub.hook("flickr.photosets.getList", func(args url.Values) string {
+		return stubError(105, "Service currently unavailable")
+	})
+	if _, err := RetrieveFromFlickr(stub.client(), &config); !errors.Is(err, ErrRetrieve) {
+		t.Errorf("Expected ErrRetrieve, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package synckr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// routingRule sends the photos of the directories matching Glob to the album
+// titled Album. Glob is matched against the slash separated path of the
+// directory relative to PhotoLibraryPath, and against each of its parents
+type routingRule struct {
+	Glob  string `json:"glob"`
+	Album string `json:"album"`
+}
+
+// loadRoutingRules reads the rules of a RoutingFile, a JSON list of
+// {"glob": ..., "album": ...} objects kept in order
+func loadRoutingRules(file string) ([]routingRule, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []routingRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		if rule.Glob == "" || strings.TrimSpace(rule.Album) == "" {
+			return nil, fmt.Errorf("routing rule %d needs a glob and an album", i+1)
+		}
+		if _, err := path.Match(rule.Glob, ""); err != nil {
+			return nil, fmt.Errorf("routing rule %d: %v: %q", i+1, err, rule.Glob)
+		}
+	}
+	return rules, nil
+}
+
+// routeAlbum returns the album of the first rule matching the directory of a
+// file, false when no rule matches
+func routeAlbum(config *Config, rules []routingRule, file string) (string, bool) {
+	dir := path.Dir(relPath(config, file))
+	for _, rule := range rules {
+		for d := dir; d != "." && d != "/"; d = path.Dir(d) {
+			if ok, _ := path.Match(rule.Glob, d); ok {
+				return rule.Album, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,89 @@
+package synckr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const sampleRouting = `[
+	{"glob": "2024/trip-*", "album": "Trips"},
+	{"glob": "2024/*", "album": "2024"},
+	{"glob": "*/pets", "album": "Pets"}
+]`
+
+func TestRouteAlbum(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "routing.json")
+	ioutil.WriteFile(file, []byte(sampleRouting), 0644)
+
+	rules, err := loadRoutingRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{PhotoLibraryPath: "/photos"}
+	tests := []struct {
+		path     string
+		album    string
+		expected bool
+	}{
+		{"/photos/2024/trip-rome/a.jpg", "Trips", true},
+		{"/photos/2024/trip-rome/day1/a.jpg", "Trips", true},
+		{"/photos/2024/pets/a.jpg", "2024", true},
+		{"/photos/2023/pets/a.jpg", "Pets", true},
+		{"/photos/2023/trip-rome/a.jpg", "", false},
+		{"/photos/a.jpg", "", false},
+	}
+	for _, tt := range tests {
+		if album, ok := routeAlbum(&config, rules, tt.path); album != tt.album || ok != tt.expected {
+			t.Errorf("%s: expected %q %v, got %q %v", tt.path, tt.album, tt.expected, album, ok)
+		}
+	}
+}
+
+func TestLoadRoutingRulesErrors(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+
+	for _, content := range []string{
+		`{"2024/*": "2024"}`,
+		`[{"glob": "[", "album": "a"}]`,
+		`[{"glob": "2024/*"}]`,
+	} {
+		file := filepath.Join(dir, "routing.json")
+		ioutil.WriteFile(file, []byte(content), 0644)
+		if _, err := loadRoutingRules(file); err == nil {
+			t.Errorf("%s: expected an error", content)
+		}
+	}
+}
+
+func TestProcessRoutingFile(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "2024/trip-rome/a.jpg", "2024/pets/b.jpg", "2023/pets/c.jpg", "2023/misc/d.jpg")
+	defer os.RemoveAll(root)
+	config := testConfig(root)
+	config.RoutingFile = filepath.Join(root, "routing.json")
+	ioutil.WriteFile(config.RoutingFile, []byte(sampleRouting), 0644)
+
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"Trips": {"a"}, "2024": {"b"}, "Pets": {"c"}, "misc": {"d"}}
+	for title, photos := range expected {
+		if set := stub.set(title); set == nil || !reflect.DeepEqual(stub.titles(set), photos) {
+			t.Errorf("Expected %v in %q, got %+v", photos, title, set)
+		}
+	}
+
+	config.RoutingFile = filepath.Join(root, "missing.json")
+	if _, err := Process(&config, stub.client(), nil); !errors.Is(err, ErrConfig) {
+		t.Errorf("A missing routing file should be a configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,981 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Policies applied to JPEG files having a RAW file with the same name
+const (
+	// RawPolicyJPEGOnly uploads the JPEG, the RAW file is ignored. This is the default
+	RawPolicyJPEGOnly = "jpeg_only"
+	// RawPolicyTagRaw uploads the JPEG tagged with rawTag and the RAW extension
+	RawPolicyTagRaw = "tag_raw"
+	// RawPolicySkipPairs uploads neither the JPEG nor the RAW file
+	RawPolicySkipPairs = "skip_pairs"
+)
+
+// rawTag is added to photos having a RAW counterpart with RawPolicyTagRaw
+const rawTag = "raw"
+
+// syncRun holds the state shared by the files processed during a single run
+type syncRun struct {
+	config     *Config
+	client     *flickr.FlickrClient
+	fromFlickr map[string][]FlickrPhotoset
+	log        *logrus.Logger
+
+	// taggedPaths holds the lowercased path machine tags of the photos on flickr
+	taggedPaths map[string]bool
+
+	// orphans are the photos not in any album, by title, when ReconcileOrphans is set
+	orphans map[string]FlickrPhoto
+
+	// collections holds, by collection name, the IDs of the albums to group
+	// in the collection when UseCollections is set
+	collections map[string]map[string]bool
+
+	// uploads is the number of photos uploaded during the run
+	uploads int
+
+	// processed is the number of candidate files processed during the run
+	processed int
+
+	// renameChecked holds the album titles already checked for a rename
+	renameChecked map[string]bool
+
+	// albumMetas caches the album.yaml of each directory
+	albumMetas map[string]albumMeta
+
+	// albumLogs holds the logger of each album, created on first use
+	albumLogs map[string]*logrus.Entry
+
+	// rawPairs caches, per directory, the extension of the RAW file paired
+	// with each JPEG base name
+	rawPairs map[string]map[string]string
+
+	// diff is set when the run only computes a Diff, nothing is uploaded
+	diff *diffState
+
+	// photoMetas are the rows of MetadataCSV
+	photoMetas map[string]photoMeta
+
+	// plan is set during a dry run: changes are written to it instead of
+	// being applied
+	plan *PlanWriter
+
+	// photoOrder holds, by album ID, the IDs of its photos in the order of the
+	// local files. Albums which received photos are listed in reorder
+	photoOrder map[string][]string
+	reorder    map[string]bool
+
+	// failures holds the files whose upload failed, when FailuresFile is set
+	failures map[string]bool
+
+	// dirs are the directories encountered by the walk when CreateEmptyAlbums
+	// is set. placeholderID is the primary photo of the albums created for them
+	dirs          []string
+	placeholderID string
+
+	// index records the uploads when StateFile is set. flickrIDs holds the IDs
+	// of the photos on flickr, so that index entries of deleted photos are ignored
+	index     uploadIndex
+	flickrIDs map[string]bool
+
+	// namings caches the output of NamingCommand by path
+	namings map[string]naming
+
+	// mirror records the local photos of the albums mirrored according to
+	// AlbumSyncMode
+	mirror *diffState
+
+	// eta averages the last upload durations. total is the number of files of
+	// the library, counted when ProgressInterval is set
+	eta          *etaEstimator
+	total        int
+	lastProgress time.Time
+
+	// backoff computes the waits between upload attempts
+	backoff *backoff
+
+	// routes are the rules of RoutingFile
+	routes []routingRule
+
+	// overflow holds, by base album title, the number of the album receiving
+	// its new photos when MaxAlbumSize is set
+	overflow map[string]int
+
+	// dirTitles caches the uniqueTitles of each directory
+	dirTitles map[string]map[string]string
+
+	// sums caches the checksums of the files, loaded from ChecksumCacheFile
+	sums checksumCache
+
+	// success is the OnSuccess action performed after each upload
+	success successAction
+
+	// held holds, by album title, the photos uploaded while their album could
+	// not be created
+	held map[string][]heldPhoto
+
+	// mu is held while processing a file when DirConcurrency directories are
+	// walked at once. stopErr is the error which stopped one of them
+	mu      *sync.Mutex
+	stopErr error
+
+	// albumLocks serialize, by title, the uploads creating an album when
+	// DirConcurrency directories are walked at once. createdAlbums holds the
+	// IDs of the albums they created
+	albumLocks    map[string]*sync.Mutex
+	createdAlbums map[string]string
+}
+
+func newSyncRun(config *Config, client *flickr.FlickrClient, fromFlickr map[string][]FlickrPhotoset, logger *logrus.Logger) *syncRun {
+	r := &syncRun{
+		config:        config,
+		client:        client,
+		fromFlickr:    fromFlickr,
+		log:           logger,
+		taggedPaths:   make(map[string]bool),
+		albumMetas:    make(map[string]albumMeta),
+		collections:   make(map[string]map[string]bool),
+		renameChecked: make(map[string]bool),
+		albumLogs:     make(map[string]*logrus.Entry),
+		rawPairs:      make(map[string]map[string]string),
+		photoOrder:    make(map[string][]string),
+		reorder:       make(map[string]bool),
+		namings:       make(map[string]naming),
+		mirror:        newDiffState(),
+		overflow:      make(map[string]int),
+		dirTitles:     make(map[string]map[string]string),
+		held:          make(map[string][]heldPhoto),
+		eta:           newETAEstimator(config.ETAWindow),
+		backoff:       newBackoff(config, nil),
+	}
+	for _, albums := range fromFlickr {
+		for _, album := range albums {
+			for _, ph := range album.Photos {
+				if tag := ph.taggedPath(); tag != "" {
+					r.taggedPaths[tag] = true
+				}
+			}
+		}
+	}
+	if config.MetadataCSV != "" {
+		metas, err := readMetadataCSV(config.MetadataCSV)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"metadata_csv": config.MetadataCSV,
+				"error":        err,
+			}).Warn("[WARNING] Could not read photo metadata, using defaults")
+		}
+		r.photoMetas = metas
+	}
+	r.loadChecksums()
+	return r
+}
+
+// prepare sets up what a run reads from the configuration besides the library:
+// the on success action, the routing rules, the upload index and the failures
+// to retry. The returned function saves the state of the run once it is over
+func (r *syncRun) prepare() (func(), error) {
+	config := r.config
+	logger := r.log
+	var err error
+	if r.success, err = parseOnSuccess(config.OnSuccess); err != nil {
+		logger.WithFields(logrus.Fields{
+			"on_success": config.OnSuccess,
+			"error":      err,
+		}).Error("Invalid on success action")
+		return nil, kindError(ErrConfig, "process", err)
+	}
+
+	if err := checkExcludeGlobs(config); err != nil {
+		logger.WithFields(logrus.Fields{
+			"exclude_globs": config.ExcludeGlobs,
+			"error":         err,
+		}).Error("Invalid exclude globs")
+		return nil, kindError(ErrConfig, "process", err)
+	}
+
+	if config.RoutingFile != "" {
+		if r.routes, err = loadRoutingRules(config.RoutingFile); err != nil {
+			logger.WithFields(logrus.Fields{
+				"routing_file": config.RoutingFile,
+				"error":        err,
+			}).Error("Could not read routing file")
+			return nil, kindError(ErrConfig, "process", err)
+		}
+	}
+
+	if config.StateFile != "" && !config.DryRun {
+		// Going on without the index would upload the whole library again
+		if err := checkStateBackend(config); err != nil {
+			logger.WithFields(logrus.Fields{
+				"state_backend": config.StateBackend,
+				"error":         err,
+			}).Error("Unsupported state backend")
+			return nil, kindError(ErrConfig, "process", err)
+		}
+		if err := r.openIndex(); err != nil {
+			logger.WithFields(logrus.Fields{
+				"state_file": config.StateFile,
+				"error":      err,
+			}).Error("Could not open the upload index")
+			return nil, kindError(ErrConfig, "process", err)
+		}
+	}
+
+	if config.FailuresFile != "" && !config.DryRun {
+		failures, err := loadFailures(config.FailuresFile)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"failures_file": config.FailuresFile,
+				"error":         err,
+			}).Warn("[WARNING] Could not read previous failures")
+		}
+		r.failures = failures
+	}
+
+	return func() {
+		if r.failures != nil {
+			if err := saveFailures(config.FailuresFile, r.failures); err != nil {
+				logger.WithFields(logrus.Fields{
+					"failures_file": config.FailuresFile,
+					"error":         err,
+				}).Warn("[WARNING] Could not save failures")
+			}
+		}
+		if r.index != nil {
+			if err := r.index.Close(); err != nil {
+				logger.WithFields(logrus.Fields{
+					"state_file": config.StateFile,
+					"error":      err,
+				}).Warn("[WARNING] Could not save the upload index")
+			}
+		}
+		r.saveChecksums()
+	}, nil
+}
+
+// photoTitle returns the flickr title of a local file: its baseTitle, made unique
+// within its directory when DuplicateSuffixFormat is set
+func (r *syncRun) photoTitle(path string) string {
+	if r.config.DuplicateSuffixFormat != "" {
+		if title, ok := r.uniqueTitles(filepath.Dir(path))[filepath.Base(path)]; ok {
+			return title
+		}
+	}
+	return r.baseTitle(path)
+}
+
+// baseTitle returns the title given to a file by NamingCommand or by its
+// MetadataCSV row when set, the one derived from its name otherwise
+func (r *syncRun) baseTitle(path string) string {
+	if title := r.naming(path).Title; title != "" {
+		return normalizeTitle(r.config, title)
+	}
+	if meta, ok := lookupPhotoMeta(r.config, r.photoMetas, path); ok && meta.Title != "" {
+		return normalizeTitle(r.config, meta.Title)
+	}
+	return photoTitle(r.config, path)
+}
+
+// walk processes every file of the photo library, skipping the albums already
+// complete on flickr when SkipCompleteAlbums is set.
+// It stops at ErrUploadQuota, ErrAuthorization, errUploadCap or errFileLimit
+func (r *syncRun) walk() error {
+	if r.config.DirConcurrency > 1 {
+		return r.walkConcurrently()
+	}
+	return r.walkTree(r.config.PhotoLibraryPath, nil)
+}
+
+// walkTree processes the files under root. When dispatch is set, the directories
+// right under root are handed to it instead of being walked
+func (r *syncRun) walkTree(root string, dispatch func(dir string)) error {
+	// Directories whose own files are already all on flickr
+	completeDirs := make(map[string]bool)
+
+	return walkLibrary(r.config, r.log, root, func(path string, info os.FileInfo, err error) error {
+		// e.g. a broken symlink
+		if err != nil {
+			r.log.WithFields(logrus.Fields{
+				"path":  path,
+				"error": err,
+			}).Warn("[WARNING] Could not access path")
+			return nil
+		}
+
+		if dispatch != nil && info.IsDir() && filepath.Dir(path) == root {
+			dispatch(path)
+			return filepath.SkipDir
+		}
+
+		r.lock()
+		defer r.unlock()
+		if r.stopErr != nil {
+			return r.stopErr
+		}
+
+		if info.IsDir() && (isSkippedDir(r.config, path) || isExcludedPath(r.config, path)) {
+			skipLog(r.log, skipReasonExcluded).WithField("path", path).Debug("[SKIP] Excluded directory")
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && isHidden(r.config, path) {
+			skipLog(r.log, skipReasonHidden).WithField("path", path).Debug("[SKIP] Hidden directory")
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && hasNoMedia(r.config, path) {
+			skipLog(r.log, skipReasonNoMedia).WithField("path", path).Info("[SKIP] .nomedia directory")
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && exceedsMaxDepth(r.config, path) {
+			skipLog(r.log, skipReasonMaxDepth).WithFields(logrus.Fields{
+				"path":      path,
+				"max_depth": r.config.MaxDepth,
+			}).Info("[SKIP] max depth exceeded")
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && r.config.CreateEmptyAlbums && path != r.config.PhotoLibraryPath {
+			r.dirs = append(r.dirs, path)
+		}
+
+		// Every file of a mirrored album must be seen to find the photos to remove
+		if info.IsDir() && r.config.SkipCompleteAlbums && !isMirrored(r.config, albumTitleForDir(r.config, path)) {
+			if complete, whole := isCompleteAlbum(r.config, r.fromFlickr, path); complete {
+				skipLog(r.log, skipReasonCompleteAlbum).WithField("path", path).Info("[SKIP] Album already complete")
+				if whole {
+					return filepath.SkipDir
+				}
+				completeDirs[path] = true
+			}
+		}
+
+		if info.IsDir() && !completeDirs[path] {
+			r.prehash(path)
+		}
+
+		// Only treat files
+		if !info.IsDir() && !completeDirs[filepath.Dir(path)] {
+			if err := r.processTracked(path); err == ErrUploadQuota || err == ErrAuthorization || err == errUploadCap || err == errFileLimit {
+				return err
+			}
+			r.logProgress()
+		}
+		return err
+	})
+}
+
+// albumLog returns the logger of an album, whose lines all carry the album field
+func (r *syncRun) albumLog(album string) *logrus.Entry {
+	entry, ok := r.albumLogs[album]
+	if !ok {
+		entry = r.log.WithField("album", album)
+		r.albumLogs[album] = entry
+	}
+	return entry
+}
+
+// rawPair returns the extension (lowercase, without dot) of the RAW file sharing the
+// name of a photo, or an empty string when the photo is not part of a RAW+JPEG pair
+func (r *syncRun) rawPair(path string) string {
+	if len(r.config.RawExtensions) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(path)
+	pairs, ok := r.rawPairs[dir]
+	if !ok {
+		pairs = findRawPairs(r.config, dir)
+		r.rawPairs[dir] = pairs
+	}
+	return pairs[filepath.Base(path)]
+}
+
+// addPhoto records an uploaded photo into the album albumID titled title,
+// which is added to fromFlickr when it was just created
+func (r *syncRun) addPhoto(title string, albumID string, photo FlickrPhoto) {
+	if tag := photo.taggedPath(); tag != "" {
+		r.taggedPaths[tag] = true
+	}
+	recordPhoto(r.fromFlickr, title, albumID, photo, titleLess(r.config))
+}
+
+// relink adds a photo already on flickr but not in any album to the album titled
+// title, creating it when albumID is empty
+func (r *syncRun) relink(logger *logrus.Entry, title string, description string, albumID string, orphan FlickrPhoto) error {
+	if r.plan != nil {
+		r.plan.Update("add %s → %s", orphan.Title, title)
+		return nil
+	}
+
+	var err error
+	if albumID == "" {
+		albumID, err = CreateAlbum(r.client, logger, title, description, orphan.ID)
+	} else {
+		_, err = AppendPhotoIntoExistingAlbum(r.client, logger, albumID, orphan.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"photo.name": orphan.Title,
+		"photo.id":   orphan.ID,
+	}).Info("[OK] Orphan photo added to its album")
+	delete(r.orphans, orphan.Title)
+	r.addPhoto(title, albumID, orphan)
+	r.recordOrder(albumID, orphan.ID, true)
+	return nil
+}
+
+// albumMeta returns the metadata of the album.yaml of dir, read on first use
+func (r *syncRun) albumMeta(dir string) albumMeta {
+	meta, ok := r.albumMetas[dir]
+	if !ok {
+		var err error
+		meta, err = readAlbumMeta(r.config, dir)
+		if err != nil {
+			r.log.WithFields(logrus.Fields{
+				"path":  filepath.Join(dir, albumMetaFile),
+				"error": err,
+			}).Warn("[WARNING] Could not read album metadata, using defaults")
+		}
+		r.albumMetas[dir] = meta
+	}
+	return meta
+}
+
+// addToCollection records that an album belongs to the collection of a photo
+func (r *syncRun) addToCollection(path string, albumID string) {
+	name := collectionName(r.config, path)
+	if !r.config.UseCollections || name == "" || albumID == "" {
+		return
+	}
+	if r.collections[name] == nil {
+		r.collections[name] = make(map[string]bool)
+	}
+	r.collections[name][albumID] = true
+}
+
+// groupCollections puts the albums met during the run into their collection
+func (r *syncRun) groupCollections() {
+	var names []string
+	for name := range r.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var ids []string
+		for id := range r.collections[name] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		if r.plan != nil {
+			r.plan.Update("collection %s ← %d albums", name, len(ids))
+			continue
+		}
+
+		id, err := ensureCollection(r.client, name, ids)
+		if err != nil {
+			r.log.WithFields(logrus.Fields{
+				"collection": name,
+				"error":      err,
+			}).Error("[ERROR] Could not update collection")
+			continue
+		}
+		r.log.WithFields(logrus.Fields{
+			"collection":    name,
+			"collection.id": id,
+			"albums":        len(ids),
+		}).Info("[OK] Collection updated")
+	}
+}
+
+// recordOrder appends a photo to the local order of its album when EnforcePhotoOrder
+// is set. added tells whether the photo was just added to the album
+func (r *syncRun) recordOrder(albumID string, photoID string, added bool) {
+	if !r.config.EnforcePhotoOrder || albumID == "" {
+		return
+	}
+	r.photoOrder[albumID] = append(r.photoOrder[albumID], photoID)
+	if added {
+		r.reorder[albumID] = true
+	}
+}
+
+// reorderAlbums sorts the photos of the albums which received photos during the
+// run in the order of the local files
+func (r *syncRun) reorderAlbums() {
+	var ids []string
+	for id := range r.reorder {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if r.plan != nil {
+			r.plan.Update("reorder album %s", id)
+			continue
+		}
+		if err := reorderAlbum(r.client, id, r.photoOrder[id]); err != nil {
+			r.log.WithFields(logrus.Fields{
+				"album.id": id,
+				"error":    err,
+			}).Error("[ERROR] Could not reorder album")
+			continue
+		}
+		r.log.WithFields(logrus.Fields{
+			"album.id": id,
+			"photos":   len(r.photoOrder[id]),
+		}).Info("[OK] Album reordered")
+	}
+}
+
+// forget drops what is cached about a directory, whose content changed
+func (r *syncRun) forget(dir string) {
+	delete(r.rawPairs, dir)
+	delete(r.albumMetas, dir)
+	delete(r.dirTitles, dir)
+}
+
+// findRawPairs groups the files of a directory by stem and returns, for each photo
+// with an allowed extension, the extension of the RAW file having the same stem
+func findRawPairs(config *Config, dir string) map[string]string {
+	pairs := make(map[string]string)
+	entries, err := readLibraryDir(config, dir)
+	if err != nil {
+		return pairs
+	}
+
+	rawByStem := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && matchesExtension(name, config.RawExtensions) {
+			stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+			rawByStem[stem] = strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !hasAllowedExtension(config, name) {
+			continue
+		}
+		stem := strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))
+		if raw, ok := rawByStem[stem]; ok {
+			pairs[name] = raw
+		}
+	}
+	return pairs
+}
+
+// matchesExtension tells whether the name of a file ends, ignoring case, with one
+// of exts. Extensions may be compound, such as ".tar.gz", and their leading dot
+// may be omitted. A file named after the extension alone, such as ".jpg", has no
+// extension
+func matchesExtension(path string, exts []string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	for _, e := range exts {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if len(name) > len(e) && strings.HasSuffix(name, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// photoParams returns the upload parameters of a file: its title, description
+// and tags as computed from the configuration, the sidecars and the templates
+func (r *syncRun) photoParams(path string, album string, meta albumMeta, rawExt string) *flickr.UploadParams {
+	fileMeta, _ := lookupPhotoMeta(r.config, r.photoMetas, path)
+	params := r.naming(path).meta(r.config).apply(fileMeta.apply(meta.apply(buildUploadParams(r.config, path))))
+	if rawExt != "" && r.config.RawPolicy == RawPolicyTagRaw {
+		params = withTags(params, rawTag, rawExt)
+	}
+	// flickr albums have no tags: the keywords of an album go to its photos
+	if tags := r.config.AlbumTags[album]; len(tags) > 0 {
+		params = withTags(params, sanitizeTags(tags)...)
+	}
+	// flickr would name the photo after its file
+	if title := r.photoTitle(path); title != r.baseTitle(path) {
+		params = withTags(params)
+		params.Title = title
+	}
+	return params
+}
+
+// processFile uploads a local file unless it's not supported or already present in fromFlickr.
+// fromFlickr is updated with the uploaded photo.
+// It returns ErrUploadQuota when flickr refused the upload because of the quota,
+// ErrAuthorization when it rejected the token, errUploadCap when the file should
+// be uploaded but the run reached MaxUploadsPerRun, and errFileLimit when FileLimit
+// files were already processed.
+func (r *syncRun) processFile(path string) error {
+	isAllowedExt := false
+	isRootDir := false
+
+	if filepath.Base(path) == albumMetaFile {
+		return nil
+	}
+
+	meta := r.albumMeta(filepath.Dir(path))
+	currentDir := albumTitle(r.config, path)
+	if album, ok := routeAlbum(r.config, r.routes, path); ok {
+		currentDir = album
+	}
+	if meta.Title != "" {
+		currentDir = meta.Title
+	}
+	logger := r.albumLog(currentDir)
+
+	if isHidden(r.config, path) {
+		skipLog(logger, skipReasonHidden).WithField("path", path).Debug("[SKIP] Hidden file.")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	if isExcludedPath(r.config, path) {
+		skipLog(logger, skipReasonExcluded).WithField("path", path).Debug("[SKIP] Excluded file.")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	// Files on the base root path are only uploaded when a root album is configured
+	if filepath.Dir(path) == r.config.PhotoLibraryPath && r.config.RootAlbumName == "" {
+		skipLog(logger, skipReasonRoot).WithField("path", path).Info("[SKIP] Root folder not processed.")
+		skippedTotal.Inc()
+		isRootDir = true
+	}
+
+	isAllowedExt = hasAllowedExtension(r.config, path)
+
+	if !isRootDir && matchesExtension(path, r.config.RawExtensions) {
+		skipLog(logger, skipReasonRaw).WithField("path", path).Debug("[SKIP] RAW file not uploaded.")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	// Unsupported files are common in mixed directories, they are only logged on demand
+	if !isRootDir && !isAllowedExt {
+		entry := skipLog(logger, skipReasonUnsupported)
+		if r.config.LogUnsupported {
+			entry.WithField("path", path).Warn("[SKIP] File not supported.")
+		}
+		skippedTotal.Inc()
+	}
+
+	if !isAllowedExt || isRootDir {
+		return nil
+	}
+
+	if r.config.FileLimit > 0 && r.processed >= r.config.FileLimit {
+		return errFileLimit
+	}
+	r.processed++
+
+	if album := r.naming(path).Album; album != "" {
+		currentDir = album
+		logger = r.albumLog(currentDir)
+	}
+
+	// e.g. a directory named with spaces, or a template rendering nothing
+	if strings.TrimSpace(currentDir) == "" {
+		if r.config.FallbackAlbum == "" {
+			skipLog(logger, skipReasonEmptyTitle).WithField("path", path).Warn("[SKIP] Empty album title")
+			skippedTotal.Inc()
+			return nil
+		}
+		logger.WithFields(logrus.Fields{
+			"path":           path,
+			"fallback_album": r.config.FallbackAlbum,
+		}).Warn("[WARNING] Empty album title, using the fallback album")
+		currentDir = r.config.FallbackAlbum
+		logger = r.albumLog(currentDir)
+	}
+
+	// A file skipped below still belongs to its album, pruning must keep its
+	// photo on flickr
+	photoName := r.photoTitle(path)
+	if isMirrored(r.config, currentDir) {
+		r.mirror.see(currentDir, photoName, pathMachineTag(r.config, path))
+	}
+
+	if info, err := statLibraryFile(r.config, path); err == nil && info.Size() > maxFileBytes(r.config, path) {
+		skipLog(logger, skipReasonTooLarge).WithFields(logrus.Fields{
+			"path":  path,
+			"size":  info.Size(),
+			"limit": maxFileBytes(r.config, path),
+		}).Warn("[SKIP] exceeds Flickr size limit")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	// A file modified within MinFileAge may still be being copied, a later run
+	// picks it up
+	if r.config.MinFileAge > 0 {
+		if info, err := statLibraryFile(r.config, path); err == nil && time.Since(info.ModTime()) < r.config.MinFileAge*time.Second {
+			skipLog(logger, skipReasonTooRecent).WithFields(logrus.Fields{
+				"path":     path,
+				"mod_time": info.ModTime(),
+			}).Info("[SKIP] too recent")
+			skippedTotal.Inc()
+			return nil
+		}
+	}
+
+	rawExt := r.rawPair(path)
+	if rawExt != "" && r.config.RawPolicy == RawPolicySkipPairs {
+		skipLog(logger, skipReasonRawPair).WithFields(logrus.Fields{
+			"path": path,
+			"raw":  rawExt,
+		}).Info("[SKIP] RAW+JPEG pair not uploaded.")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	if r.diff != nil {
+		r.diff.see(currentDir, photoName, pathMachineTag(r.config, path))
+	}
+
+	uploadNeeded := false
+	destinationAlbum := ""
+
+	if _, present := r.fromFlickr[currentDir]; !present && r.config.DetectRenames && albumsFollowDirectories(r.config) {
+		r.detectRename(logger, filepath.Dir(path), currentDir)
+	}
+
+	// Check if file need to be uploaded.
+	albums, albumPresent := r.fromFlickr[currentDir]
+	baseAlbum := currentDir
+	if r.config.MaxAlbumSize > 0 {
+		albums = r.overflowAlbums(currentDir)
+		albumPresent = len(albums) > 0
+	}
+
+	// Photos recorded in the index are recognized whatever their title, unless
+	// the file changed since
+	if r.indexedUpload(path) {
+		skipLog(logger, skipReasonUploaded).WithField("photo.name", photoName).Debug("[SKIP] Already uploded")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	// Photos uploaded with a path machine tag are recognized whatever their title
+	if tag := pathMachineTag(r.config, path); tag != "" && r.taggedPaths[strings.ToLower(tag)] {
+		if r.config.MetadataOnly && r.diff == nil {
+			if photo, ok := r.findTagged(strings.ToLower(tag)); ok {
+				if err := r.reconcileMetadata(logger, photo, photoName, r.photoParams(path, currentDir, meta, rawExt)); err != nil {
+					return err
+				}
+			}
+		}
+		skipLog(logger, skipReasonUploaded).WithField("photo.name", photoName).Debug("[SKIP] Already uploded")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	// The album is present in flickr. has the photo already been uploaded
+	// in any of the albums with this title?
+	// The photo also belongs to the albums listed by its .tags sidecar
+	tagged := tagAlbums(r.config, path, currentDir)
+
+	if albumPresent && len(albums) > 0 {
+		if found := findPhoto(albums, photoName, titleLess(r.config)); found < 0 {
+			uploadNeeded = true
+			destinationAlbum = albums[0].ID
+			// A full album overflows into the next one, created when missing
+			if r.config.MaxAlbumSize > 0 {
+				currentDir = r.currentOverflow(baseAlbum)
+				logger = r.albumLog(currentDir)
+				destinationAlbum = ""
+				if overflow := r.fromFlickr[currentDir]; len(overflow) > 0 {
+					destinationAlbum = overflow[0].ID
+				}
+			}
+		} else {
+			r.addToCollection(path, albums[found].ID)
+			if phi := albums[found].photoIndex(photoName, titleLess(r.config)); phi >= 0 {
+				r.recordOrder(albums[found].ID, albums[found].Photos[phi].ID, false)
+				if r.config.MetadataOnly && r.diff == nil {
+					if err := r.reconcileMetadata(logger, albums[found].Photos[phi], photoName, r.photoParams(path, currentDir, meta, rawExt)); err != nil {
+						return err
+					}
+				}
+				if r.diff == nil {
+					if err := r.addToAlbums(tagged, albums[found].Photos[phi]); err != nil {
+						return err
+					}
+				}
+			}
+			skipLog(logger, skipReasonUploaded).WithField("photo.name", photoName).Debug("[SKIP] Already uploded")
+			skippedTotal.Inc()
+		}
+	} else {
+		// The album is not present in flickr. The photo needs to be uploaded
+		uploadNeeded = true
+		destinationAlbum = ""
+	}
+
+	if uploadNeeded && r.diff != nil {
+		r.diff.missing(currentDir, path)
+		return nil
+	}
+
+	if uploadNeeded && r.config.MetadataOnly {
+		skipLog(logger, skipReasonMetadataOnly).WithField("path", path).Debug("[SKIP] Metadata only, not uploaded")
+		skippedTotal.Inc()
+		return nil
+	}
+
+	// A photo already in one of its tagged albums is added to the others
+	if photo, ok := r.findInAlbums(tagged, photoName); uploadNeeded && ok {
+		skipLog(logger, skipReasonUploaded).WithField("photo.name", photoName).Debug("[SKIP] Already uploded")
+		skippedTotal.Inc()
+		return r.addToAlbums(append([]string{currentDir}, tagged...), photo)
+	}
+
+	if orphan, ok := r.orphans[photoName]; uploadNeeded && ok {
+		if err := r.relink(logger, currentDir, meta.Description, destinationAlbum, orphan); err == ErrAuthorization {
+			return err
+		}
+		return nil
+	}
+
+	// A video flickr already received, e.g. during an attempt which timed out
+	// afterwards, is added to its album instead of being uploaded again
+	checksumTag := ""
+	if uploadNeeded {
+		checksumTag = r.videoChecksumTag(logger, path)
+	}
+	if checksumTag != "" {
+		if found, err := r.relinkByChecksum(logger, currentDir, meta.Description, destinationAlbum, photoName, checksumTag); found || err == ErrAuthorization {
+			return err
+		}
+	}
+
+	// e.g. a half-copied JPEG, which flickr would show as a broken image
+	if uploadNeeded && r.config.VerifyLocalIntegrity {
+		if err := verifyImage(r.config, path); err != nil {
+			skipLog(logger, skipReasonCorrupt).WithFields(logrus.Fields{
+				"path":  path,
+				"error": err,
+			}).Warn("[SKIP] corrupt image")
+			skippedTotal.Inc()
+			return nil
+		}
+	}
+
+	if uploadNeeded && r.config.MaxUploadsPerRun > 0 && r.uploads >= r.config.MaxUploadsPerRun {
+		return errUploadCap
+	}
+
+	if uploadNeeded && r.plan != nil {
+		r.plan.Upload(relPath(r.config, path), currentDir)
+		for _, title := range tagged {
+			r.plan.Update("add %s → %s", photoName, title)
+		}
+		r.uploads++
+		return nil
+	}
+
+	if uploadNeeded {
+		attemptNb := 0
+		params := r.photoParams(path, baseAlbum, meta, rawExt)
+		if checksumTag != "" {
+			params = withTags(params, checksumTag)
+		}
+
+		uploadPath := path
+		if r.config.MaxDimension > 0 && shouldResize(r.config, path) {
+			resized, ok, err := resizeIfNeeded(r.config, path, r.config.MaxDimension)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"path":  path,
+					"error": err,
+				}).Warn("[WARNING] Could not resize photo, uploading original")
+			} else if ok {
+				uploadPath = resized
+				defer os.RemoveAll(filepath.Dir(resized))
+			}
+		}
+		// The original must not reach flickr when its metadata can't be removed
+		if r.config.StripExif {
+			stripped, err := stripExif(r.config, uploadPath)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"path":  path,
+					"error": err,
+				}).Error("[ERROR] Could not strip metadata, photo not uploaded")
+				r.recordFailure(logger, path, err, 0)
+				return nil
+			}
+			if stripped != uploadPath {
+				uploadPath = stripped
+				defer os.RemoveAll(filepath.Dir(stripped))
+			}
+		}
+		result, err := r.upload(logger, destinationAlbum, currentDir, meta.Description, uploadPath, params)
+
+		// A photo uploaded without its album is not uploaded again
+		albumFailed := func() bool { return result.PhotoID != "" && result.AlbumID == "" }
+		for err != nil && err != ErrUploadQuota && err != ErrAuthorization && !albumFailed() && attemptNb < r.config.UploadAttempts {
+			delay := retryDelay(err, r.backoff.delay())
+			logger.WithFields(logrus.Fields{
+				"attempt":  attemptNb,
+				"interval": delay,
+			}).Warn("[WARNING] Upload attempt failed. Waiting before retry")
+
+			r.sleep(delay)
+
+			if checksumTag != "" {
+				if found, err := r.relinkByChecksum(logger, currentDir, meta.Description, destinationAlbum, photoName, checksumTag); found || err == ErrAuthorization {
+					return err
+				}
+			}
+
+			attemptNb++
+			result, err = r.upload(logger, destinationAlbum, currentDir, meta.Description, uploadPath, params)
+		}
+
+		if err != nil && err != ErrUploadQuota && err != ErrAuthorization && albumFailed() {
+			r.countUpload(result)
+			r.hold(currentDir, heldPhoto{logger, path, photoName, meta.Description, tagged, result})
+		} else if err != nil {
+			logger.WithFields(logrus.Fields{
+				"attempt":    attemptNb,
+				"photo.name": photoName,
+			}).Error("[ERROR] Upload failed")
+			r.recordFailure(logger, path, err, attemptNb+1)
+			if err == ErrUploadQuota || err == ErrAuthorization {
+				return err
+			}
+		} else {
+			r.countUpload(result)
+			if err := r.filed(logger, currentDir, path, photoName, tagged, result); err != nil {
+				return err
+			}
+			if result.AlbumCreated {
+				return r.fileHeld(currentDir, result.AlbumID)
+			}
+		}
+	}
+	return nil
+}
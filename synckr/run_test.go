@@ -0,0 +1,180 @@
+package synckr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRawPolicies(t *testing.T) {
+	tests := []struct {
+		policy   string
+		expected map[string]string
+	}{
+		{RawPolicyJPEGOnly, map[string]string{"IMG_1": "", "IMG_2": ""}},
+		{RawPolicyTagRaw, map[string]string{"IMG_1": "raw cr2", "IMG_2": ""}},
+		{RawPolicySkipPairs, map[string]string{"IMG_2": ""}},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/IMG_1.CR2", "album/IMG_1.JPG", "album/IMG_2.JPG", "album/IMG_3.nef")
+
+		config := testConfig(root)
+		config.RawExtensions = []string{".cr2", ".nef"}
+		config.RawPolicy = tt.policy
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		uploaded := make(map[string]string)
+		for _, ph := range stub.photos {
+			uploaded[ph.Title] = ph.Args.Get("tags")
+		}
+		if len(uploaded) != len(tt.expected) {
+			var titles []string
+			for title := range uploaded {
+				titles = append(titles, title)
+			}
+			sort.Strings(titles)
+			t.Errorf("%s: expected %d uploads, got %v", tt.policy, len(tt.expected), titles)
+		}
+		for title, tags := range tt.expected {
+			if got, ok := uploaded[title]; !ok || got != tags {
+				t.Errorf("%s: expected %s to be uploaded with tags %q, got %q (uploaded: %v)", tt.policy, title, tags, got, ok)
+			}
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestAlbumLogger(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/notes.txt", "other/c.jpg")
+	defer os.RemoveAll(root)
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Formatter = &logrus.JSONFormatter{}
+
+	config := testConfig(root)
+	config.LogLevel = "debug"
+	if _, err := Process(&config, stub.client(), logger); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines logged once the albums are loaded all relate to a file, up to the
+	// final line summing up the run
+	loaded := false
+	lines := 0
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", scanner.Text(), err)
+		}
+		if !loaded {
+			loaded = entry["msg"] == "[OK] Albums have been loaded"
+			continue
+		}
+		if _, ok := entry["bytes_uploaded"]; ok {
+			break
+		}
+		lines++
+		if _, ok := entry["album"]; !ok {
+			t.Errorf("expected album field in %q", scanner.Text())
+		}
+	}
+	if lines == 0 {
+		t.Error("expected lines to be logged while processing files")
+	}
+}
+
+func TestLogUnsupported(t *testing.T) {
+	for _, logUnsupported := range []bool{false, true} {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/a.jpg", "album/notes.txt", "album/thumbs.db")
+
+		var out bytes.Buffer
+		logger := logrus.New()
+		logger.Out = &out
+
+		config := testConfig(root)
+		config.LogLevel = "debug"
+		config.LogUnsupported = logUnsupported
+		skipped := skippedTotal.Value()
+		if _, err := Process(&config, stub.client(), logger); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Count(out.String(), "File not supported")
+		if logUnsupported && lines != 2 {
+			t.Errorf("Expected both unsupported files to be logged, got %d lines", lines)
+		}
+		if !logUnsupported && lines != 0 {
+			t.Errorf("Unsupported files should not be logged by default, got %d lines", lines)
+		}
+		if skippedTotal.Value()-skipped != 2 {
+			t.Errorf("Unsupported files should always be counted, got %d", skippedTotal.Value()-skipped)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestMatchesExtension(t *testing.T) {
+	exts := []string{".jpg", ".JPEG", "png", ".tar.gz"}
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"/photos/a.jpg", true},
+		{"/photos/a.JPG", true},
+		{"/photos/a.Jpeg", true},
+		{"/photos/a.PnG", true},
+		{"/photos/my.holiday.photo.jpg", true},
+		{"/photos/backup.TAR.GZ", true},
+		{"/photos/backup.gz", false},
+		{"/photos/a.jpg.txt", false},
+		{"/photos/ajpg", false},
+		{"/photos/.jpg", false},
+		{"/photos.jpg/readme", false},
+	}
+	for _, tt := range tests {
+		if got := matchesExtension(tt.path, exts); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessMixedCaseExtensions(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.JPG", "album/b.Jpeg", "album/c.png.bak", "album/d.tar.gz")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.Extensions = []string{".JPG", ".jpeg"}
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	titles := stub.titles(stub.set("album"))
+	sort.Strings(titles)
+	if strings.Join(titles, ",") != "a,b" {
+		t.Errorf("Extensions should match ignoring case, got %v", titles)
+	}
+}
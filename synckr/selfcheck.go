@@ -0,0 +1,89 @@
+package synckr
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/masci/flickr.v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// insufficientPermissionsErrorCode is returned by flickr when the token lacks
+// the permission required by a method
+const insufficientPermissionsErrorCode = 99
+
+// probePhotoID does not match any photo: writing to it changes nothing but
+// tells whether the token may write
+const probePhotoID = "0"
+
+// ErrNoWritePermission is returned by SelfCheck when the token can't upload
+var ErrNoWritePermission error = &Error{Kind: ErrAuth, Err: errors.New("the oauth token has no write permission")}
+
+// loginResponse is the response of flickr.test.login
+type loginResponse struct {
+	flickr.BasicResponse
+	User struct {
+		ID       string `xml:"id,attr"`
+		Username string `xml:"username"`
+	} `xml:"user"`
+}
+
+// checkTokenResponse is the response of flickr.auth.oauth.checkToken
+type checkTokenResponse struct {
+	flickr.BasicResponse
+	Perms string `xml:"oauth>perms"`
+}
+
+// selfCheckError sorts the failure of a self check step: an ErrAuth when flickr
+// rejected the token, an ErrRetrieve when flickr could not be reached
+func selfCheckError(resp flickr.FlickrResponse, step string, err error) error {
+	kind := ErrRetrieve
+	if isAuthError(resp) {
+		kind = ErrAuth
+	}
+	return kindError(kind, "self check", fmt.Errorf("%s failed: %v", step, err))
+}
+
+// SelfCheck validates the credentials of the client: the token must authenticate
+// and be allowed to write, an ErrAuth is returned otherwise. An ErrRetrieve is
+// returned when flickr can't be reached. The authenticated user and the token
+// scope are logged
+func SelfCheck(client *flickr.FlickrClient) error {
+	client.Init()
+	client.Args.Set("method", "flickr.test.login")
+	client.OAuthSign()
+	login := &loginResponse{}
+	if err := flickr.DoGet(client, login); err != nil {
+		return selfCheckError(login, "login", err)
+	}
+
+	client.Init()
+	client.Args.Set("method", "flickr.auth.oauth.checkToken")
+	client.Args.Set("oauth_token", client.OAuthToken)
+	client.ApiSign()
+	token := &checkTokenResponse{}
+	if err := flickr.DoGet(client, token); err != nil {
+		return selfCheckError(token, "token check", err)
+	}
+
+	// The probe targets no photo: any error but a permission one proves the
+	// token may write
+	client.Init()
+	client.HTTPVerb = "POST"
+	client.Args.Set("method", "flickr.photos.setMeta")
+	client.Args.Set("photo_id", probePhotoID)
+	client.OAuthSign()
+	probe := &flickr.BasicResponse{}
+	flickr.DoPost(client, probe)
+	if probe.ErrorCode() == insufficientPermissionsErrorCode {
+		return ErrNoWritePermission
+	}
+
+	log.WithFields(logrus.Fields{
+		"username": login.User.Username,
+		"user.id":  login.User.ID,
+		"perms":    token.Perms,
+	}).Info("[OK] Credentials are valid")
+	return nil
+}
@@ -0,0 +1,52 @@
+package synckr
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestSelfCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		hooks map[string]string
+		kind  error
+	}{
+		{"valid", nil, nil},
+		{"invalid login", map[string]string{
+			"flickr.test.login": stubError(98, "Invalid auth token"),
+		}, ErrAuth},
+		{"read only", map[string]string{
+			"flickr.auth.oauth.checkToken": `<rsp stat="ok"><oauth><perms>read</perms></oauth></rsp>`,
+			"flickr.photos.setMeta":        stubError(insufficientPermissionsErrorCode, "Insufficient permissions"),
+		}, ErrAuth},
+		{"unavailable", map[string]string{
+			"flickr.auth.oauth.checkToken": stubError(105, "Service currently unavailable"),
+		}, ErrRetrieve},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		for method, body := range tt.hooks {
+			body := body
+			stub.hook(method, func(args url.Values) string { return body })
+		}
+
+		err := SelfCheck(stub.client())
+		if tt.kind == nil && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%s: expected an %v, got %v", tt.name, tt.kind, err)
+		}
+		stub.Close()
+	}
+
+	// flickr can't be reached
+	stub := newFlickrStub(t)
+	client := stub.client()
+	stub.Close()
+	if err := SelfCheck(client); !errors.Is(err, ErrRetrieve) {
+		t.Errorf("A transport error should be an ErrRetrieve, got %v", err)
+	}
+}
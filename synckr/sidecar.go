@@ -0,0 +1,35 @@
+package synckr
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Sidecars are files named after a photo with an additional extension, such
+// as IMG_1.jpg.txt, holding its description
+const (
+	jsonSidecarExt = ".json"
+	textSidecarExt = ".txt"
+)
+
+// jsonSidecar is the part of a JSON sidecar read by synckr, as written by e.g.
+// Google Takeout
+type jsonSidecar struct {
+	Description string `json:"description"`
+}
+
+// sidecarDescription returns the description of a photo read from its JSON
+// sidecar, or from its text sidecar when the JSON one has none. It is empty
+// when the photo has no sidecar
+func sidecarDescription(config *Config, path string) string {
+	if raw, err := readLibraryFile(config, path+jsonSidecarExt); err == nil {
+		var sidecar jsonSidecar
+		if json.Unmarshal(raw, &sidecar) == nil && strings.TrimSpace(sidecar.Description) != "" {
+			return strings.TrimSpace(sidecar.Description)
+		}
+	}
+	if raw, err := readLibraryFile(config, path+textSidecarExt); err == nil {
+		return strings.TrimSpace(string(raw))
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+package synckr
+
+// Size limits documented by flickr, used when MaxFileBytes is not set
+const (
+	flickrPhotoMaxBytes = 200 << 20
+	flickrVideoMaxBytes = 1 << 30
+)
+
+// videoExtensions are the extensions subject to the flickr video size limit
+var videoExtensions = []string{".mp4", ".mov", ".avi", ".mpg", ".mpeg", ".m4v", ".wmv", ".3gp", ".mts", ".m2ts", ".ogv"}
+
+// maxFileBytes returns the size above which a file is not uploaded
+func maxFileBytes(config *Config, path string) int64 {
+	if config.MaxFileBytes > 0 {
+		return config.MaxFileBytes
+	}
+	if matchesExtension(path, videoExtensions) {
+		return flickrVideoMaxBytes
+	}
+	return flickrPhotoMaxBytes
+}
@@ -0,0 +1,48 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaxFileBytes(t *testing.T) {
+	tests := []struct {
+		max      int64
+		path     string
+		expected int64
+	}{
+		{0, "a.jpg", flickrPhotoMaxBytes},
+		{0, "a.MP4", flickrVideoMaxBytes},
+		{0, "clip.final.Mov", flickrVideoMaxBytes},
+		{1000, "a.jpg", 1000},
+		{1000, "a.mov", 1000},
+	}
+
+	for _, tt := range tests {
+		config := Config{MaxFileBytes: tt.max}
+		if got := maxFileBytes(&config, tt.path); got != tt.expected {
+			t.Errorf("%s with max %d: expected %d, got %d", tt.path, tt.max, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessSkipsFilesAboveSizeLimit(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/under.jpg", "album/over.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "album", "under.jpg"), make([]byte, 100), 0644)
+	ioutil.WriteFile(filepath.Join(root, "album", "over.jpg"), make([]byte, 101), 0644)
+
+	config := testConfig(root)
+	config.MaxFileBytes = 100
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if set := stub.set("album"); set == nil || len(stub.titles(set)) != 1 || stub.titles(set)[0] != "under" {
+		t.Errorf("Only the file under the limit should be uploaded, got %v", set)
+	}
+}
@@ -0,0 +1,33 @@
+package synckr
+
+import "github.com/sirupsen/logrus"
+
+// Reasons logged with every skip, and counted by reason in the run summary
+const (
+	skipReasonHidden           = "hidden"
+	skipReasonExcluded         = "excluded"
+	skipReasonRoot             = "root"
+	skipReasonRaw              = "raw"
+	skipReasonUnsupported      = "unsupported"
+	skipReasonEmptyTitle       = "empty_album_title"
+	skipReasonTooLarge         = "too_large"
+	skipReasonRawPair          = "raw_pair"
+	skipReasonUploaded         = "already_uploaded"
+	skipReasonInAlbum          = "already_in_album"
+	skipReasonMetadataOnly     = "metadata_only"
+	skipReasonCorrupt          = "corrupt"
+	skipReasonNoMedia          = "nomedia"
+	skipReasonMaxDepth         = "max_depth"
+	skipReasonCompleteAlbum    = "complete_album"
+	skipReasonSymlinkCycle     = "symlink_cycle"
+	skipReasonMirrorNoLocal    = "mirror_no_local_photo"
+	skipReasonMirrorMaxRemoval = "mirror_max_removals"
+	skipReasonTooRecent        = "too_recent"
+)
+
+// skipLog counts a skip for its reason and returns logger with the reason field
+// of the skip log
+func skipLog(logger logrus.FieldLogger, reason string) *logrus.Entry {
+	skipReasonsTotal.Inc(reason)
+	return logger.WithField("reason", reason)
+}
@@ -0,0 +1,79 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessSkipReasons(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	root := makeTree(t, "r.jpg", "album/a.jpg", "album/b.jpg", "album/.c.jpg", "album/notes.txt",
+		"album/.thumbs/d.jpg", "@eaDir/e.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.SkipHidden = true
+	summary := startRunSummary(&config)
+	_, err := Process(&config, stub.client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary = summary.finish(err)
+
+	expected := map[string]uint64{
+		skipReasonRoot:        1,
+		skipReasonUploaded:    1,
+		skipReasonHidden:      2,
+		skipReasonUnsupported: 1,
+		skipReasonExcluded:    1,
+	}
+	if !reflect.DeepEqual(summary.skipReasons, expected) {
+		t.Errorf("Expected the skips %v, got %v", expected, summary.skipReasons)
+	}
+
+	mail := string(composeSummary(&SMTPConfig{}, summary))
+	if !strings.Contains(mail, "Skipped by reason:\r\n  already_uploaded: 1\r\n  excluded: 1\r\n  hidden: 2\r\n") {
+		t.Errorf("The summary should tally the skips by reason, got %q", mail)
+	}
+}
+
+func TestMinFileAge(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "album/old.jpg", "album/copying.jpg")
+	defer os.RemoveAll(root)
+	earlier := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(root, "album", "old.jpg"), earlier, earlier)
+
+	config := testConfig(root)
+	config.MinFileAge = 60
+	summary := startRunSummary(&config)
+	_, err := Process(&config, stub.client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary = summary.finish(err)
+
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, []string{"old"}) {
+		t.Errorf("Only the older file should be uploaded, got %v", titles)
+	}
+	if summary.skipReasons[skipReasonTooRecent] != 1 {
+		t.Errorf("The just modified file should be skipped as too recent, got %v", summary.skipReasons)
+	}
+
+	// Once the copy is done, a later run picks the file up
+	os.Chtimes(filepath.Join(root, "album", "copying.jpg"), earlier, earlier)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("The file should be uploaded by a later run, got %d uploads", stub.count("upload"))
+	}
+}
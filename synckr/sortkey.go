@@ -0,0 +1,73 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Orders of the local files set by SortKey. Photo titles stay the key of the
+// flickr-side index, which dedup looks titles up in
+const (
+	// SortKeyTitle orders the files by name, naturally when NaturalSort is set
+	SortKeyTitle = "title"
+	// SortKeyExifDate orders the files by EXIF capture date
+	SortKeyExifDate = "exif_date"
+	// SortKeyModTime orders the files by modification time
+	SortKeyModTime = "modtime"
+)
+
+// sortsByTime tells whether SortKey orders files by one of their dates
+func sortsByTime(config *Config) bool {
+	return config.SortKey == SortKeyExifDate || config.SortKey == SortKeyModTime
+}
+
+// fileTime returns the date a file is ordered by: its EXIF capture date with
+// SortKeyExifDate, its modification time otherwise or when it has none
+func fileTime(config *Config, path string, info os.FileInfo) time.Time {
+	if config.SortKey == SortKeyExifDate {
+		if exif, err := readExif(config, path); err == nil && !exif.DateTaken.IsZero() {
+			return exif.DateTaken
+		}
+	}
+	return info.ModTime()
+}
+
+// sortEntries sorts the names of the entries of dir in the order they are
+// uploaded. Names are in title order first. When SortKey is a date, files then
+// come by date, in title order for the same date, followed by the directories.
+// stat returns the information of an entry, entries it fails for come last
+func sortEntries(config *Config, dir string, names []string, stat func(name string) (os.FileInfo, error)) {
+	less := titleLess(config)
+	sort.SliceStable(names, func(i, j int) bool { return less(names[i], names[j]) })
+	if !sortsByTime(config) {
+		return
+	}
+
+	type entry struct {
+		isFile bool
+		time   time.Time
+	}
+	entries := make(map[string]entry, len(names))
+	for _, name := range names {
+		if info, err := stat(name); err == nil {
+			e := entry{isFile: !info.IsDir()}
+			if e.isFile {
+				e.time = fileTime(config, filepath.Join(dir, name), info)
+			}
+			entries[name] = e
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		a, aok := entries[names[i]]
+		b, bok := entries[names[j]]
+		if aok != bok {
+			return aok
+		}
+		if a.isFile != b.isFile {
+			return a.isFile
+		}
+		return a.time.Before(b.time)
+	})
+}
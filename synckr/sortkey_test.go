@@ -0,0 +1,87 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestProcessSortKey(t *testing.T) {
+	tests := []struct {
+		sortKey  string
+		expected []string
+	}{
+		{SortKeyTitle, []string{"a", "b", "c"}},
+		{SortKeyExifDate, []string{"c", "a", "b"}},
+		{SortKeyModTime, []string{"b", "c", "a"}},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t)
+		dir := filepath.Join(root, "album")
+		os.MkdirAll(dir, 0755)
+		files := []struct {
+			name    string
+			taken   string
+			modTime time.Time
+		}{
+			{"a.jpg", "2019:07:14 10:00:00", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+			{"b.jpg", "2019:07:15 10:00:00", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{"c.jpg", "2019:07:13 10:00:00", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+		}
+		for _, f := range files {
+			path := filepath.Join(dir, f.name)
+			writeJPEGExif(t, path, 8, 8, exifSegment(1, f.taken))
+			os.Chtimes(path, f.modTime, f.modTime)
+		}
+
+		config := testConfig(root)
+		config.SortKey = tt.sortKey
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, tt.expected) {
+			t.Errorf("%s: expected upload order %v, got %v", tt.sortKey, tt.expected, titles)
+		}
+
+		// Dedup still finds the photos by title
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if stub.count("upload") != 3 {
+			t.Errorf("%s: expected no new upload, got %d uploads", tt.sortKey, stub.count("upload"))
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
+
+func TestSortKeyFS(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	fsys := fstest.MapFS{
+		"album/a.jpg":     {Data: []byte("a"), ModTime: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+		"album/b.jpg":     {Data: []byte("b"), ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"album/sub/c.jpg": {Data: []byte("c")},
+		"album/d.jpg":     {Data: []byte("d"), ModTime: time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	config := testConfig("/library")
+	config.SortKey = SortKeyModTime
+	var order []string
+	if _, err := ProcessWithOptions(&config, stub.client(), nil, ProcessOptions{FS: fsys}); err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range stub.sets {
+		order = append(order, stub.titles(set)...)
+	}
+	// The files of a directory come by date, before its subdirectories
+	if expected := []string{"b", "d", "a", "c"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected upload order %v, got %v", expected, order)
+	}
+}
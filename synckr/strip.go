@@ -0,0 +1,107 @@
+package synckr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// JPEG markers of the segments removed by stripExif: APP1 holds Exif and XMP,
+// APP13 holds IPTC, COM holds free text comments
+const (
+	jpegMarkerSOS     = 0xDA
+	jpegMarkerAPP1    = 0xE1
+	jpegMarkerAPP13   = 0xED
+	jpegMarkerComment = 0xFE
+)
+
+// pngMetadataChunks are the PNG chunks removed by stripExif
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+var errMalformedImage = errors.New("malformed image")
+
+// stripExif writes a copy of a JPEG or PNG photo without its metadata, such as
+// GPS coordinates, camera settings or comments. The pixels are not re-encoded and
+// the EXIF orientation of a JPEG is kept. Like resized copies, the copy keeps the
+// base name of the original and lives in its own temporary directory which the
+// caller must remove. Other files are returned unchanged
+func stripExif(config *Config, path string) (string, error) {
+	raw, err := readLibraryFile(config, path)
+	if err != nil {
+		return path, err
+	}
+
+	var stripped []byte
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xFF, 0xD8}):
+		stripped, err = stripJPEGMetadata(raw)
+		if exif, exifErr := readExif(config, path); err == nil && exifErr == nil && exif.Orientation > 1 {
+			stripped = append(append(stripped[:2:2], orientationSegment(exif.Orientation)...), stripped[2:]...)
+		}
+	case bytes.HasPrefix(raw, pngSignature):
+		stripped, err = stripPNGMetadata(raw)
+	default:
+		return path, nil
+	}
+	if err != nil {
+		return path, err
+	}
+
+	dir, err := ioutil.TempDir("", "synckr")
+	if err != nil {
+		return path, err
+	}
+	copyPath := filepath.Join(dir, filepath.Base(path))
+	if err := ioutil.WriteFile(copyPath, stripped, 0600); err != nil {
+		os.RemoveAll(dir)
+		return path, err
+	}
+	return copyPath, nil
+}
+
+// stripJPEGMetadata returns a JPEG stream without its metadata segments. The
+// segments following the start of scan are copied as is
+func stripJPEGMetadata(raw []byte) ([]byte, error) {
+	result := []byte{0xFF, 0xD8}
+	for i := 2; ; {
+		if i+4 > len(raw) || raw[i] != 0xFF {
+			return nil, errMalformedImage
+		}
+		marker := raw[i+1]
+		if marker == jpegMarkerSOS {
+			return append(result, raw[i:]...), nil
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(raw[i+2:]))
+		if end > len(raw) {
+			return nil, errMalformedImage
+		}
+		if marker != jpegMarkerAPP1 && marker != jpegMarkerAPP13 && marker != jpegMarkerComment {
+			result = append(result, raw[i:end]...)
+		}
+		i = end
+	}
+}
+
+// stripPNGMetadata returns a PNG stream without its metadata chunks
+func stripPNGMetadata(raw []byte) ([]byte, error) {
+	result := append([]byte{}, pngSignature...)
+	for i := len(pngSignature); i < len(raw); {
+		if i+12 > len(raw) {
+			return nil, errMalformedImage
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(raw[i:]))
+		if end > len(raw) || end < i {
+			return nil, errMalformedImage
+		}
+		if !pngMetadataChunks[string(raw[i+4:i+8])] {
+			result = append(result, raw[i:end]...)
+		}
+		i = end
+	}
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package synckr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exifGPSTagPointer is the IFD0 tag pointing to the GPS IFD
+const exifGPSTagPointer = 0x8825
+
+// gpsExifSegment builds an APP1 segment holding an orientation and a GPS IFD
+// locating the photo in the northern hemisphere
+func gpsExifSegment(orientation int) []byte {
+	order := binary.LittleEndian
+	entry := func(tag uint16, typ uint16, count uint32, value uint32) []byte {
+		e := make([]byte, 12)
+		order.PutUint16(e[0:], tag)
+		order.PutUint16(e[2:], typ)
+		order.PutUint32(e[4:], count)
+		order.PutUint32(e[8:], value)
+		return e
+	}
+
+	// header, IFD0 with two entries, then the GPS IFD with a GPSLatitudeRef
+	gpsOffset := 8 + 2 + 2*12 + 4
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = append(tiff, 2, 0)
+	tiff = append(tiff, entry(exifTagOrientation, 3, 1, uint32(orientation))...)
+	tiff = append(tiff, entry(exifGPSTagPointer, 4, 1, uint32(gpsOffset))...)
+	tiff = append(tiff, 0, 0, 0, 0)
+	tiff = append(tiff, 1, 0)
+	tiff = append(tiff, entry(1, 2, 2, uint32('N'))...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// jpegSegment builds a segment with the given marker
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestStripExifJPEG(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "IMG_1.jpg")
+	segments := append(gpsExifSegment(6), jpegSegment(jpegMarkerAPP1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")...)
+	writeJPEGExif(t, path, 8, 4, append(segments, jpegSegment(jpegMarkerComment, "Shot at home")...))
+
+	stripped, err := stripExif(&Config{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(stripped))
+	if stripped == path || filepath.Base(stripped) != "IMG_1.jpg" {
+		t.Fatalf("Expected a copy named after the original, got %s", stripped)
+	}
+
+	raw, _ := ioutil.ReadFile(stripped)
+	segment, err := findExifSegment(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatal("The orientation should be kept in an Exif segment")
+	}
+	if _, ok := readIFD(segment, binary.BigEndian, 8)[exifGPSTagPointer]; ok {
+		t.Error("The GPS tags should be removed")
+	}
+	if exif, _ := readExif(&Config{}, stripped); exif.Orientation != 6 {
+		t.Errorf("Expected orientation 6 to be kept, got %d", exif.Orientation)
+	}
+	if bytes.Contains(raw, []byte("xmpmeta")) || bytes.Contains(raw, []byte("Shot at home")) {
+		t.Error("XMP and comments should be removed")
+	}
+	if w, h := imageSize(t, stripped); w != 8 || h != 4 {
+		t.Errorf("The image should be left intact, got %dx%d", w, h)
+	}
+}
+
+func TestStripExifPNG(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.png")
+
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(4, 4))
+	encoded := buf.Bytes()
+	// A tEXt chunk right after the 25 bytes IHDR chunk; its crc is not checked
+	text := []byte("\x00\x00\x00\x0atEXtGPS\x0048.85N\x00\x00\x00\x00")
+	data := append(append(append([]byte{}, encoded[:33]...), text...), encoded[33:]...)
+	ioutil.WriteFile(path, data, 0644)
+
+	stripped, err := stripExif(&Config{}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(stripped))
+	raw, _ := ioutil.ReadFile(stripped)
+	if bytes.Contains(raw, []byte("tEXt")) {
+		t.Error("Text chunks should be removed")
+	}
+	if _, _, err := image.Decode(bytes.NewReader(raw)); err != nil {
+		t.Errorf("The stripped copy should decode, got %v", err)
+	}
+
+	// Other files are uploaded as is
+	other := filepath.Join(dir, "clip.mp4")
+	ioutil.WriteFile(other, []byte("video"), 0644)
+	if stripped, err := stripExif(&Config{}, other); stripped != other || err != nil {
+		t.Errorf("Expected %s to be returned unchanged, got %s %v", other, stripped, err)
+	}
+}
+
+func TestProcessStripExifFailure(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/b.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "album", "a.jpg"), []byte("\xFF\xD8truncated"), 0644)
+
+	config := testConfig(root)
+	config.StripExif = true
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if titles := stub.titles(stub.set("album")); len(titles) != 1 || titles[0] != "b" {
+		t.Errorf("A photo whose metadata can't be stripped should not be uploaded, got %v", titles)
+	}
+}
@@ -0,0 +1,57 @@
+package synckr
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tickerFunc returns a channel ticking every d, and the function stopping it
+type tickerFunc func(d time.Duration) (<-chan time.Time, func())
+
+func newTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// reportSummaries logs a snapshot of the running counts of a run every
+// SummaryEvery until the returned function is called. The counts are read from
+// the metrics, which file workers update concurrently
+func reportSummaries(config *Config, logger logrus.FieldLogger, summary runSummary, ticker tickerFunc) func() {
+	if config.SummaryEvery <= 0 {
+		return func() {}
+	}
+	if ticker == nil {
+		ticker = newTicker
+	}
+
+	ticks, stopTicker := ticker(config.SummaryEvery * time.Second)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ticks:
+				s := summary.finish(nil)
+				logger.WithFields(logrus.Fields{
+					"elapsed":        s.duration.Round(time.Second),
+					"uploaded":       s.uploaded,
+					"skipped":        s.skipped,
+					"failed":         s.failed,
+					"bytes_uploaded": s.bytesUploaded,
+				}).Info("[OK] Run summary so far")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		stopTicker()
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,64 @@
+package synckr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestProcessReportsSummaries(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg", "album/c.jpg")
+	defer os.RemoveAll(root)
+
+	// The fake ticker ticks once per upload
+	var interval time.Duration
+	ticks := make(chan time.Time)
+	stopped := false
+	ticker := func(d time.Duration) (<-chan time.Time, func()) {
+		interval = d
+		return ticks, func() { stopped = true }
+	}
+	stub.hook("upload", func(args url.Values) string {
+		ticks <- time.Now()
+		return ""
+	})
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(copyHook{&out})
+
+	config := testConfig(root)
+	config.LogLevel = "info"
+	config.SummaryEvery = 300
+	if _, err := ProcessWithOptions(&config, stub.client(), logger, ProcessOptions{Ticker: ticker}); err != nil {
+		t.Fatal(err)
+	}
+
+	if interval != 5*time.Minute || !stopped {
+		t.Errorf("Expected a ticker every 5m stopped at the end of the run, got %s stopped %v", interval, stopped)
+	}
+	if n := strings.Count(out.String(), "[OK] Run summary so far"); n != 3 {
+		t.Errorf("Expected a summary per tick, got %d in %q", n, out.String())
+	}
+	if !strings.Contains(out.String(), "[OK] Run finished") {
+		t.Errorf("The final summary should still be logged, got %q", out.String())
+	}
+}
+
+func TestReportSummariesDisabled(t *testing.T) {
+	ticker := func(d time.Duration) (<-chan time.Time, func()) {
+		t.Error("No ticker should be started without SummaryEvery")
+		return nil, func() {}
+	}
+	reportSummaries(&Config{}, log, runSummary{}, ticker)()
+}
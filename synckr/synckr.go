@@ -1,10 +1,17 @@
 package synckr
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"sort"
@@ -22,24 +29,136 @@ import (
 
 var log = logrus.New()
 
+// uploadLimitErrorCode is the error code returned by the flickr upload API
+// when the user exceeded their upload limit
+const uploadLimitErrorCode = 6
+
+// defaultDeleteConcurrency is the number of duplicates deleted at once
+// when DeleteConcurrency is not set
+const defaultDeleteConcurrency = 4
+
+// ErrUploadQuota is returned when flickr refuses uploads because the user
+// reached their upload limit. No further upload is attempted once it's seen.
+var ErrUploadQuota error = &Error{Kind: ErrUpload, Err: errors.New("upload quota reached")}
+
+// ErrOAuthTokenRequired is returned by GetClient when the oauth token is missing
+// and NonInteractive forbids asking for one
+var ErrOAuthTokenRequired error = &Error{Kind: ErrAuth, Err: errors.New("OAuth token required; run `synckr -authorize` interactively first")}
+
+// errUploadCap stops a run which uploaded MaxUploadsPerRun photos
+var errUploadCap = errors.New("per-run upload cap reached")
+
+// errFileLimit stops a run which processed FileLimit files
+var errFileLimit = errors.New("file limit reached")
+
 // Config contains all configuration parameters for
 // the application.
 // It's filled from the json config file through LoadConfiguration
 type Config struct {
-	APIKey           string        `json:"api_key"`
-	APISecret        string        `json:"api_secret"`
-	PhotoLibraryPath string        `json:"photo_library_path"`
-	OAuthToken       string        `json:"oauth_token"`
-	OAuthTokenSecret string        `json:"oauth_token_secret"`
-	SkipDirs         []string      `json:"skip_dirs"`
-	Extensions       []string      `json:"extensions"`
-	DeleteDupes      bool          `json:"delete_dupes"`
-	LogLevel         string        `json:"log_level"`
-	LogOutput        string        `json:"log_output"`
-	UploadAttempts   int           `json:"upload_attempts"`
-	UploadInterval   time.Duration `json:"upload_interval"`
-	RetrieveAttempts int           `json:"retrieve_attempts"`
-	RetrieveInterval time.Duration `json:"retrieve_interval"`
+	APIKey                string              `json:"api_key"`
+	APISecret             string              `json:"api_secret"`
+	PhotoLibraryPath      string              `json:"photo_library_path"`
+	OAuthToken            string              `json:"oauth_token"`
+	OAuthTokenSecret      string              `json:"oauth_token_secret"`
+	SkipDirs              []string            `json:"skip_dirs"`
+	Extensions            []string            `json:"extensions"`
+	DeleteDupes           bool                `json:"delete_dupes"`
+	DeleteConcurrency     int                 `json:"delete_concurrency"`
+	LogLevel              string              `json:"log_level"`
+	LogOutput             string              `json:"log_output"`
+	UploadAttempts        int                 `json:"upload_attempts"`
+	UploadInterval        time.Duration       `json:"upload_interval"`
+	RetrieveAttempts      int                 `json:"retrieve_attempts"`
+	RetrieveInterval      time.Duration       `json:"retrieve_interval"`
+	AlbumDepth            int                 `json:"album_depth"`
+	MetricsAddr           string              `json:"metrics_addr"`
+	Watch                 bool                `json:"watch"`
+	WatchInterval         time.Duration       `json:"watch_interval"`
+	TagFromPath           bool                `json:"tag_from_path"`
+	SkipCompleteAlbums    bool                `json:"skip_complete_albums"`
+	MaxDimension          int                 `json:"max_dimension"`
+	RootAlbumName         string              `json:"root_album_name"`
+	PhotoTitleTemplate    string              `json:"photo_title_template"`
+	AlbumTitleTemplate    string              `json:"album_title_template"`
+	ResumeFile            string              `json:"resume_file"`
+	RawExtensions         []string            `json:"raw_extensions"`
+	RawPolicy             string              `json:"raw_policy"`
+	HTTPTimeout           time.Duration       `json:"http_timeout"`
+	UploadTimeout         time.Duration       `json:"upload_timeout"`
+	ReconcileOrphans      bool                `json:"reconcile_orphans"`
+	SkipHidden            bool                `json:"skip_hidden"`
+	MaxFileBytes          int64               `json:"max_file_bytes"`
+	PathMachineTag        bool                `json:"path_machine_tag"`
+	DetectRenames         bool                `json:"detect_renames"`
+	RenameThreshold       float64             `json:"rename_threshold"`
+	MaxUploadsPerRun      int                 `json:"max_uploads_per_run"`
+	LogUnsupported        bool                `json:"log_unsupported"`
+	NaturalSort           bool                `json:"natural_sort"`
+	UseCollections        bool                `json:"use_collections"`
+	CompressState         bool                `json:"compress_state"`
+	MetadataCSV           string              `json:"metadata_csv"`
+	TitleStripPrefixes    []string            `json:"title_strip_prefixes"`
+	TitleRegexReplace     []TitleReplacement  `json:"title_regex_replace"`
+	DryRun                bool                `json:"dry_run"`
+	PlanFile              string              `json:"plan_file"`
+	FollowSymlinks        bool                `json:"follow_symlinks"`
+	SMTP                  *SMTPConfig         `json:"smtp"`
+	TitleNormalization    string              `json:"title_normalization"`
+	NonInteractive        bool                `json:"non_interactive"`
+	FallbackAlbum         string              `json:"fallback_album"`
+	HashConcurrency       int                 `json:"hash_concurrency"`
+	ChecksumCacheFile     string              `json:"checksum_cache_file"`
+	EnforcePhotoOrder     bool                `json:"enforce_photo_order"`
+	AlbumNameStrategy     string              `json:"album_name_strategy"`
+	FileLimit             int                 `json:"file_limit"`
+	ProxyURL              string              `json:"proxy_url"`
+	BatchTag              bool                `json:"batch_tag"`
+	FailuresFile          string              `json:"failures_file"`
+	RetryFailures         bool                `json:"retry_failures"`
+	CreateEmptyAlbums     bool                `json:"create_empty_albums"`
+	PlaceholderPhoto      string              `json:"placeholder_photo"`
+	StateBackend          string              `json:"state_backend"`
+	StateFile             string              `json:"state_file"`
+	MaxDepth              int                 `json:"max_depth"`
+	NamingCommand         string              `json:"naming_command"`
+	NamingTimeout         time.Duration       `json:"naming_timeout"`
+	HiddenFromSearch      bool                `json:"hidden_from_search"`
+	AlbumSyncMode         map[string]string   `json:"album_sync_mode"`
+	MirrorMaxRemovals     int                 `json:"mirror_max_removals"`
+	VerifyLocalIntegrity  bool                `json:"verify_local_integrity"`
+	VideoChecksumTag      bool                `json:"video_checksum_tag"`
+	ProgressInterval      time.Duration       `json:"progress_interval"`
+	ETAWindow             int                 `json:"eta_window"`
+	HonorNoMedia          bool                `json:"honor_no_media"`
+	RetryJitter           float64             `json:"retry_jitter"`
+	AlbumNameParentLevel  int                 `json:"album_name_parent_level"`
+	AlbumTags             map[string][]string `json:"album_tags"`
+	MetadataOnly          bool                `json:"metadata_only"`
+	MaxAlbumSize          int                 `json:"max_album_size"`
+	RoutingFile           string              `json:"routing_file"`
+	UserAgent             string              `json:"user_agent"`
+	SummaryEvery          time.Duration       `json:"summary_every"`
+	StripExif             bool                `json:"strip_exif"`
+	DeleteEmptyAlbums     bool                `json:"delete_empty_albums"`
+	SecretsFile           string              `json:"secrets_file"`
+	FailureLog            string              `json:"failure_log"`
+	DirConcurrency        int                 `json:"dir_concurrency"`
+	DuplicateSuffixFormat string              `json:"duplicate_suffix_format"`
+	APIEndpoint           string              `json:"api_endpoint"`
+	PreserveAlbumOrder    bool                `json:"preserve_album_order"`
+	ResizeExtensions      []string            `json:"resize_extensions"`
+	MinFileAge            time.Duration       `json:"min_file_age"`
+	OnSuccess             string              `json:"on_success"`
+	IncludeFile           string              `json:"include_file"`
+	SortKey               string              `json:"sort_key"`
+	FullNameTitles        bool                `json:"full_name_titles"`
+	ExcludeGlobs          []string            `json:"exclude_globs"`
+
+	// batchID identifies the current run when BatchTag is set
+	batchID string
+
+	// fsys is the FS of the ProcessOptions of the current run
+	fsys fs.FS
 }
 
 // FlickrPhotoset contains the ID and the list of photo titles
@@ -49,11 +168,12 @@ type FlickrPhotoset struct {
 	Photos []FlickrPhoto
 }
 
-// FlickrPhoto contains the ID and the title for a given
-// photo retrieved from flickr
+// FlickrPhoto contains the ID, the title and the machine tags
+// for a given photo retrieved from flickr
 type FlickrPhoto struct {
 	ID    string
 	Title string
+	Tags  []string `json:",omitempty"`
 }
 
 // FlickrPhotosByTitle implements Sort interface to sort photos
@@ -64,46 +184,217 @@ func (a FlickrPhotosByTitle) Len() int           { return len(a) }
 func (a FlickrPhotosByTitle) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a FlickrPhotosByTitle) Less(i, j int) bool { return a[i].Title < a[j].Title }
 
+// hasPhoto tells whether the photoset, sorted by title in the less order, contains a photo
+// with the given title. Photos having a path machine tag are identified by their tag and
+// are not considered
+func (ps FlickrPhotoset) hasPhoto(title string, less func(a, b string) bool) bool {
+	return ps.photoIndex(title, less) >= 0
+}
+
+// photoIndex returns the index of the photo hasPhoto looks for, -1 when absent
+func (ps FlickrPhotoset) photoIndex(title string, less func(a, b string) bool) int {
+	phi := sort.Search(len(ps.Photos), func(i int) bool {
+		return !less(ps.Photos[i].Title, title)
+	})
+	for ; phi < len(ps.Photos) && ps.Photos[phi].Title == title; phi++ {
+		if ps.Photos[phi].taggedPath() == "" {
+			return phi
+		}
+	}
+	return -1
+}
+
+// withPhoto returns the photoset with an additional photo, keeping it sorted by title
+// in the less order
+func (ps FlickrPhotoset) withPhoto(photo FlickrPhoto, less func(a, b string) bool) FlickrPhotoset {
+	phi := sort.Search(len(ps.Photos), func(i int) bool {
+		return less(photo.Title, ps.Photos[i].Title)
+	})
+	photos := make([]FlickrPhoto, 0, len(ps.Photos)+1)
+	photos = append(photos, ps.Photos[:phi]...)
+	photos = append(photos, photo)
+	photos = append(photos, ps.Photos[phi:]...)
+	return FlickrPhotoset{ps.ID, photos}
+}
+
+// findPhoto returns the index of the album, among same-titled albums, containing a
+// photo with the given title, or -1 when none does
+func findPhoto(albums []FlickrPhotoset, title string, less func(a, b string) bool) int {
+	for i, album := range albums {
+		if album.hasPhoto(title, less) {
+			return i
+		}
+	}
+	return -1
+}
+
 // LoadConfiguration reads json configuration files and returns
-// a SynckrConfig pointer
+// a SynckrConfig pointer. The credentials of SecretsFile, when set, replace
+// the ones of the configuration file
 func LoadConfiguration(filename string) (Config, error) {
 	config := Config{
-		SkipDirs:         []string{"@eaDir"},
-		Extensions:       []string{".png", ".jpg", ".jpeg"},
-		DeleteDupes:      false,
-		LogLevel:         "INFO",
-		LogOutput:        "synckr.log",
-		UploadAttempts:   5,
-		UploadInterval:   30,
-		RetrieveAttempts: 5,
-		RetrieveInterval: 5,
+		SkipDirs:          []string{"@eaDir"},
+		Extensions:        []string{".png", ".jpg", ".jpeg"},
+		DeleteDupes:       false,
+		DeleteConcurrency: defaultDeleteConcurrency,
+		LogLevel:          "INFO",
+		LogOutput:         "synckr.log",
+		UploadAttempts:    5,
+		UploadInterval:    30,
+		RetrieveAttempts:  5,
+		RetrieveInterval:  5,
+		WatchInterval:     defaultWatchInterval,
+		HTTPTimeout:       defaultHTTPTimeout,
+		UploadTimeout:     defaultUploadTimeout,
+		SkipHidden:        true,
+		RawPolicy:         RawPolicyJPEGOnly,
+		SortKey:           SortKeyTitle,
+		FailuresFile:      defaultFailuresFile,
+		FailureLog:        defaultFailureLog,
+		HonorNoMedia:      true,
 	}
 
 	raw, err := ioutil.ReadFile(filename)
 
 	if err != nil {
 		log.Error(err.Error())
-	} else {
-		json.Unmarshal(raw, &config)
-		if config.APIKey == "" || config.APISecret == "" {
+		return config, kindError(ErrConfig, "load configuration", err)
+	}
+	json.Unmarshal(raw, &config)
+	if config.SecretsFile != "" {
+		if err := loadSecrets(config.SecretsFile, &config); err != nil {
 			log.WithFields(logrus.Fields{
-				"api_key":    config.APIKey,
-				"api_secret": config.APISecret,
-			}).Fatal("Please visit https://www.flickr.com/services/apps/create/noncommercial/ to apply for a non-commercial key.")
+				"secrets_file": config.SecretsFile,
+				"error":        err,
+			}).Error("Could not read secrets file")
+			return config, kindError(ErrConfig, "load secrets", err)
+		}
+	}
+	if config.APIKey == "" || config.APISecret == "" {
+		log.WithFields(logrus.Fields{
+			"api_key":    config.APIKey,
+			"api_secret": config.APISecret,
+		}).Error("Please visit https://www.flickr.com/services/apps/create/noncommercial/ to apply for a non-commercial key.")
+		return config, kindError(ErrConfig, "load configuration", errors.New("api_key and api_secret are required"))
+	}
+	if err := checkStateBackend(&config); err != nil {
+		log.WithFields(logrus.Fields{
+			"state_backend": config.StateBackend,
+			"error":         err,
+		}).Error("Unsupported state backend")
+		return config, kindError(ErrConfig, "load configuration", err)
+	}
+	return config, nil
+}
+
+// secrets are the credentials which may be kept in SecretsFile
+type secrets struct {
+	APIKey           string `json:"api_key"`
+	APISecret        string `json:"api_secret"`
+	OAuthToken       string `json:"oauth_token"`
+	OAuthTokenSecret string `json:"oauth_token_secret"`
+}
+
+// loadSecrets merges the credentials of a secrets file over the configuration.
+// Credentials missing from the secrets file keep their configured value
+func loadSecrets(filename string, config *Config) error {
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var s secrets
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{s.APIKey, &config.APIKey},
+		{s.APISecret, &config.APISecret},
+		{s.OAuthToken, &config.OAuthToken},
+		{s.OAuthTokenSecret, &config.OAuthTokenSecret},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+	return nil
+}
+
+// redactedValue replaces the secrets of a Redacted configuration
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of the configuration whose credentials are masked, to be
+// printed or logged. Missing credentials stay empty
+func (c Config) Redacted() Config {
+	mask := func(value *string) {
+		if *value != "" {
+			*value = redactedValue
+		}
+	}
+	mask(&c.APIKey)
+	mask(&c.APISecret)
+	mask(&c.OAuthToken)
+	mask(&c.OAuthTokenSecret)
+	if c.SMTP != nil {
+		smtp := *c.SMTP
+		mask(&smtp.Password)
+		c.SMTP = &smtp
+	}
+	if u, err := url.Parse(c.ProxyURL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+			c.ProxyURL = u.String()
 		}
 	}
-	return config, err
+	return c
 }
 
-// GetClient returns a flickr client
+// SaveOAuthToken writes an oauth token into the json configuration file, keeping
+// its other settings. The file is replaced atomically
+func SaveOAuthToken(filename string, token string, secret string) error {
+	settings := make(map[string]json.RawMessage)
+	raw, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return err
+	}
+	settings["oauth_token"], _ = json.Marshal(token)
+	settings["oauth_token_secret"], _ = json.Marshal(secret)
+
+	raw, err = json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(raw, '\n'))
+}
+
+// GetClient returns a flickr client. When the oauth token is missing, the user is
+// asked to authorize synckr, unless NonInteractive is set: ErrOAuthTokenRequired
+// is then returned. A failed authorization is an ErrAuth, a malformed ProxyURL an
+// ErrConfig
 func GetClient(config *Config) (flickr.FlickrClient, error) {
 	var err error
 	client := flickr.NewFlickrClient(config.APIKey, config.APISecret)
+	if _, err := parseProxyURL(config.ProxyURL); err != nil {
+		return *client, kindError(ErrConfig, "get client", err)
+	}
+	if _, err := parseAPIEndpoint(config.APIEndpoint); err != nil {
+		return *client, kindError(ErrConfig, "get client", err)
+	}
+	client.HTTPClient = NewHTTPClient(config, nil)
+
+	if (config.OAuthToken == "" || config.OAuthTokenSecret == "") && config.NonInteractive {
+		return *client, ErrOAuthTokenRequired
+	}
 
 	if config.OAuthToken == "" || config.OAuthTokenSecret == "" {
 		oauthToken, oauthTokenSecret, err := GetOAuthToken(client)
 		if err != nil {
-			log.Fatal("Could not generate OAuthToken")
+			return *client, kindError(ErrAuth, "get client", err)
 		}
 
 		log.WithFields(logrus.Fields{
@@ -151,134 +442,367 @@ func GetOAuthToken(client *flickr.FlickrClient) (string, string, error) {
 
 }
 
-// RetrievePageFromFlickr returns a FlickrPhoto array corresponding to a page in a flickr album. It retries when failure
-func RetrievePageFromFlickr(client *flickr.FlickrClient, config *Config, photosetID string, page int) ([]FlickrPhoto, error) {
+// RetrievePageFromFlickr returns a FlickrPhoto array corresponding to a page in a flickr album. It retries when failure,
+// unless the token was rejected: ErrAuthorization is then returned
+func RetrievePageFromFlickr(client *flickr.FlickrClient, config *Config, logger logrus.FieldLogger, photosetID string, page int) ([]FlickrPhoto, error) {
+	result, _, err := retrievePage(client, config, logger, photosetID, page)
+	return result, err
+}
+
+// retrievePage is RetrievePageFromFlickr, also returning the number of photos
+// flickr reports for the whole album
+func retrievePage(client *flickr.FlickrClient, config *Config, logger logrus.FieldLogger, photosetID string, page int) ([]FlickrPhoto, int, error) {
 	nbAttempts := 0
 	var result []FlickrPhoto
 
-	respPhotoList, err := photosets.GetPhotos(client, true, photosetID, "", page)
+	respPhotoList, err := getPhotosetPhotos(client, photosetID, page)
 
-	for (len(respPhotoList.Photoset.Photos) == 0) && nbAttempts < config.RetrieveAttempts {
-		log.WithFields(logrus.Fields{
-			"error":      err.Error(),
+	for (len(respPhotoList.Photoset.Photos) == 0) && !isAuthError(respPhotoList) && nbAttempts < config.RetrieveAttempts {
+		wait := retryDelay(err, config.RetrieveInterval*time.Second)
+		logger.WithFields(logrus.Fields{
+			"error":      err,
 			"photosetID": photosetID,
 			"page":       page,
 			"size":       len(respPhotoList.Photoset.Photos),
 			"attempt":    nbAttempts,
-			"interval":   config.RetrieveInterval * time.Second,
+			"interval":   wait,
 		}).Debug("No new photo retrieved")
 
-		time.Sleep(config.RetrieveInterval * time.Second)
+		sleep(wait)
 		nbAttempts++
 
-		respPhotoList, err = photosets.GetPhotos(client, true, photosetID, "", page)
+		respPhotoList, err = getPhotosetPhotos(client, photosetID, page)
 	}
 
 	for _, ph := range respPhotoList.Photoset.Photos {
-		result = append(result, FlickrPhoto{ph.Id, ph.Title})
+		result = append(result, FlickrPhoto{ph.Id, ph.Title, parseMachineTags(ph.MachineTags)})
 	}
 
-	return result, err
+	if isAuthError(respPhotoList) {
+		err = ErrAuthorization
+	}
+	return result, respPhotoList.Photoset.Total, err
+}
+
+// retrieveAlbum returns the photos of an album. Flickr may transiently return
+// partial pages: the whole album is fetched again, according to RetrieveAttempts
+// and RetrieveInterval, until the photos collected match the reported total
+func retrieveAlbum(client *flickr.FlickrClient, config *Config, logger logrus.FieldLogger, title string, photosetID string) ([]FlickrPhoto, error) {
+	var best []FlickrPhoto
+	for attempt := 0; ; attempt++ {
+		var photolist []FlickrPhoto
+		currentPage := 1
+		currentPageContent, total, err := retrievePage(client, config, logger, photosetID, currentPage)
+
+		for len(currentPageContent) > 0 {
+			for _, ph := range currentPageContent {
+				photolist = append(photolist, ph)
+			}
+
+			logger.WithFields(logrus.Fields{
+				"album": title,
+				"total": len(photolist),
+				"page":  currentPage,
+			}).Debug("Photoset expanded")
+
+			currentPage++
+			currentPageContent, _, err = retrievePage(client, config, logger, photosetID, currentPage)
+		}
+		if err == ErrAuthorization {
+			return photolist, err
+		}
+		if len(photolist) >= total {
+			return photolist, nil
+		}
+		if len(photolist) > len(best) {
+			best = photolist
+		}
+
+		if attempt >= config.RetrieveAttempts {
+			logger.WithFields(logrus.Fields{
+				"album":     title,
+				"retrieved": len(best),
+				"reported":  total,
+			}).Warn("[WARNING] Album retrieved partially")
+			return best, nil
+		}
+		wait := retryDelay(err, config.RetrieveInterval*time.Second)
+		logger.WithFields(logrus.Fields{
+			"album":     title,
+			"retrieved": len(photolist),
+			"reported":  total,
+			"attempt":   attempt,
+			"interval":  wait,
+		}).Warn("[WARNING] Partial album retrieved. Waiting before retry")
+		sleep(wait)
+	}
+}
+
+// retrieveAlbumList returns the albums of the user. A failed request is retried
+// according to RetrieveAttempts and RetrieveInterval, unless the token was
+// rejected: ErrAuthorization is then returned
+func retrieveAlbumList(client *flickr.FlickrClient, config *Config, logger logrus.FieldLogger) (*photosets.PhotosetsListResponse, error) {
+	respSetList, err := photosets.GetList(client, true, "", 0)
+	for nbAttempts := 0; err != nil && !isAuthError(respSetList) && nbAttempts < config.RetrieveAttempts; nbAttempts++ {
+		wait := retryDelay(err, config.RetrieveInterval*time.Second)
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"attempt":  nbAttempts,
+			"interval": wait,
+		}).Warn("[WARNING] Could not retrieve album list. Waiting before retry")
+
+		sleep(wait)
+		respSetList, err = photosets.GetList(client, true, "", 0)
+	}
+	if err != nil && isAuthError(respSetList) {
+		err = ErrAuthorization
+	}
+	return respSetList, err
 }
 
 // RetrieveFromFlickr returns a map associating the title of an album to
-// a FlickrPhotoset{id string, photos []string}
-func RetrieveFromFlickr(client *flickr.FlickrClient, config *Config) map[string]FlickrPhotoset {
+// the FlickrPhotosets{id string, photos []string} having that title, as flickr
+// allows several albums with the same title
+// When ResumeFile is set, albums are recorded there as soon as they are loaded, and
+// albums recorded by an interrupted retrieval are not fetched again.
+// It returns an ErrRetrieve error when the album list can't be retrieved after
+// RetrieveAttempts, or ErrAuthorization.
+func RetrieveFromFlickr(client *flickr.FlickrClient, config *Config) (map[string][]FlickrPhotoset, error) {
+	return retrieveFromFlickr(client, config, log)
+}
+
+// retrieveFromFlickr is RetrieveFromFlickr logging to logger
+func retrieveFromFlickr(client *flickr.FlickrClient, config *Config, logger logrus.FieldLogger) (map[string][]FlickrPhotoset, error) {
 	var err error
 
-	result := make(map[string]FlickrPhotoset)
+	result := make(map[string][]FlickrPhotoset)
+
+	var state retrievalState
+	if config.ResumeFile != "" {
+		state, err = loadRetrievalState(config.ResumeFile)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"resume_file": config.ResumeFile,
+				"error":       err,
+			}).Warn("[WARNING] Could not read resume file, retrieving all albums")
+			state = retrievalState{}
+		}
+	}
+	resumed := state.loaded()
+	var resume *resumeWriter
+	if config.ResumeFile != "" {
+		resume, err = openResumeFile(config.ResumeFile, state, config.CompressState)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"resume_file": config.ResumeFile,
+				"error":       err,
+			}).Warn("[WARNING] Could not write resume file, the retrieval won't be resumable")
+		}
+	}
 
 	// Retrieve all photos and albums from flickr
-	log.Info("Retrieving photosets from flickr...")
-	respSetList, err := photosets.GetList(client, true, "", 0)
+	logger.Info("Retrieving photosets from flickr...")
+	respSetList, err := retrieveAlbumList(client, config, logger)
+	if err == ErrAuthorization {
+		logger.Error(authFailedMessage)
+		return result, err
+	}
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"error": respSetList.ErrorMsg(),
-		}).Fatal("Could not retrieve album list.")
-
-	} else {
-		for _, ps := range respSetList.Photosets.Items {
-			photoset := FlickrPhotoset{ID: ps.Id}
-			var photolist []FlickrPhoto
-
-			currentPage := 1
-			currentPageContent, _ := RetrievePageFromFlickr(client, config, ps.Id, currentPage)
-
-			for len(currentPageContent) > 0 {
-				for _, ph := range currentPageContent {
-					photolist = append(photolist, FlickrPhoto{ph.ID, ph.Title})
-				}
+		}).Error("Could not retrieve album list.")
+		return result, kindError(ErrRetrieve, "retrieve album list", err)
+	}
+	for _, ps := range respSetList.Photosets.Items {
+		if album, ok := resumed[ps.Id]; ok {
+			// The order may have changed since the interrupted retrieval
+			indexPhotos(config, album.Photoset.Photos)
+			result[ps.Title] = append(result[ps.Title], album.Photoset)
+			logger.WithFields(logrus.Fields{
+				"album": ps.Title,
+				"total": len(album.Photoset.Photos),
+			}).Info("[OK] Photoset resumed")
+			continue
+		}
 
-				log.WithFields(logrus.Fields{
-					"total": len(photolist),
-					"page":  currentPage,
-				}).Debug("Photoset expanded")
+		photolist, err := retrieveAlbum(client, config, logger, ps.Title, ps.Id)
+		// An incomplete album would have its photos uploaded again
+		if err == ErrAuthorization {
+			logger.WithField("album", ps.Title).Error(authFailedMessage)
+			return result, err
+		}
 
-				currentPage++
-				currentPageContent, err = RetrievePageFromFlickr(client, config, ps.Id, currentPage)
+		indexPhotos(config, photolist)
+		photoset := FlickrPhotoset{ID: ps.Id, Photos: photolist}
+		result[ps.Title] = append(result[ps.Title], photoset)
+		logger.WithFields(logrus.Fields{
+			"album": ps.Title,
+			"total": len(photoset.Photos),
+		}).Info("[OK] Photoset loaded")
+
+		if resume != nil {
+			if err := resume.Append(resumedAlbum{ps.Title, photoset}); err != nil {
+				logger.WithFields(logrus.Fields{
+					"resume_file": config.ResumeFile,
+					"error":       err,
+				}).Warn("[WARNING] Could not update resume file")
 			}
-
-			sort.Sort(FlickrPhotosByTitle(photolist))
-			photoset = FlickrPhotoset{ID: ps.Id, Photos: photolist}
-			result[ps.Title] = photoset
-			log.WithFields(logrus.Fields{
-				"title": ps.Title,
-				"total": len(photoset.Photos),
-			}).Info("[OK] Photoset loaded")
 		}
-		log.WithFields(logrus.Fields{
-			"nb_albums": len(result),
-		}).Info("[OK] Albums have been loaded")
+	}
+	logger.WithFields(logrus.Fields{
+		"nb_albums": len(result),
+	}).Info("[OK] Albums have been loaded")
+
+	// The retrieval completed, the next one starts from scratch
+	if config.ResumeFile != "" {
+		os.Remove(config.ResumeFile)
 	}
 
-	return result
+	return result, nil
 }
 
-// DeleteDupes deletes duplicate files from an album
-func DeleteDupes(client *flickr.FlickrClient, fromFlickr *map[string]FlickrPhotoset) {
+// DeleteDupes deletes duplicate files from an album, running up to concurrency
+// deletions at once. It returns the deletion errors by photo ID
+func DeleteDupes(client *flickr.FlickrClient, logger logrus.FieldLogger, fromFlickr *map[string][]FlickrPhotoset, concurrency int) map[string]error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-	for albumName, flickrAlbum := range *fromFlickr {
-		for phi, ph := range flickrAlbum.Photos {
-			if phi > 0 && ph.Title == flickrAlbum.Photos[phi-1].Title {
-				log.WithFields(logrus.Fields{
-					"album.name": albumName,
-					"photo.name": ph.Title,
+	type dupe struct {
+		album string
+		photo FlickrPhoto
+	}
+	dupes := make(chan dupe)
+	go func() {
+		forEachDupe(*fromFlickr, func(album string, photo FlickrPhoto) {
+			dupes <- dupe{album, photo}
+		})
+		close(dupes)
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(map[string]error)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The flickr client holds the arguments of the request being built,
+			// each worker needs its own
+			workerClient := *client
+			for d := range dupes {
+				logger.WithFields(logrus.Fields{
+					"album":      d.album,
+					"photo.name": d.photo.Title,
 				}).Warn("[DELETE] Deleting duplicate.")
-				photos.Delete(client, ph.ID)
+				if _, err := photos.Delete(&workerClient, d.photo.ID); err != nil {
+					logger.WithFields(logrus.Fields{
+						"album":      d.album,
+						"photo.name": d.photo.Title,
+						"photo.id":   d.photo.ID,
+						"error":      err,
+					}).Error("[ERROR] Could not delete duplicate")
+					mu.Lock()
+					errs[d.photo.ID] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// forEachDupe calls fn for every photo titled like the previous one of its album,
+// albums sorted by title
+func forEachDupe(fromFlickr map[string][]FlickrPhotoset, fn func(album string, photo FlickrPhoto)) {
+	var titles []string
+	for title := range fromFlickr {
+		titles = append(titles, title)
+	}
+	sort.Strings(titles)
+
+	for _, albumName := range titles {
+		for _, flickrAlbum := range fromFlickr[albumName] {
+			for phi, ph := range flickrAlbum.Photos {
+				if phi > 0 && ph.Title == flickrAlbum.Photos[phi-1].Title {
+					fn(albumName, ph)
+				}
 			}
 		}
 	}
 }
 
 // CreateAlbum will create an album and set the photo as the primary photo
-func CreateAlbum(client *flickr.FlickrClient, albumName string, photoID string) (string, error) {
+func CreateAlbum(client *flickr.FlickrClient, logger *logrus.Entry, albumName string, description string, photoID string) (string, error) {
 	result := ""
-	respS, err := photosets.Create(client, albumName, "", photoID)
+	respS, err := photosets.Create(client, albumName, description, photoID)
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"code":    respS.ErrorCode(),
 			"message": respS.ErrorMsg(),
 		}).Error("Failed creating set.")
+		if isAuthError(respS) {
+			err = ErrAuthorization
+		}
 	} else {
-		log.WithFields(logrus.Fields{
-			"album.name": albumName,
-			"album.id":   respS.Set.Id,
-		}).Info("[OK] Set created")
+		logger.WithField("album.id", respS.Set.Id).Info("[OK] Set created")
 		result = respS.Set.Id
 	}
 	return result, err
 }
 
-// AppendPhotoIntoExistingAlbum will add a photo into an existing album
-func AppendPhotoIntoExistingAlbum(client *flickr.FlickrClient, albumID string, photoID string) (string, error) {
+// Error codes of flickr.photosets.addPhoto
+const (
+	photosetNotFoundErrorCode  = 1
+	photoNotFoundErrorCode     = 2
+	photoAlreadyInSetErrorCode = 3
+	photosetFullErrorCode      = 10
+)
+
+// classifyAddError returns the level at which a flickr.photosets.addPhoto error
+// is logged, and whether it is benign: the photo already being in the album
+// leaves it as wanted
+func classifyAddError(code int) (logrus.Level, bool) {
+	switch code {
+	case photoAlreadyInSetErrorCode:
+		return logrus.InfoLevel, true
+	case photosetFullErrorCode:
+		return logrus.WarnLevel, false
+	}
+	// e.g. photosetNotFoundErrorCode or photoNotFoundErrorCode when the album or
+	// the photo was deleted meanwhile
+	return logrus.ErrorLevel, false
+}
+
+// AppendPhotoIntoExistingAlbum will add a photo into an existing album.
+// A photo already in the album is not an error
+func AppendPhotoIntoExistingAlbum(client *flickr.FlickrClient, logger *logrus.Entry, albumID string, photoID string) (string, error) {
 	respAdd, err := photosets.AddPhoto(client, albumID, photoID)
 	if err != nil {
-		log.WithFields(logrus.Fields{
-			"code":    respAdd.ErrorCode(),
-			"message": respAdd.ErrorMsg(),
-		}).Error("Failed adding photo to the set.")
+		level, benign := classifyAddError(respAdd.ErrorCode())
+		entry := logger.WithFields(logrus.Fields{
+			"code":     respAdd.ErrorCode(),
+			"message":  respAdd.ErrorMsg(),
+			"photo.id": photoID,
+			"set.id":   albumID,
+		})
+		switch level {
+		case logrus.InfoLevel:
+			skipLog(entry, skipReasonInAlbum).Info("[SKIP] Photo already in the set.")
+		case logrus.WarnLevel:
+			entry.Warn("[WARNING] Failed adding photo to the set.")
+		default:
+			entry.Error("Failed adding photo to the set.")
+		}
+		if benign {
+			err = nil
+		}
+		if isAuthError(respAdd) {
+			err = ErrAuthorization
+		}
 	} else {
-		log.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"photo.id": photoID,
 			"set.id":   albumID,
 		}).Info("[OK] Added photo to existing set.")
@@ -286,44 +810,128 @@ func AppendPhotoIntoExistingAlbum(client *flickr.FlickrClient, albumID string, p
 	return albumID, err
 }
 
-// UploadPhoto uploads a given path into a given album. It creates a new album if none is provided
-func UploadPhoto(client *flickr.FlickrClient, albumID string, path string) (string, string, error) {
-	photoID := ""
-	currentDir := filepath.Base(filepath.Dir(path))
+// UploadResult describes a photo upload
+type UploadResult struct {
+	// PhotoID is the ID of the uploaded photo, empty when the upload failed
+	PhotoID string
+	// AlbumID is the ID of the album holding the photo
+	AlbumID string
+	// AlbumCreated tells whether the album was created for this photo
+	AlbumCreated bool
+	// BytesSent is the size of the photo sent to flickr
+	BytesSent int64
+	// BytesUploaded is the size of the uploaded file, zero when the upload failed
+	BytesUploaded int64
+	// Duration is the time spent transferring the photo
+	Duration time.Duration
+}
 
-	resp, err := flickr.UploadFile(client, path, nil)
+// UploadPhoto uploads a given path into a given album. It creates a new album named albumName
+// and described by albumDescription if no albumID is provided. params may be nil to use the user's default preferences.
+// The album is only created once the photo was uploaded, as its primary photo, so a
+// failed upload never leaves an empty album behind.
+// Uploads flickr processes asynchronously are awaited according to RetrieveAttempts
+// and RetrieveInterval. Every line is logged through the album logger
+func UploadPhoto(client *flickr.FlickrClient, config *Config, logger *logrus.Entry, albumID string, albumName string, albumDescription string, path string, params *flickr.UploadParams) (UploadResult, error) {
+	result := UploadResult{AlbumID: albumID}
+
+	start := time.Now()
+	resp, sent, err := uploadFile(client, config, path, params)
+	result.Duration = time.Since(start)
+	result.BytesSent = sent
+	if err == nil && resp.ID == "" {
+		if ticket := uploadTicket(resp); ticket != "" {
+			logger.WithFields(logrus.Fields{
+				"path":   path,
+				"ticket": ticket,
+			}).Debug("Waiting for flickr to process the upload")
+			resp.ID, err = waitForTicket(client, config, ticket)
+			result.Duration = time.Since(start)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"path":   path,
+					"ticket": ticket,
+					"error":  err,
+				}).Error("Photo upload failed.")
+				return result, kindError(ErrUpload, "upload "+path, err)
+			}
+		}
+	}
 	if err != nil {
-		log.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"path":     path,
 			"album.id": albumID,
 			"error":    err,
 		}).Error("Photo upload failed.")
 		if resp != nil {
-			log.WithFields(logrus.Fields{
+			logger.WithFields(logrus.Fields{
 				"code":    resp.ErrorCode(),
 				"message": resp.ErrorMsg(),
 			}).Error("Response contents")
+			if resp.ErrorCode() == uploadLimitErrorCode {
+				err = ErrUploadQuota
+			}
+			if isAuthError(resp) {
+				err = ErrAuthorization
+			}
 		} else {
-			log.Error("Empty response")
+			logger.Error("Empty response")
 		}
 	} else {
-		log.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"path":     path,
 			"album.id": albumID,
 			"photo.id": resp.ID,
 		}).Info("[OK] Photo uploaded")
-		photoID = resp.ID
+		result.PhotoID = resp.ID
+		if info, err := statLibraryFile(config, path); err == nil {
+			result.BytesUploaded = info.Size()
+		}
 
 		// AlbumID is not provided, we create a new album
 		if albumID == "" {
-			albumID, err = CreateAlbum(client, currentDir, resp.ID)
+			result.AlbumID, err = CreateAlbum(client, logger, albumName, albumDescription, resp.ID)
+			result.AlbumCreated = err == nil
 		} else {
 			// AlbumID is provided, we append the photo to the albumID
-			albumID, err = AppendPhotoIntoExistingAlbum(client, albumID, resp.ID)
+			result.AlbumID, err = AppendPhotoIntoExistingAlbum(client, logger, albumID, resp.ID)
 		}
 	}
 
-	return albumID, photoID, err
+	return result, kindError(ErrUpload, "upload "+path, err)
+}
+
+// uploadFile uploads a file using the transport of the flickr client when one
+// has been provided, so that uploads share the settings of the other requests.
+// It returns the number of bytes of the file which were sent
+func uploadFile(client *flickr.FlickrClient, config *Config, path string, params *flickr.UploadParams) (*flickr.UploadResponse, int64, error) {
+	file, err := openLibraryFile(config, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	// A nil http client makes the flickr library use its own HTTP/1.1 client
+	var httpClient *http.Client
+	if client.HTTPClient != nil && client.HTTPClient.Transport != nil {
+		httpClient = client.HTTPClient
+	}
+
+	counter := &countingReader{r: file}
+	resp, err := flickr.UploadReaderWithClient(client, counter, path, params, httpClient)
+	return resp, counter.n, err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // SetLogLevel will update the log level according to the json
@@ -343,136 +951,267 @@ func SetLogLevel(config *Config, log *logrus.Logger) {
 //   --> it will be skipped
 // If a file doesn't exist yet
 //   --> it will be uploaded into an album which title will be the parent directory name
-func Process(config *Config, client *flickr.FlickrClient, parentlog *logrus.Logger) (map[string]FlickrPhotoset, error) {
+//
+// When SMTP is set, a summary of the run is mailed once it completes.
+// When SummaryEvery is set, the running counts are logged at that interval.
+// When BatchTag is set, the uploads of the run are tagged with a new batch identifier.
+// Files whose upload failed are listed in FailuresFile, and RetryFailures only
+// processes those files instead of walking the library.
+// When StateFile is set, uploads are recorded into an index stored with StateBackend,
+// and files recorded there are recognized whatever their title.
+func Process(config *Config, client *flickr.FlickrClient, parentlog *logrus.Logger) (map[string][]FlickrPhotoset, error) {
+	return ProcessWithOptions(config, client, parentlog, ProcessOptions{})
+}
+
+// ProcessWithOptions is Process tuned by options
+func ProcessWithOptions(config *Config, client *flickr.FlickrClient, parentlog *logrus.Logger, options ProcessOptions) (map[string][]FlickrPhotoset, error) {
+	logger := log
+	if parentlog != nil {
+		logger = parentlog
+	}
+
+	config.fsys = options.FS
+	if config.BatchTag {
+		config.batchID = newBatchID()
+		logger.WithField("batch", config.batchID).Info("[OK] Tagging uploads with batch")
+	}
+
+	summary := startRunSummary(config)
+	stopReports := reportSummaries(config, logger, summary, options.Ticker)
+	fromFlickr, err := process(config, client, logger, options)
+	stopReports()
+	summary = summary.finish(err)
+	logger.WithFields(logrus.Fields{
+		"uploaded":       summary.uploaded,
+		"bytes_uploaded": summary.bytesUploaded,
+		"skipped":        summary.skipped,
+		"skip_reasons":   summary.skipReasons,
+	}).Infof("[OK] Run finished, %s uploaded", formatBytes(summary.bytesUploaded))
+	if config.SMTP != nil {
+		notify(config.SMTP, logger, summary)
+	}
+	return fromFlickr, err
+}
+
+func process(config *Config, client *flickr.FlickrClient, logger *logrus.Logger, options ProcessOptions) (map[string][]FlickrPhotoset, error) {
 	var err error
 
 	if config.PhotoLibraryPath == "" {
-		log.WithFields(logrus.Fields{
+		logger.WithFields(logrus.Fields{
 			"photo_library_path": config.PhotoLibraryPath,
-		}).Fatal("Please update synckr.conf.json")
+		}).Error("Please update synckr.conf.json")
+		return nil, kindError(ErrConfig, "process", errors.New("photo_library_path is not set"))
 	}
 
-	if parentlog != nil {
-		log = parentlog
-	}
+	SetLogLevel(config, logger)
 
-	SetLogLevel(config, log)
+	retrieveStart := time.Now()
+	fromFlickr, err := retrieveFromFlickr(client, config, logger)
+	retrieveDuration.Observe(time.Since(retrieveStart))
+	if err != nil {
+		return fromFlickr, err
+	}
 
-	fromFlickr := RetrieveFromFlickr(client, config)
+	// A dry run writes the plan of the changes instead of applying them
+	var plan *PlanWriter
+	if config.DryRun {
+		out, closePlan, err := openPlan(config)
+		if err != nil {
+			return fromFlickr, err
+		}
+		defer closePlan()
+		plan = NewPlanWriter(out)
+	}
 
 	if config.DeleteDupes {
-		DeleteDupes(client, &fromFlickr)
+		if plan != nil {
+			forEachDupe(fromFlickr, func(album string, photo FlickrPhoto) {
+				plan.Delete(album, photo.Title)
+			})
+		} else {
+			DeleteDupes(client, logger, &fromFlickr, config.DeleteConcurrency)
+		}
 	}
 
 	// Walk photolibrarypath using a lambda as walk function
-	_, err = os.Stat(config.PhotoLibraryPath)
+	_, err = statLibraryFile(config, config.PhotoLibraryPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			log.WithField("path", config.PhotoLibraryPath).Fatal("Path does not exist")
+			logger.WithField("path", config.PhotoLibraryPath).Error("Path does not exist")
 		} else {
-			log.WithField("path", config.PhotoLibraryPath).Fatal("Cannot access path. ", err.Error())
+			logger.WithField("path", config.PhotoLibraryPath).Error("Cannot access path. ", err.Error())
 		}
+		return fromFlickr, kindError(ErrConfig, "process", err)
 	}
 
-	skipDirs := config.SkipDirs
-	allowedExtensions := config.Extensions
+	run := newSyncRun(config, client, fromFlickr, logger)
+	if options.Rand != nil {
+		run.backoff = newBackoff(config, options.Rand)
+	}
+	run.plan = plan
 
-	filepath.Walk(config.PhotoLibraryPath, func(path string, info os.FileInfo, err error) error {
+	finish, err := run.prepare()
+	if err != nil {
+		return fromFlickr, err
+	}
+	defer finish()
+
+	var included []string
+	if config.IncludeFile != "" {
+		if included, err = loadIncludeFile(config, config.IncludeFile); err != nil {
+			logger.WithFields(logrus.Fields{
+				"include_file": config.IncludeFile,
+				"error":        err,
+			}).Error("Could not read include file")
+			return fromFlickr, kindError(ErrConfig, "process", err)
+		}
+	}
 
-		if info.IsDir() {
-			dir := filepath.Base(path)
-			for _, d := range skipDirs {
-				if d == dir {
-					return filepath.SkipDir
-				}
-			}
+	// Photos uploaded by a previous run but missing from their album are
+	// added to it rather than uploaded again
+	if config.ReconcileOrphans {
+		orphans, err := RetrieveNotInSet(client)
+		if err != nil {
+			logger.WithField("error", err).Warn("[WARNING] Could not retrieve photos not in an album")
 		}
+		normalizeTitles(config, orphans)
+		run.orphans = orphansByTitle(orphans)
+	}
 
-		// Only treat files
-		if !info.IsDir() {
-			isAllowedExt := false
-			isRootDir := false
+	var walkErr error
+	if config.RetryFailures {
+		walkErr = run.retryFailures()
+	} else if config.IncludeFile != "" {
+		walkErr = run.uploadIncluded(included)
+	} else {
+		if config.ProgressInterval > 0 {
+			run.startProgress()
+		}
+		walkErr = run.walk()
+	}
 
-			if filepath.Dir(path) == config.PhotoLibraryPath {
-				log.WithField("path", path).Info("[SKIP] Root folder not processed.")
-				isRootDir = true
-			}
+	// Photos whose album could not be created are not left unreported
+	if walkErr != ErrAuthorization {
+		if err := run.flushHeld(); err != nil {
+			walkErr = err
+		}
+	}
 
-			for _, i := range allowedExtensions {
-				if strings.ToLower(filepath.Ext(path)) == i {
-					isAllowedExt = true
-				}
-			}
+	if config.CreateEmptyAlbums && walkErr == nil {
+		walkErr = run.createEmptyAlbums()
+	}
 
-			if !isRootDir && !isAllowedExt {
-				log.WithField("path", path).Warn("[SKIP] File not supported.")
-			}
+	// Albums are only pruned once every local file was seen
+	if walkErr == nil && !config.RetryFailures && config.IncludeFile == "" {
+		walkErr = run.pruneMirroredAlbums()
+	}
 
-			// Files on the base root path will not be uploaded
-			if isAllowedExt && !isRootDir {
-				photoName := strings.Split(filepath.Base(path), ".")[0]
-				currentDir := filepath.Base(filepath.Dir(path))
-
-				uploadNeeded := false
-				destinationAlbum := ""
-
-				// Check if file need to be uploaded.
-				_, albumPresent := fromFlickr[currentDir]
-
-				// The album is present in flickr. has the photo already been uploaded?
-				if albumPresent {
-					phi := sort.Search(len(fromFlickr[currentDir].Photos), func(i int) bool {
-						return fromFlickr[currentDir].Photos[i].Title >= photoName
-					})
-					if phi == len(fromFlickr[currentDir].Photos) {
-						uploadNeeded = true
-						destinationAlbum = fromFlickr[currentDir].ID
-					} else {
-						log.WithFields(logrus.Fields{
-							"photo.name": photoName,
-							"album.name": currentDir,
-						}).Debug("[SKIP] Already uploded")
-					}
-				} else {
-					// The album is not present in flickr. The photo needs to be uploaded
-					uploadNeeded = true
-					destinationAlbum = ""
-				}
+	if walkErr == ErrAuthorization {
+		logger.Error(authFailedMessage)
+		return fromFlickr, walkErr
+	}
 
-				if uploadNeeded {
-					attemptNb := 0
-					albumID, photoID, err := UploadPhoto(client, destinationAlbum, path)
-
-					for err != nil && attemptNb < config.UploadAttempts {
-						log.WithFields(logrus.Fields{
-							"attempt":  attemptNb,
-							"interval": config.UploadInterval * time.Second,
-						}).Warn("[WARNING] Upload attempt failed. Waiting before retry")
-
-						time.Sleep(config.UploadInterval * time.Second)
-
-						attemptNb++
-						albumID, photoID, err = UploadPhoto(client, destinationAlbum, path)
-					}
-
-					if err != nil {
-						log.WithFields(logrus.Fields{
-							"attempt":    attemptNb,
-							"photo.name": photoName,
-							"album.name": currentDir,
-						}).Error("[ERROR] Upload failed")
-					} else {
-						photolist := fromFlickr[currentDir].Photos
-						photolist = append(photolist, FlickrPhoto{photoID, photoName})
-						fromFlickr[currentDir] = FlickrPhotoset{albumID, photolist}
-					}
-				}
+	if config.EnforcePhotoOrder {
+		run.reorderAlbums()
+	}
 
-			}
+	if config.PreserveAlbumOrder {
+		run.orderAlbums()
+	}
 
+	if config.UseCollections {
+		run.groupCollections()
+	}
+
+	if walkErr == ErrUploadQuota {
+		logger.Error("[ABORT] upload quota reached")
+		return fromFlickr, walkErr
+	}
+	if walkErr == errUploadCap {
+		logger.WithField("max_uploads_per_run", config.MaxUploadsPerRun).Info("[STOP] per-run upload cap reached")
+		return fromFlickr, nil
+	}
+	if walkErr == errFileLimit {
+		logger.WithField("file_limit", config.FileLimit).Info("[STOP] file limit reached")
+		return fromFlickr, nil
+	}
+
+	return fromFlickr, walkErr
+}
+
+// isSkippedDir tells whether a directory is listed in SkipDirs
+func isSkippedDir(config *Config, path string) bool {
+	if isArchiveDir(config, path) {
+		return true
+	}
+	dir := filepath.Base(path)
+	for _, d := range config.SkipDirs {
+		if d == dir {
+			return true
 		}
-		return err
-	})
+	}
+	return false
+}
 
-	return fromFlickr, err
+// isExcludedPath tells whether a file or directory matches one of ExcludeGlobs.
+// A glob is matched against the slash separated path relative to
+// PhotoLibraryPath, and against the base name
+func isExcludedPath(config *Config, file string) bool {
+	rel := relPath(config, file)
+	for _, glob := range config.ExcludeGlobs {
+		if ok, _ := path.Match(glob, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(glob, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExcludeGlobs rejects the ExcludeGlobs which aren't valid patterns
+func checkExcludeGlobs(config *Config) error {
+	for _, glob := range config.ExcludeGlobs {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("exclude_globs: %v: %q", err, glob)
+		}
+	}
+	return nil
+}
+
+// noMediaFile marks, Android-style, a directory whose subtree holds no media to sync
+const noMediaFile = ".nomedia"
+
+// hasNoMedia tells whether a directory holds a .nomedia file and must be skipped
+// because of HonorNoMedia
+func hasNoMedia(config *Config, dir string) bool {
+	if !config.HonorNoMedia {
+		return false
+	}
+	_, err := statLibraryFile(config, filepath.Join(dir, noMediaFile))
+	return err == nil
+}
+
+// isHidden tells whether a file or directory below the library is dot-prefixed
+// and must be skipped because of SkipHidden
+func isHidden(config *Config, path string) bool {
+	return config.SkipHidden && path != config.PhotoLibraryPath && strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// exceedsMaxDepth tells whether a directory is nested deeper than MaxDepth below
+// the library, its direct subdirectories being at depth 1
+func exceedsMaxDepth(config *Config, path string) bool {
+	if config.MaxDepth <= 0 {
+		return false
+	}
+	rel, err := filepath.Rel(config.PhotoLibraryPath, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	return len(strings.Split(rel, string(filepath.Separator))) > config.MaxDepth
+}
+
+// hasAllowedExtension tells whether the extension of a file is listed in Extensions
+func hasAllowedExtension(config *Config, path string) bool {
+	return matchesExtension(path, config.Extensions)
 }
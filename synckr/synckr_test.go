@@ -1,7 +1,13 @@
 package synckr_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
 	synckr "github.com/koukihai/synckr/synckr"
 	"github.com/sirupsen/logrus"
@@ -19,6 +25,30 @@ func TestLoadConfiguration(t *testing.T) {
 	}
 }
 
+func TestLoadSecretsFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "synckr.conf.json")
+	secretsFile := filepath.Join(dir, "synckr.secrets.json")
+	ioutil.WriteFile(filename, []byte(`{"api_key": "config key", "api_secret": "config secret", "oauth_token": "config token", "secrets_file": "`+secretsFile+`"}`), 0644)
+	ioutil.WriteFile(secretsFile, []byte(`{"api_key": "key", "oauth_token": "token", "oauth_token_secret": "token secret", "photo_library_path": "/ignored"}`), 0600)
+
+	config, err := synckr.LoadConfiguration(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"key", "config secret", "token", "token secret", ""}
+	got := []string{config.APIKey, config.APISecret, config.OAuthToken, config.OAuthTokenSecret, config.PhotoLibraryPath}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("The secrets file should win over the configuration, expected %q, got %q", expected, got)
+	}
+
+	os.Remove(secretsFile)
+	if _, err := synckr.LoadConfiguration(filename); !errors.Is(err, synckr.ErrConfig) {
+		t.Errorf("A missing secrets file should be a configuration error, got %v", err)
+	}
+}
+
 func TestRetrieveFromFlickr(t *testing.T) {
 	config, err := synckr.LoadConfiguration("../synckr/test/synckr_test.conf.json")
 	if err != nil {
@@ -30,12 +60,39 @@ func TestRetrieveFromFlickr(t *testing.T) {
 		t.Error("Unable to instanciate flickrClient")
 	}
 
-	fromFlickr := synckr.RetrieveFromFlickr(&client, &config)
-	if len(fromFlickr["Mugen"].Photos) != 4 {
+	fromFlickr, err := synckr.RetrieveFromFlickr(&client, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fromFlickr["Mugen"][0].Photos) != 4 {
 		t.Error("Test album contains should contain exactly 4 photos")
 	}
 }
 
+func TestGetClientNonInteractive(t *testing.T) {
+	config := synckr.Config{APIKey: "key", APISecret: "secret", NonInteractive: true}
+
+	done := make(chan error)
+	go func() {
+		_, err := synckr.GetClient(&config)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != synckr.ErrOAuthTokenRequired {
+			t.Errorf("Expected ErrOAuthTokenRequired, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetClient should not wait for an authorization when non interactive")
+	}
+
+	config.OAuthToken, config.OAuthTokenSecret = "token", "token secret"
+	client, err := synckr.GetClient(&config)
+	if err != nil || client.OAuthToken != "token" {
+		t.Errorf("An existing token should be used without asking, got %v", err)
+	}
+}
+
 func TestSetLogLevel(t *testing.T) {
 	var config synckr.Config
 	log := logrus.New()
@@ -0,0 +1,100 @@
+package synckr
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tagsSidecarExt is the extension of the sidecar listing the additional albums
+// of a photo, e.g. IMG_1.jpg.tags. Each line is an album title, or hashtags
+// such as "#pets #2023" naming one album each
+const tagsSidecarExt = ".tags"
+
+// parseTagAlbums returns the album titles listed by a .tags sidecar, in order
+// and without duplicates
+func parseTagAlbums(content string) []string {
+	var titles []string
+	seen := make(map[string]bool)
+	add := func(title string) {
+		if title = strings.TrimSpace(title); title != "" && !seen[title] {
+			seen[title] = true
+			titles = append(titles, title)
+		}
+	}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "#") {
+			add(line)
+			continue
+		}
+		for _, tag := range strings.Fields(line) {
+			add(strings.TrimLeft(tag, "#"))
+		}
+	}
+	return titles
+}
+
+// tagAlbums returns the albums listed by the .tags sidecar of a file, other
+// than home, the album the file belongs to
+func tagAlbums(config *Config, path string, home string) []string {
+	raw, err := readLibraryFile(config, path+tagsSidecarExt)
+	if err != nil {
+		return nil
+	}
+	var titles []string
+	for _, title := range parseTagAlbums(string(raw)) {
+		if title != home {
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
+
+// findInAlbums returns the photo titled title found in any album titled after titles
+func (r *syncRun) findInAlbums(titles []string, title string) (FlickrPhoto, bool) {
+	for _, albumTitle := range titles {
+		for _, album := range r.fromFlickr[albumTitle] {
+			if phi := album.photoIndex(title, titleLess(r.config)); phi >= 0 {
+				return album.Photos[phi], true
+			}
+		}
+	}
+	return FlickrPhoto{}, false
+}
+
+// addToAlbums adds a photo to the albums titled after titles which don't hold
+// it yet, creating them as needed. It stops at ErrAuthorization
+func (r *syncRun) addToAlbums(titles []string, photo FlickrPhoto) error {
+	for _, title := range titles {
+		albums := r.fromFlickr[title]
+		if findPhoto(albums, photo.Title, titleLess(r.config)) >= 0 {
+			continue
+		}
+		if r.plan != nil {
+			r.plan.Update("add %s → %s", photo.Title, title)
+			continue
+		}
+
+		logger := r.albumLog(title)
+		var albumID string
+		var err error
+		if len(albums) > 0 {
+			albumID, err = AppendPhotoIntoExistingAlbum(r.client, logger, albums[0].ID, photo.ID)
+		} else {
+			albumID, err = CreateAlbum(r.client, logger, title, "", photo.ID)
+		}
+		if err == ErrAuthorization {
+			return err
+		}
+		if err != nil {
+			continue
+		}
+		r.addPhoto(title, albumID, photo)
+		logger.WithFields(logrus.Fields{
+			"photo.name": photo.Title,
+			"photo.id":   photo.ID,
+		}).Info("[OK] Photo added to album")
+	}
+	return nil
+}
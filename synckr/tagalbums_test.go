@@ -0,0 +1,77 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTagAlbums(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected []string
+	}{
+		{"#pets #2023\n", []string{"pets", "2023"}},
+		{"Summer holidays\n\n  Family \n", []string{"Summer holidays", "Family"}},
+		{"#pets\npets\n#2023 #pets", []string{"pets", "2023"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseTagAlbums(tt.content); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.content, tt.expected, got)
+		}
+	}
+}
+
+func TestProcessTagAlbums(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg", "album/b.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "album", "a.jpg.tags"), []byte("#pets #2023\n"), 0644)
+
+	config := testConfig(root)
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stub.count("upload") != 2 {
+		t.Errorf("Each photo should be uploaded once, got %d uploads", stub.count("upload"))
+	}
+	id := stub.set("album").Photos[0]
+	for _, title := range []string{"pets", "2023"} {
+		if set := stub.set(title); set == nil || !reflect.DeepEqual(set.Photos, []string{id}) {
+			t.Errorf("%s should hold the uploaded photo %s, got %v", title, id, set)
+		}
+	}
+}
+
+func TestProcessTagAlbumsDedup(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	pets := stub.addSet("pets", "a")
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "album", "a.jpg.tags"), []byte("pets\n2023\n"), 0644)
+
+	config := testConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("upload") != 0 {
+		t.Errorf("A photo found in one of its albums should not be uploaded, got %d uploads", stub.count("upload"))
+	}
+	id := stub.findSet(pets).Photos[0]
+	for _, title := range []string{"album", "2023"} {
+		if set := stub.set(title); set == nil || !reflect.DeepEqual(set.Photos, []string{id}) {
+			t.Errorf("%s should hold the existing photo %s, got %v", title, id, set)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package synckr
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exifDateFormat is how the {exifdate} token is rendered
+const exifDateFormat = "2006-01-02"
+
+// exifMonthFormat names the albums of AlbumNameExifDate
+const exifMonthFormat = "2006-01"
+
+// Strategies naming the album of a file. Tags are always derived from the
+// directories of the file, whatever the strategy
+const (
+	// AlbumNameDirectory names albums after directories, see albumName and
+	// AlbumTitleTemplate. This is the default
+	AlbumNameDirectory = "directory"
+	// AlbumNameExifDate names albums after the capture month of the photos.
+	// Photos without EXIF date fall back to AlbumNameDirectory
+	AlbumNameExifDate = "exif_date"
+)
+
+// fileContext holds the values of the tokens available in title templates
+type fileContext struct {
+	// Filename is the base name of the file without its extension
+	Filename string
+	// Dir is the default album name of the file
+	Dir string
+	// RelPath is the slash separated path of the file relative to PhotoLibraryPath
+	RelPath string
+	// Ext is the extension of the file, without the leading dot
+	Ext string
+	// ExifDate is the capture date of the photo, empty when unknown
+	ExifDate string
+}
+
+// newFileContext computes the template tokens of a file. EXIF data is only read
+// when one of the configured templates uses it
+func newFileContext(config *Config, path string) fileContext {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	ctx := fileContext{
+		Filename: strings.TrimSuffix(base, ext),
+		Dir:      albumName(config, path),
+		RelPath:  filepath.ToSlash(path),
+		Ext:      strings.TrimPrefix(ext, "."),
+	}
+	if rel, err := filepath.Rel(config.PhotoLibraryPath, path); err == nil {
+		ctx.RelPath = filepath.ToSlash(rel)
+	}
+
+	if strings.Contains(config.PhotoTitleTemplate+config.AlbumTitleTemplate, "{exifdate}") {
+		if exif, err := readExif(config, path); err == nil && !exif.DateTaken.IsZero() {
+			ctx.ExifDate = exif.DateTaken.Format(exifDateFormat)
+		}
+	}
+	return ctx
+}
+
+// renderTemplate expands the {filename}, {dir}, {relpath}, {ext} and {exifdate}
+// tokens of a template. Unknown tokens are left untouched
+func renderTemplate(tmpl string, ctx fileContext) string {
+	return strings.NewReplacer(
+		"{filename}", ctx.Filename,
+		"{dir}", ctx.Dir,
+		"{relpath}", ctx.RelPath,
+		"{ext}", ctx.Ext,
+		"{exifdate}", ctx.ExifDate,
+	).Replace(tmpl)
+}
+
+// photoTitle returns the flickr title of a local file, used both for upload and dedup.
+// Without PhotoTitleTemplate, it is the name up to its first dot, or the whole name
+// without extension with FullNameTitles.
+// The file name is cleaned by TitleStripPrefixes and TitleRegexReplace first, the
+// title is normalized according to TitleNormalization
+func photoTitle(config *Config, path string) string {
+	if config.PhotoTitleTemplate == "" {
+		if !config.FullNameTitles {
+			return dotCutTitle(config, path)
+		}
+		base := filepath.Base(path)
+		return normalizeTitle(config, cleanFilename(config, strings.TrimSuffix(base, filepath.Ext(base))))
+	}
+	ctx := newFileContext(config, path)
+	ctx.Filename = cleanFilename(config, ctx.Filename)
+	return normalizeTitle(config, renderTemplate(config.PhotoTitleTemplate, ctx))
+}
+
+// TitleReplacement replaces the matches of a regular expression in file names
+// when deriving photo titles. Replacement may refer to groups as $1
+type TitleReplacement struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// hasTitleRules tells whether file names are cleaned before becoming titles
+func hasTitleRules(config *Config) bool {
+	return len(config.TitleStripPrefixes) > 0 || len(config.TitleRegexReplace) > 0
+}
+
+// cleanFilename strips the first matching TitleStripPrefixes from a file name, then
+// applies TitleRegexReplace in order. The name is kept when nothing would be left
+func cleanFilename(config *Config, name string) string {
+	result := name
+	for _, prefix := range config.TitleStripPrefixes {
+		if prefix != "" && strings.HasPrefix(result, prefix) {
+			result = strings.TrimPrefix(result, prefix)
+			break
+		}
+	}
+	for _, rule := range config.TitleRegexReplace {
+		if re := compiledPattern(rule.Pattern); re != nil {
+			result = re.ReplaceAllString(result, rule.Replacement)
+		}
+	}
+	if strings.TrimSpace(result) == "" {
+		return name
+	}
+	return result
+}
+
+// titlePatterns caches the compiled TitleRegexReplace patterns. Invalid ones are
+// cached as nil, so that they are reported once
+var titlePatterns = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// compiledPattern compiles a pattern on first use. It returns nil for an invalid pattern
+func compiledPattern(pattern string) *regexp.Regexp {
+	titlePatterns.Lock()
+	defer titlePatterns.Unlock()
+	re, ok := titlePatterns.compiled[pattern]
+	if !ok {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"pattern": pattern,
+				"error":   err,
+			}).Warn("[WARNING] Invalid title pattern, ignoring it")
+		}
+		titlePatterns.compiled[pattern] = re
+	}
+	return re
+}
+
+// albumTitle returns the title of the flickr album a local file belongs to, according
+// to AlbumNameStrategy
+func albumTitle(config *Config, path string) string {
+	if config.AlbumNameStrategy == AlbumNameExifDate {
+		if exif, err := readExif(config, path); err == nil && !exif.DateTaken.IsZero() {
+			return exif.DateTaken.Format(exifMonthFormat)
+		}
+	}
+	if config.AlbumTitleTemplate == "" {
+		return albumName(config, path)
+	}
+	return renderTemplate(config.AlbumTitleTemplate, newFileContext(config, path))
+}
+
+// albumTitleForDir returns the title of the album the files of a directory
+// belong to, when it doesn't depend on the files themselves
+func albumTitleForDir(config *Config, dir string) string {
+	return albumTitle(config, filepath.Join(dir, placeholderName))
+}
@@ -0,0 +1,172 @@
+package synckr
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	ctx := fileContext{
+		Filename: "IMG_0001",
+		Dir:      "Rome",
+		RelPath:  "2023/Rome/IMG_0001.JPG",
+		Ext:      "JPG",
+		ExifDate: "2023-05-01",
+	}
+
+	tests := map[string]string{
+		"{filename}":         "IMG_0001",
+		"{dir}":              "Rome",
+		"{relpath}":          "2023/Rome/IMG_0001.JPG",
+		"{ext}":              "JPG",
+		"{exifdate}":         "2023-05-01",
+		"{dir} - {exifdate}": "Rome - 2023-05-01",
+		"{unknown} {dir}":    "{unknown} Rome",
+		"no token":           "no token",
+	}
+	for tmpl, expected := range tests {
+		if got := renderTemplate(tmpl, ctx); got != expected {
+			t.Errorf("%q: expected %q, got %q", tmpl, expected, got)
+		}
+	}
+}
+
+func TestTitleTemplates(t *testing.T) {
+	root, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "Rome"), 0755)
+
+	dated := filepath.Join(root, "Rome", "IMG.2.jpg")
+	writeJPEGExif(t, dated, 8, 8, exifSegment(1, "2019:07:14 10:00:00"))
+	undated := filepath.Join(root, "Rome", "plain.jpg")
+	writeJPEG(t, undated, 8, 8, 0)
+
+	config := Config{PhotoLibraryPath: root}
+	if got := photoTitle(&config, dated); got != "IMG" {
+		t.Errorf("Default title should be kept, got %q", got)
+	}
+	full := Config{PhotoLibraryPath: root, FullNameTitles: true}
+	if got := photoTitle(&full, dated); got != "IMG.2" {
+		t.Errorf("FullNameTitles should keep the name without extension, got %q", got)
+	}
+	if got := albumTitle(&config, dated); got != "Rome" {
+		t.Errorf("Default album should be kept, got %q", got)
+	}
+	if got := albumTitleForDir(&config, filepath.Join(root, "Rome")); got != "Rome" {
+		t.Errorf("A directory should be titled like the album of its files, got %q", got)
+	}
+
+	config.PhotoTitleTemplate = "{filename} ({exifdate})"
+	config.AlbumTitleTemplate = "{dir} - {exifdate}"
+	if got := photoTitle(&config, dated); got != "IMG.2 (2019-07-14)" {
+		t.Errorf("Unexpected photo title %q", got)
+	}
+	if got := albumTitle(&config, dated); got != "Rome - 2019-07-14" {
+		t.Errorf("Unexpected album title %q", got)
+	}
+	if got := photoTitle(&config, undated); got != "plain ()" {
+		t.Errorf("Unexpected photo title without EXIF %q", got)
+	}
+
+	params := buildUploadParams(&config, dated)
+	if params == nil || params.Title != "IMG.2 (2019-07-14)" {
+		t.Errorf("The rendered title should be uploaded, got %v", params)
+	}
+}
+
+func TestTitleTemplateDedup(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("Rome", "Rome/a.jpg")
+
+	root := makeTree(t, "Rome/a.jpg", "Rome/b.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.PhotoTitleTemplate = "{relpath}"
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+	titles := stub.titles(stub.set("Rome"))
+	if len(titles) != 2 || titles[1] != "Rome/b.jpg" {
+		t.Errorf("Only b should be uploaded with its rendered title, got %v", titles)
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	config := Config{
+		PhotoLibraryPath:   "/photos",
+		TitleStripPrefixes: []string{"DSC_", "IMG_"},
+		TitleRegexReplace: []TitleReplacement{
+			{`^(\d{4})(\d{2})(\d{2})_\d{6}$`, "$1-$2-$3"},
+			{`_+`, " "},
+			{`(`, "invalid"},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/photos/a/DSC_0042.jpg", "0042"},
+		{"/photos/a/IMG_DSC_1.jpg", "DSC 1"},
+		{"/photos/a/20230714_101500.jpg", "2023-07-14"},
+		{"/photos/a/my_holiday_pic.jpg", "my holiday pic"},
+		{"/photos/a/DSC_.jpg", "DSC_"},
+		{"/photos/a/plain.jpg", "plain"},
+	}
+	for _, tt := range tests {
+		if got := photoTitle(&config, tt.path); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.path, tt.expected, got)
+		}
+	}
+
+	// The cleaned name is what {filename} renders, and what is uploaded
+	config.PhotoTitleTemplate = "{dir} {filename}"
+	if got := photoTitle(&config, "/photos/a/DSC_0042.jpg"); got != "a 0042" {
+		t.Errorf("Unexpected templated title %q", got)
+	}
+	config.PhotoTitleTemplate = ""
+	if params := buildUploadParams(&config, "/photos/a/DSC_0042.jpg"); params == nil || params.Title != "0042" {
+		t.Errorf("The cleaned title should be uploaded, got %v", params)
+	}
+}
+
+func TestAlbumNameStrategyWithTagFromPath(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root, _ := ioutil.TempDir("", "synckr")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "2019", "Italy"), 0755)
+	writeJPEGExif(t, filepath.Join(root, "2019", "Italy", "rome.jpg"), 8, 8, exifSegment(1, "2019:07:14 10:00:00"))
+	writeJPEGExif(t, filepath.Join(root, "2019", "Italy", "milan.jpg"), 8, 8, exifSegment(1, "2019:08:02 10:00:00"))
+	writeJPEG(t, filepath.Join(root, "2019", "Italy", "undated.jpg"), 8, 8, 0)
+
+	config := testConfig(root)
+	config.AlbumNameStrategy = AlbumNameExifDate
+	config.TagFromPath = true
+	config.SkipCompleteAlbums = true
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{"2019-07": "rome", "2019-08": "milan", "Italy": "undated"}
+	for album, title := range expected {
+		set := stub.set(album)
+		if set == nil || len(set.Photos) != 1 || stub.photos[set.Photos[0]].Title != title {
+			t.Errorf("Album %s should only contain %s, got %v", album, title, set)
+			continue
+		}
+		if tags := stub.photos[set.Photos[0]].Args.Get("tags"); tags != "2019 Italy" {
+			t.Errorf("%s: tags should follow the directories, got %q", title, tags)
+		}
+	}
+	if stub.count("upload") != 3 {
+		t.Errorf("Photos should be uploaded once, got %d uploads", stub.count("upload"))
+	}
+}
@@ -0,0 +1,82 @@
+package synckr
+
+import (
+	"encoding/xml"
+	"errors"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+)
+
+// Values of the complete attribute of an upload ticket
+const (
+	ticketPending  = 0
+	ticketComplete = 1
+	ticketFailed   = 2
+)
+
+// ErrTicketTimeout is returned when flickr did not process an asynchronous
+// upload within RetrieveAttempts checks
+var ErrTicketTimeout error = &Error{Kind: ErrUpload, Err: errors.New("upload ticket did not complete")}
+
+// errTicketFailed is returned when flickr could not process an asynchronous upload
+var errTicketFailed = errors.New("upload ticket failed")
+
+// checkTicketsResponse is the response of flickr.photos.upload.checkTickets,
+// which the flickr library does not implement
+type checkTicketsResponse struct {
+	flickr.BasicResponse
+	Tickets []struct {
+		ID       string `xml:"id,attr"`
+		Complete int    `xml:"complete,attr"`
+		Invalid  int    `xml:"invalid,attr"`
+		PhotoID  string `xml:"photoid,attr"`
+	} `xml:"uploader>ticket"`
+}
+
+func checkTicket(client *flickr.FlickrClient, ticket string) (*checkTicketsResponse, error) {
+	client.Init()
+	client.Args.Set("method", "flickr.photos.upload.checkTickets")
+	client.Args.Set("tickets", ticket)
+	client.OAuthSign()
+
+	response := &checkTicketsResponse{}
+	err := flickr.DoGet(client, response)
+	return response, err
+}
+
+// uploadTicket returns the ticket of an upload flickr processes asynchronously,
+// which it answers with a ticket instead of a photo ID
+func uploadTicket(resp *flickr.UploadResponse) string {
+	var ticket struct {
+		ID string `xml:"ticketid"`
+	}
+	xml.Unmarshal([]byte("<rsp>"+resp.Extra+"</rsp>"), &ticket)
+	return ticket.ID
+}
+
+// waitForTicket polls flickr every RetrieveInterval until the upload of a ticket
+// is processed, and returns the ID of the photo. It gives up with ErrTicketTimeout
+// after RetrieveAttempts checks
+func waitForTicket(client *flickr.FlickrClient, config *Config, ticket string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := checkTicket(client, ticket)
+		if err == nil {
+			for _, t := range resp.Tickets {
+				if t.ID != ticket {
+					continue
+				}
+				if t.Invalid != 0 || t.Complete == ticketFailed {
+					return "", errTicketFailed
+				}
+				if t.Complete == ticketComplete {
+					return t.PhotoID, nil
+				}
+			}
+		}
+		if attempt >= config.RetrieveAttempts {
+			return "", ErrTicketTimeout
+		}
+		time.Sleep(config.RetrieveInterval * time.Second)
+	}
+}
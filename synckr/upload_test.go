@@ -0,0 +1,82 @@
+package synckr
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadPhotoResult(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	existing := stub.addSet("existing", "a")
+
+	root := makeTree(t, "new/b.jpg", "existing/c.jpg")
+	defer os.RemoveAll(root)
+	entry := log.WithField("album", "test")
+	config := testConfig(root)
+
+	result, err := UploadPhoto(stub.client(), &config, entry, "", "new", "", filepath.Join(root, "new", "b.jpg"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.PhotoID == "" || result.AlbumID != stub.set("new").ID || !result.AlbumCreated {
+		t.Errorf("Expected the photo to be uploaded into a new album, got %+v", result)
+	}
+	if result.BytesSent != int64(len("new/b.jpg")) || result.Duration <= 0 {
+		t.Errorf("Expected the transfer to be measured, got %+v", result)
+	}
+
+	result, err = UploadPhoto(stub.client(), &config, entry, existing, "existing", "", filepath.Join(root, "existing", "c.jpg"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.AlbumID != existing || result.AlbumCreated {
+		t.Errorf("Expected the photo to be added to the existing album, got %+v", result)
+	}
+}
+
+func TestUploadPhotoWaitsForTicket(t *testing.T) {
+	tests := []struct {
+		attempts int
+		polls    int
+		err      error
+	}{
+		{5, 3, nil},
+		{1, 2, ErrTicketTimeout},
+	}
+
+	for _, tt := range tests {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/a.jpg")
+
+		stub.hook("upload", func(args url.Values) string {
+			return `<rsp stat="ok"><ticketid>T1</ticketid></rsp>`
+		})
+		polls := 0
+		stub.hook("flickr.photos.upload.checkTickets", func(args url.Values) string {
+			polls++
+			if polls < 3 {
+				return `<rsp stat="ok"><uploader><ticket id="T1" complete="0"/></uploader></rsp>`
+			}
+			return `<rsp stat="ok"><uploader><ticket id="T1" complete="1" photoid="` + stub.addPhoto("a") + `"/></uploader></rsp>`
+		})
+
+		config := testConfig(root)
+		config.RetrieveAttempts = tt.attempts
+		result, err := UploadPhoto(stub.client(), &config, log.WithField("album", "album"), "", "album", "", filepath.Join(root, "album", "a.jpg"), nil)
+		if err != tt.err {
+			t.Errorf("%d attempts: expected %v, got %v", tt.attempts, tt.err, err)
+		}
+		if tt.err == nil && (result.PhotoID == "" || stub.set("album") == nil) {
+			t.Errorf("%d attempts: expected the ticket photo to be added to a new album, got %+v", tt.attempts, result)
+		}
+		if polls != tt.polls {
+			t.Errorf("%d attempts: expected %d checks, got %d", tt.attempts, tt.polls, polls)
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+	}
+}
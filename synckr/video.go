@@ -0,0 +1,59 @@
+package synckr
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// checksumMachineTagPrefix starts the machine tag recording the SHA-256 of an
+// uploaded video. flickr has no resumable uploads, so the checksum is what
+// tells whether a video was received despite a failed attempt
+const checksumMachineTagPrefix = "synckr:sha256="
+
+// checksumMachineTag returns the machine tag of a file with the given checksum
+func checksumMachineTag(sum string) string {
+	return checksumMachineTagPrefix + sum
+}
+
+// videoChecksumTag returns the checksum machine tag of a video when
+// VideoChecksumTag is set, an empty string otherwise or when the video can't be read
+func (r *syncRun) videoChecksumTag(logger *logrus.Entry, path string) string {
+	if !r.config.VideoChecksumTag || !matchesExtension(path, videoExtensions) {
+		return ""
+	}
+	sum, err := r.checksum(path)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"path":  path,
+			"error": err,
+		}).Warn("[WARNING] Could not compute checksum")
+		return ""
+	}
+	return checksumMachineTag(sum)
+}
+
+// relinkByChecksum looks for a video tagged with checksumTag on flickr and adds
+// it to the album titled title. It tells whether the video was found, and stops
+// at ErrAuthorization
+func (r *syncRun) relinkByChecksum(logger *logrus.Entry, title string, description string, albumID string, photoName string, checksumTag string) (bool, error) {
+	resp, err := searchMachineTag(r.client, checksumTag, 1)
+	if err != nil {
+		if isAuthError(resp) {
+			return false, ErrAuthorization
+		}
+		logger.WithFields(logrus.Fields{
+			"photo.name": photoName,
+			"error":      resp.ErrorMsg(),
+		}).Warn("[WARNING] Could not search video by checksum")
+		return false, nil
+	}
+	if len(resp.Photos.Photos) == 0 {
+		return false, nil
+	}
+
+	found := resp.Photos.Photos[0]
+	skipLog(logger, skipReasonUploaded).WithFields(logrus.Fields{
+		"photo.name": photoName,
+		"photo.id":   found.ID,
+	}).Info("[SKIP] Video already on flickr")
+	return true, r.relink(logger, title, description, albumID, FlickrPhoto{ID: found.ID, Title: photoName, Tags: []string{checksumTag}})
+}
@@ -0,0 +1,93 @@
+package synckr
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func videoConfig(root string) Config {
+	config := testConfig(root)
+	config.Extensions = append(config.Extensions, ".mp4")
+	config.VideoChecksumTag = true
+	return config
+}
+
+func TestVideoChecksumTag(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/clip.mp4", "album/a.jpg")
+	defer os.RemoveAll(root)
+	config := videoConfig(root)
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, _ := fileChecksum(&Config{}, filepath.Join(root, "album", "clip.mp4"))
+	for _, ph := range stub.photos {
+		tagged := strings.Contains(ph.machineTags(), checksumMachineTag(sum))
+		if tagged != (ph.Title == "clip") {
+			t.Errorf("Only videos should carry the checksum tag, got %q for %s", ph.machineTags(), ph.Title)
+		}
+	}
+}
+
+func TestVideoUploadReceivedDespiteFailure(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	// flickr got the whole video, but the answer was lost
+	stub.hook("upload", func(args url.Values) string {
+		if stub.count("upload") == 1 {
+			stub.mu.Lock()
+			stub.respond("upload", args, "clip.mp4")
+			stub.mu.Unlock()
+			return stubError(105, "Service currently unavailable")
+		}
+		return ""
+	})
+
+	root := makeTree(t, "album/clip.mp4")
+	defer os.RemoveAll(root)
+	config := videoConfig(root)
+	config.UploadAttempts = 3
+	if _, err := Process(&config, stub.client(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.count("upload") != 1 {
+		t.Errorf("The received video should not be uploaded again, got %d uploads", stub.count("upload"))
+	}
+	if titles := stub.titles(stub.set("album")); !reflect.DeepEqual(titles, []string{"clip"}) {
+		t.Errorf("The received video should be added to its album, got %v", titles)
+	}
+}
+
+func TestVideoAlreadyOnFlickr(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	stub.addSet("album", "a")
+
+	root := makeTree(t, "album/a.jpg", "album/renamed.mp4")
+	defer os.RemoveAll(root)
+	sum, _ := fileChecksum(&Config{}, filepath.Join(root, "album", "renamed.mp4"))
+	id := stub.addPhoto("clip")
+	stub.photos[id].Args = url.Values{"tags": {checksumMachineTag(sum)}}
+
+	config := videoConfig(root)
+	for i := 0; i < 2; i++ {
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stub.count("upload") != 0 {
+		t.Errorf("A video found by checksum should not be uploaded, got %d uploads", stub.count("upload"))
+	}
+	if photos := stub.set("album").Photos; len(photos) != 2 || photos[1] != id {
+		t.Errorf("The video should be added to its album once, got %v", photos)
+	}
+}
@@ -0,0 +1,110 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// walkLibrary walks the tree rooted at root like filepath.Walk, visiting the entries
+// of each directory in the order of SortKey and NaturalSort, and descending into
+// symlinked directories when FollowSymlinks is set.
+// The tree is read from the libraryFS, from the disk when following symlinks.
+// Symlinked directories are visited under their link path, cycles are logged to logger
+func walkLibrary(config *Config, logger logrus.FieldLogger, root string, fn filepath.WalkFunc) error {
+	if fsys := libraryFS(config); fsys != nil {
+		return walkFS(config, fsys, root, fn)
+	}
+
+	w := &libraryWalker{
+		fn:      fn,
+		log:     logger,
+		config:  config,
+		follow:  config.FollowSymlinks,
+		parents: make(map[string]bool),
+	}
+
+	info, err := w.stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, info)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// libraryWalker holds the state of a walkLibrary
+type libraryWalker struct {
+	fn     filepath.WalkFunc
+	log    logrus.FieldLogger
+	config *Config
+	follow bool
+	// parents are the resolved paths of the directories being walked, a symlink
+	// to one of them is a cycle
+	parents map[string]bool
+}
+
+// stat returns the information of the symlink target when following symlinks,
+// of the entry itself otherwise
+func (w *libraryWalker) stat(path string) (os.FileInfo, error) {
+	if w.follow {
+		return os.Stat(path)
+	}
+	return os.Lstat(path)
+}
+
+func (w *libraryWalker) walk(path string, info os.FileInfo) error {
+	if !info.IsDir() {
+		return w.fn(path, info, nil)
+	}
+
+	if w.follow {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return w.fn(path, info, err)
+		}
+		if w.parents[resolved] {
+			skipLog(w.log, skipReasonSymlinkCycle).WithFields(logrus.Fields{
+				"path":   path,
+				"target": resolved,
+			}).Warn("[SKIP] symlink cycle detected")
+			return nil
+		}
+		w.parents[resolved] = true
+		defer delete(w.parents, resolved)
+	}
+
+	f, err := os.Open(path)
+	var names []string
+	if err == nil {
+		names, err = f.Readdirnames(-1)
+		f.Close()
+	}
+	err1 := w.fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	sortEntries(w.config, path, names, func(name string) (os.FileInfo, error) {
+		return w.stat(filepath.Join(path, name))
+	})
+
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := w.stat(filename)
+		if err != nil {
+			if err := w.fn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		err = w.walk(filename, fileInfo)
+		if err != nil && (!fileInfo.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+	return nil
+}
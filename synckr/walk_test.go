@@ -0,0 +1,66 @@
+package synckr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFollowSymlinks(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		stub := newFlickrStub(t)
+		root := makeTree(t, "album/a.jpg")
+		outside := makeTree(t, "b.jpg")
+		if err := os.Symlink(outside, filepath.Join(root, "linked")); err != nil {
+			t.Fatal(err)
+		}
+
+		config := testConfig(root)
+		config.FollowSymlinks = follow
+		if _, err := Process(&config, stub.client(), nil); err != nil {
+			t.Fatal(err)
+		}
+		set := stub.set("linked")
+		if follow && (set == nil || len(set.Photos) != 1) {
+			t.Error("The symlinked directory should be uploaded as an album")
+		}
+		if !follow && set != nil {
+			t.Error("Symlinked directories should not be followed by default")
+		}
+
+		stub.Close()
+		os.RemoveAll(root)
+		os.RemoveAll(outside)
+	}
+}
+
+func TestFollowSymlinksCycle(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+	if err := os.Symlink(filepath.Join(root, "album"), filepath.Join(root, "album", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+
+	config := testConfig(root)
+	config.FollowSymlinks = true
+	config.LogLevel = "warning"
+	if _, err := Process(&config, stub.client(), logger); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[SKIP] symlink cycle detected") {
+		t.Errorf("The cycle should be logged, got %s", out.String())
+	}
+	if stub.count("upload") != 1 {
+		t.Errorf("The photo should be uploaded once, got %d uploads", stub.count("upload"))
+	}
+}
@@ -0,0 +1,192 @@
+package synckr
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/masci/flickr.v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultWatchInterval is the number of seconds between two scans
+// when WatchInterval is not set
+const defaultWatchInterval = 10
+
+// fileState is what the watcher remembers about a file to detect changes
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// watcher periodically scans the photo library and dispatches the files
+// which appeared or changed since the previous scan.
+// A file is only dispatched once it has been seen unchanged on two consecutive
+// scans, so that files still being copied are not uploaded half-written.
+type watcher struct {
+	config   *Config
+	log      *logrus.Logger
+	interval time.Duration
+	known    map[string]fileState
+	pending  map[string]fileState
+	dispatch func(path string) error
+	// flush, when set, is called once the files settled on a scan were dispatched
+	flush func() error
+}
+
+func newWatcher(config *Config, logger *logrus.Logger, dispatch func(path string) error) *watcher {
+	interval := config.WatchInterval * time.Second
+	if interval <= 0 {
+		interval = defaultWatchInterval * time.Second
+	}
+	return &watcher{
+		config:   config,
+		log:      logger,
+		interval: interval,
+		known:    make(map[string]fileState),
+		pending:  make(map[string]fileState),
+		dispatch: dispatch,
+	}
+}
+
+// scan walks the library, respecting SkipDirs, ExcludeGlobs, SkipHidden, MaxDepth and FollowSymlinks, and returns the state of every file
+func (w *watcher) scan() map[string]fileState {
+	result := make(map[string]fileState)
+	walkLibrary(w.config, w.log, w.config.PhotoLibraryPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if isSkippedDir(w.config, path) || isExcludedPath(w.config, path) || isHidden(w.config, path) || exceedsMaxDepth(w.config, path) || hasNoMedia(w.config, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isExcludedPath(w.config, path) {
+			return nil
+		}
+		result[path] = fileState{info.Size(), info.ModTime()}
+		return nil
+	})
+	return result
+}
+
+// poll runs a single scan and dispatches the files that settled since the previous one.
+// It stops at the first dispatch error, leaving the remaining files pending
+func (w *watcher) poll() error {
+	defer func() { queueDepth.Set(int64(len(w.pending))) }()
+	current := w.scan()
+
+	for path, state := range current {
+		if pendingState, ok := w.pending[path]; ok {
+			if pendingState == state {
+				delete(w.pending, path)
+				w.known[path] = state
+				w.log.WithField("path", path).Debug("[WATCH] File settled")
+				if err := w.dispatch(path); err != nil {
+					return err
+				}
+			} else {
+				w.pending[path] = state
+			}
+			continue
+		}
+
+		if knownState, ok := w.known[path]; !ok || knownState != state {
+			w.pending[path] = state
+		}
+	}
+
+	// Forget about files which have been removed
+	for path := range w.known {
+		if _, ok := current[path]; !ok {
+			delete(w.known, path)
+		}
+	}
+	for path := range w.pending {
+		if _, ok := current[path]; !ok {
+			delete(w.pending, path)
+		}
+	}
+	if w.flush != nil {
+		return w.flush()
+	}
+	return nil
+}
+
+// run polls the library until stop is closed or a dispatch fails
+func (w *watcher) run(stop <-chan struct{}) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if err := w.poll(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newWatch returns a watcher dispatching the files to a run set up like the one
+// of Process: files are tracked in the index and the failures to retry, and the
+// photos held for an album are filed after each scan. finish saves the state of
+// the run
+func newWatch(config *Config, client *flickr.FlickrClient, fromFlickr map[string][]FlickrPhotoset, logger *logrus.Logger) (*watcher, func(), error) {
+	run := newSyncRun(config, client, fromFlickr, logger)
+	finish, err := run.prepare()
+	if err != nil {
+		return nil, nil, err
+	}
+	w := newWatcher(config, logger, func(path string) error {
+		run.forget(filepath.Dir(path))
+		return run.processTracked(path)
+	})
+	w.flush = run.flushHeld
+	w.known = w.scan()
+	return w, finish, nil
+}
+
+// Watch stays resident after an initial Process and uploads new or changed files
+// as they appear in the photo library. fromFlickr is the map returned by Process,
+// and parentlog is the logger given to it.
+// It returns when stop is closed, or never if stop is nil, unless the upload quota
+// or MaxUploadsPerRun is reached or the token is rejected
+func Watch(config *Config, client *flickr.FlickrClient, fromFlickr map[string][]FlickrPhotoset, parentlog *logrus.Logger, stop <-chan struct{}) error {
+	logger := log
+	if parentlog != nil {
+		logger = parentlog
+	}
+	SetLogLevel(config, logger)
+
+	w, finish, err := newWatch(config, client, fromFlickr, logger)
+	if err != nil {
+		return err
+	}
+	defer finish()
+
+	logger.WithFields(logrus.Fields{
+		"path":     config.PhotoLibraryPath,
+		"interval": w.interval,
+	}).Info("[WATCH] Watching photo library for changes")
+
+	err = w.run(stop)
+	if err == ErrUploadQuota {
+		logger.Error("[ABORT] upload quota reached")
+	}
+	if err == ErrAuthorization {
+		logger.Error(authFailedMessage)
+	}
+	if err == errUploadCap {
+		logger.WithField("max_uploads_per_run", config.MaxUploadsPerRun).Info("[STOP] per-run upload cap reached")
+		return nil
+	}
+	if err == errFileLimit {
+		logger.WithField("file_limit", config.FileLimit).Info("[STOP] file limit reached")
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package synckr
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWatcherDispatchesNewFiles(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/existing.jpg", "@eaDir/thumb.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	client := stub.client()
+	fromFlickr, err := Process(&config, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.count("upload") != 1 {
+		t.Fatalf("Initial process should upload 1 photo, got %d", stub.count("upload"))
+	}
+
+	var dispatched []string
+	run := newSyncRun(&config, client, fromFlickr, log)
+	w := newWatcher(&config, log, func(path string) error {
+		dispatched = append(dispatched, path)
+		return run.processFile(path)
+	})
+	w.known = w.scan()
+
+	newPhoto := filepath.Join(root, "album", "new.jpg")
+	if err := ioutil.WriteFile(newPhoto, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "@eaDir", "new.jpg"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file has to be seen unchanged twice before being dispatched
+	w.poll()
+	if len(dispatched) != 0 {
+		t.Fatalf("File should not be dispatched before it settles, got %v", dispatched)
+	}
+	w.poll()
+	if len(dispatched) != 1 || dispatched[0] != newPhoto {
+		t.Fatalf("Expected %s to be dispatched, got %v", newPhoto, dispatched)
+	}
+	if stub.count("upload") != 2 {
+		t.Errorf("New photo should have been uploaded, got %d uploads", stub.count("upload"))
+	}
+
+	w.poll()
+	if len(dispatched) != 1 {
+		t.Errorf("Unchanged files should not be dispatched again, got %v", dispatched)
+	}
+}
+
+func TestWatchTracksFailures(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/existing.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.FailuresFile = filepath.Join(root, "failures.json")
+	client := stub.client()
+	fromFlickr, err := Process(&config, client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, finish, err := newWatch(&config, client, fromFlickr, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.hook("upload", func(args url.Values) string {
+		return stubError(105, "Service currently unavailable")
+	})
+	newPhoto := filepath.Join(root, "album", "new.jpg")
+	if err := ioutil.WriteFile(newPhoto, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.poll()
+	w.poll()
+	finish()
+
+	failures, _ := loadFailures(config.FailuresFile)
+	if !failures[newPhoto] || len(failures) != 1 {
+		t.Errorf("Expected the failed upload of %s to be recorded, got %v", newPhoto, failures)
+	}
+}
+
+func TestWatcherExcludeGlobs(t *testing.T) {
+	root := makeTree(t, "album/a.jpg", "album/b.tmp", "album/private/c.jpg", "@eaDir/thumb.jpg")
+	defer os.RemoveAll(root)
+
+	config := testConfig(root)
+	config.ExcludeGlobs = []string{"*.tmp", "album/private"}
+	w := newWatcher(&config, log, func(path string) error { return nil })
+
+	scanned := w.scan()
+	if _, ok := scanned[filepath.Join(root, "album", "a.jpg")]; !ok || len(scanned) != 1 {
+		t.Errorf("Expected only album/a.jpg to be watched, got %v", scanned)
+	}
+}
+
+func TestWatchLogsToParentLogger(t *testing.T) {
+	stub := newFlickrStub(t)
+	defer stub.Close()
+
+	root := makeTree(t, "album/a.jpg")
+	defer os.RemoveAll(root)
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+
+	config := testConfig(root)
+	config.LogLevel = "info"
+	stop := make(chan struct{})
+	close(stop)
+	if err := Watch(&config, stub.client(), nil, logger, stop); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "[WATCH] Watching photo library") {
+		t.Errorf("Watch should log to the logger it is given, got %q", out.String())
+	}
+}